@@ -32,6 +32,11 @@ func (b *Batch) Read() interface{} {
 	return v
 }
 
+// Len return number of items in buffer
+func (b *Batch) Len() int {
+	return b.q.Len()
+}
+
 // Reset clear the buffer
 func (b *Batch) Reset() {
 	b.q.Init()
@@ -43,6 +48,15 @@ type BatchFillFunc func(b *Batch, payload interface{}) error
 // BatchExecFunc is the handler for execute the batch
 type BatchExecFunc func(b *Batch) error
 
+// BatchObserveFunc is called after the batch has executed with number of items and the reason of execution
+// (size = batch is full, timeout = batch timeout, flush = Flush is called, close = payload has closed)
+type BatchObserveFunc func(size int, reason string)
+
+// batchFlush is the payload that request BatchEvent to execute the pending batch immediately
+type batchFlush struct {
+	ack chan bool
+}
+
 // BatchEvent is struct to manage batch life cycle event
 type BatchEvent struct {
 	batchSize int
@@ -52,6 +66,7 @@ type BatchEvent struct {
 	done      BatchExecFunc
 	payload   chan interface{}
 	errc      chan error
+	observe   BatchObserveFunc
 }
 
 // NewBatchEvent return new BatchEvent
@@ -73,16 +88,46 @@ func NewBatchEvent(
 	}
 }
 
+// Observe set function that is called after every batch has executed, such as to collect batch metrics
+// It must be called before Start
+func (be *BatchEvent) Observe(observe BatchObserveFunc) {
+	be.observe = observe
+}
+
+// executeBatch execute the batch and reset it
+func (be *BatchEvent) executeBatch(batch *Batch, reason string) {
+	size := batch.Len()
+	err := be.execute(batch)
+	batch.Reset()
+	if err != nil {
+		be.errc <- err
+	}
+	if be.observe != nil && size > 0 {
+		be.observe(size, reason)
+	}
+}
+
+// Flush execute the pending batch immediately and wait until it has executed,
+// every payloads that have sent before Flush are included in the pending batch
+// Flush must be called from the goroutine that send payload, and before payload has closed
+func (be *BatchEvent) Flush() {
+	ack := make(chan bool)
+	be.payload <- &batchFlush{ack: ack}
+	<-ack
+}
+
 // Start start the batch event
 // Loop will exit when payload has closed close(payload)
 func (be *BatchEvent) Start() {
 	fill := make(chan interface{})
-	exec := make(chan bool)
+	exec := make(chan string)
+	flush := make(chan chan bool)
 	done := make(chan bool, 1)
 	stop := make(chan bool, 1) // stop timer channel
 	defer func() {
 		close(stop)
 		close(done)
+		close(flush)
 		close(exec)
 		close(fill)
 	}()
@@ -101,7 +146,7 @@ func (be *BatchEvent) Start() {
 					i := atomic.LoadInt32(&n)
 					if i > 0 {
 						atomic.StoreInt32(&n, 0)
-						exec <- true
+						exec <- "timeout"
 					}
 				}
 			}
@@ -112,11 +157,18 @@ func (be *BatchEvent) Start() {
 		for {
 			p, ok := <-payload
 			if ok {
+				// Flush request is sent through payload, so every payloads before it are already in the batch
+				req, isFlush := p.(*batchFlush)
+				if isFlush {
+					atomic.StoreInt32(&n, 0)
+					flush <- req.ack
+					continue
+				}
 				fill <- p
 				i := atomic.AddInt32(&n, 1)
 				if i >= int32(batchSize) {
 					atomic.StoreInt32(&n, 0)
-					exec <- true
+					exec <- "size"
 				}
 			} else {
 				// close everything
@@ -125,7 +177,7 @@ func (be *BatchEvent) Start() {
 					stop <- true
 				}
 				// execute last batch
-				exec <- true
+				exec <- "close"
 				// exit from executor
 				done <- true
 				return
@@ -141,12 +193,11 @@ func (be *BatchEvent) Start() {
 			if err != nil {
 				be.errc <- err
 			}
-		case <-exec:
-			err := be.execute(batch)
-			batch.Reset()
-			if err != nil {
-				be.errc <- err
-			}
+		case reason := <-exec:
+			be.executeBatch(batch, reason)
+		case ack := <-flush:
+			be.executeBatch(batch, "flush")
+			ack <- true
 		case <-done:
 			return
 		}
@@ -2,8 +2,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -17,6 +19,71 @@ type ICacher interface {
 	HasChanged(key string, value string) (bool, error)
 	Close() error
 	Healthcheck() error
+	// WithContext return cacher that share the connection, and return ctx.Err() when ctx is done
+	WithContext(ctx context.Context) ICacher
+
+	// Distributed lock with lease and fencing token
+	TryLock(key string, lease time.Duration) (ILock, error)
+	Lock(key string, lease time.Duration, wait time.Duration) (ILock, error)
+
+	// Atomic operations, the concurrent writers do not overwrite the updates of each others
+	SetNX(key string, value interface{}, expire time.Duration) (bool, error)
+	Update(key string, expire time.Duration, update func(current string) (interface{}, error)) error
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+	HSet(key string, fields map[string]interface{}, expire time.Duration) error
+	HReplace(key string, fields map[string]interface{}, expire time.Duration) error
+	HGet(key string, field string) (string, error)
+	HGetAll(key string) (map[string]string, error)
+	HIncrBy(key string, field string, incr int64) (int64, error)
+
+	// Keys, the values are encoded in JSON as Set
+	MGet(keys ...string) ([]string, error)
+	MSet(values map[string]interface{}, expire time.Duration) error
+	Del(keys ...string) (int64, error)
+	Exists(keys ...string) (int64, error)
+	Expire(key string, expire time.Duration) (bool, error)
+	TTL(key string) (time.Duration, error)
+	IncrBy(key string, incr int64) (int64, error)
+	Scan(pattern string, count int64, fn func(keys []string) error) error
+
+	// Hashes
+	HDel(key string, fields ...string) (int64, error)
+	HExists(key string, field string) (bool, error)
+	HKeys(key string) ([]string, error)
+	HLen(key string) (int64, error)
+
+	// Lists
+	LPush(key string, values ...interface{}) (int64, error)
+	RPush(key string, values ...interface{}) (int64, error)
+	LPop(key string) (string, error)
+	RPop(key string) (string, error)
+	LRange(key string, start int64, stop int64) ([]string, error)
+	LLen(key string) (int64, error)
+	LTrim(key string, start int64, stop int64) error
+
+	// Sets
+	SAdd(key string, members ...interface{}) (int64, error)
+	SRem(key string, members ...interface{}) (int64, error)
+	SMembers(key string) ([]string, error)
+	SIsMember(key string, member interface{}) (bool, error)
+	SCard(key string) (int64, error)
+
+	// Sorted sets
+	ZAdd(key string, members ...CacheZ) (int64, error)
+	ZIncrBy(key string, incr float64, member interface{}) (float64, error)
+	ZRem(key string, members ...interface{}) (int64, error)
+	ZRemRangeByScore(key string, min string, max string) (int64, error)
+	ZScore(key string, member interface{}) (float64, bool, error)
+	ZRank(key string, member interface{}) (int64, error)
+	ZRevRank(key string, member interface{}) (int64, error)
+	ZRange(key string, start int64, stop int64) ([]CacheZ, error)
+	ZRevRange(key string, start int64, stop int64) ([]CacheZ, error)
+	ZRangeByScore(key string, min string, max string, offset int64, count int64) ([]CacheZ, error)
+	ZCard(key string) (int64, error)
+
+	// Pipelines send many commands in one round trip
+	Pipelined(fn func(pipe ICachePipeline) error) error
+	TxPipelined(fn func(pipe ICachePipeline) error) error
 }
 
 // Cacher implement ICacher to connect with Redis
@@ -24,6 +91,11 @@ type Cacher struct {
 	ms     *Microservice
 	server string
 	client *redis.Client
+	parent *Cacher
+	ctx    context.Context
+
+	// mutex guard client, the cacher of service is shared by the handlers that run concurrently
+	mutex sync.Mutex
 }
 
 // NewCacher return new instance of Cacher
@@ -90,6 +162,7 @@ func (cache *Cacher) Get(key string) (string, error) {
 // HasChanged detect if value of key has changed it will return true
 // If get and error it will return true with error
 // If get the same value it will return false
+// Note: the key can be changed after HasChanged has returned, use Update to set the key only if it has not changed
 func (cache *Cacher) HasChanged(key string, value string) (bool, error) {
 	current, err := cache.Get(key)
 	if err != nil {
@@ -122,13 +195,38 @@ func (cache *Cacher) Healthcheck() error {
 	return nil
 }
 
+// WithContext return cacher that execute every commands with ctx, the connection is shared with cache
+// Note: the running command is not interrupted (go-redis v6), but the next command will not start when ctx is done
+func (cache *Cacher) WithContext(ctx context.Context) ICacher {
+	return &Cacher{
+		ms:     cache.ms,
+		server: cache.server,
+		parent: cache.root(),
+		ctx:    ctx,
+	}
+}
+
+// root return the cacher that own the connection
+func (cache *Cacher) root() *Cacher {
+	if cache.parent != nil {
+		return cache.parent
+	}
+	return cache
+}
+
 // Close close the redis client
 func (cache *Cacher) Close() error {
+	if cache.parent != nil {
+		// The connection is owned by parent
+		return nil
+	}
+
 	// Close current client
+	cache.mutex.Lock()
 	client := cache.client
+	cache.client = nil
+	cache.mutex.Unlock()
 	if client != nil {
-		cache.client = nil
-
 		err := client.Close()
 		if err != nil {
 			return err
@@ -140,11 +238,27 @@ func (cache *Cacher) Close() error {
 }
 
 func (cache *Cacher) getClient() (*redis.Client, error) {
+	if cache.parent != nil {
+		err := cache.ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		client, err := cache.parent.getClient()
+		if err != nil {
+			return nil, err
+		}
+		client = client.WithContext(cache.ctx)
+		cache.ms.traceRedis(cache.ctx, client)
+		return client, nil
+	}
+
+	cache.mutex.Lock()
 	client := cache.client
 	if client == nil {
 		client = cache.newClient(cache.server)
 		cache.client = client
 	}
+	cache.mutex.Unlock()
 
 	retry := 3 // Retry connecting 3 times, if cannot ping
 	for true {
@@ -166,8 +280,10 @@ func (cache *Cacher) getClient() (*redis.Client, error) {
 }
 
 func (cache *Cacher) newClient(server string) *redis.Client {
-	return redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr: server,
 		DB:   0,
 	})
+	cache.ms.instrumentRedis(client)
+	return client
 }
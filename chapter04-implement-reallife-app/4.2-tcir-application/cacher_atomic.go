@@ -0,0 +1,179 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	// ErrSkipUpdate is returned from the function of Update to leave the key unchanged, Update return nil
+	ErrSkipUpdate = errors.New("Skip update")
+	// ErrUpdateConflict is returned when the key has been changed by the other clients in every retries of Update
+	ErrUpdateConflict = errors.New("Key has been changed by the other clients")
+)
+
+// maxUpdateRetries is the number of times Update read the key again after the other clients have changed it
+const maxUpdateRetries = 100
+
+// SetNX set object into cache only if key does not exist, it return false if key exists
+func (cache *Cacher) SetNX(key string, value interface{}, expire time.Duration) (bool, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	str, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	return c.SetNX(key, str, expire).Result()
+}
+
+// Update read key (empty string if it does not exist), and set the value that update return in the same transaction
+// If the key has been changed by the other clients before the value is set, update is called again with the new value
+// The value is encoded in JSON as Set, update can return ErrSkipUpdate to leave the key unchanged
+func (cache *Cacher) Update(key string, expire time.Duration, update func(current string) (interface{}, error)) error {
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < maxUpdateRetries; i++ {
+		if cache.ctx != nil && cache.ctx.Err() != nil {
+			return cache.ctx.Err()
+		}
+		// 1. WATCH key, so EXEC fail if the other clients have changed it after GET
+		err = c.Watch(func(tx *redis.Tx) error {
+			current, err := tx.Get(key).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			value, err := update(current)
+			if err != nil {
+				return err
+			}
+			str, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+
+			// 2. Set the new value in MULTI/EXEC
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(key, str, expire)
+				return nil
+			})
+			return err
+		}, key)
+
+		if err == redis.TxFailedErr {
+			// 3. The key has changed, read it again
+			continue
+		}
+		if err == ErrSkipUpdate {
+			return nil
+		}
+		return err
+	}
+	return ErrUpdateConflict
+}
+
+// Eval run Lua script with keys and args atomically, the script is sent only once and then run by its SHA1
+// The result is nil if the script return nil (false in Lua)
+func (cache *Cacher) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := redis.NewScript(script).Run(c, keys, args...).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return val, nil
+}
+
+// HSet set objects into fields of hash, each values are encoded in JSON as Set
+// The expire of key is set if expire is more than 0, the fields and expire are set in the same transaction
+func (cache *Cacher) HSet(key string, fields map[string]interface{}, expire time.Duration) error {
+	return cache.hset(key, fields, expire, false)
+}
+
+// HReplace set fields of hash as HSet, but the fields that are not in fields are deleted (such as the fields of
+// previous run), the key is deleted and set again in the same transaction
+func (cache *Cacher) HReplace(key string, fields map[string]interface{}, expire time.Duration) error {
+	return cache.hset(key, fields, expire, true)
+}
+
+func (cache *Cacher) hset(key string, fields map[string]interface{}, expire time.Duration, replace bool) error {
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{}, len(fields))
+	for field, value := range fields {
+		str, err := encodeValue(value)
+		if err != nil {
+			return err
+		}
+		values[field] = str
+	}
+
+	_, err = c.TxPipelined(func(pipe redis.Pipeliner) error {
+		if replace {
+			pipe.Del(key)
+		}
+		pipe.HMSet(key, values)
+		if expire > 0 {
+			pipe.Expire(key, expire)
+		}
+		return nil
+	})
+	return err
+}
+
+// HGet get field of hash, it return empty string if key or field does not exist
+func (cache *Cacher) HGet(key string, field string) (string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	val, err := c.HGet(key, field).Result()
+	if err == redis.Nil {
+		// Key or field does not exists
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return val, nil
+}
+
+// HGetAll get every fields of hash, it return empty map if key does not exist
+func (cache *Cacher) HGetAll(key string) (map[string]string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.HGetAll(key).Result()
+}
+
+// HIncrBy increase integer field of hash by incr, and return the new value
+func (cache *Cacher) HIncrBy(key string, field string, incr int64) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.HIncrBy(key, field, incr).Result()
+}
@@ -0,0 +1,171 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// defaultScanCount is the number of keys that SCAN read in each round trip if count is not set
+const defaultScanCount = 100
+
+// encodeValue encode value in JSON as Set
+func encodeValue(value interface{}) (string, error) {
+	str, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(str), nil
+}
+
+// encodeValues encode every values in JSON as Set
+func encodeValues(values []interface{}) ([]interface{}, error) {
+	encoded := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		str, err := encodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, str)
+	}
+	return encoded, nil
+}
+
+// MGet get objects of keys in one round trip, the value of key that does not exist is empty string
+func (cache *Cacher) MGet(keys ...string) ([]string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := c.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(vals))
+	for i, val := range vals {
+		// Key does not exists is nil
+		values[i], _ = val.(string)
+	}
+	return values, nil
+}
+
+// MSet set objects of keys in one transaction, each values are encoded in JSON as Set
+// The expire of every keys is set if expire is more than 0
+func (cache *Cacher) MSet(values map[string]interface{}, expire time.Duration) error {
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	pairs := make([]interface{}, 0, len(values)*2)
+	for key, value := range values {
+		str, err := encodeValue(value)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, key, str)
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	_, err = c.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.MSet(pairs...)
+		if expire > 0 {
+			for key := range values {
+				pipe.Expire(key, expire)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Del delete keys, and return the number of keys that have been deleted
+func (cache *Cacher) Del(keys ...string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.Del(keys...).Result()
+}
+
+// Exists return the number of keys that exist
+func (cache *Cacher) Exists(keys ...string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.Exists(keys...).Result()
+}
+
+// Expire set expire of key, it return false if key does not exist
+func (cache *Cacher) Expire(key string, expire time.Duration) (bool, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	return c.Expire(key, expire).Result()
+}
+
+// TTL return the remaining time of key, it is -1s if key has no expire and -2s if key does not exist (as Redis)
+func (cache *Cacher) TTL(key string) (time.Duration, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.TTL(key).Result()
+}
+
+// IncrBy increase integer value of key by incr (the key that does not exist is 0), and return the new value
+// The value is the same as Set with integer, so it can be read with Get
+func (cache *Cacher) IncrBy(key string, incr int64) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.IncrBy(key, incr).Result()
+}
+
+// Scan call fn with the keys that match pattern (such as "citizen:*") until every keys have been scanned
+// or fn has returned error, count (0 is 100) is the hint of how many keys are read in each round trip
+// Scan does not block Redis as KEYS, but the key can be returned more than once
+func (cache *Cacher) Scan(pattern string, count int64, fn func(keys []string) error) error {
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	cursor := uint64(0)
+	for {
+		if cache.ctx != nil && cache.ctx.Err() != nil {
+			return cache.ctx.Err()
+		}
+		keys, next, err := c.Scan(cursor, pattern, count).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			err = fn(keys)
+			if err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
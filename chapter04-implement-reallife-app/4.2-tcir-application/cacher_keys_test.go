@@ -0,0 +1,169 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestCacherMSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		expire  time.Duration
+		wantTTL time.Duration
+	}{
+		{"with expire", time.Minute, time.Minute},
+		{"without expire", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacher, mr := newTestCacher(t)
+			defer mr.Close()
+			defer cacher.Close()
+
+			values := map[string]interface{}{
+				"citizen:1": map[string]string{"name": "A"},
+				"citizen:2": "B",
+				"count":     3,
+			}
+			err := cacher.MSet(values, tt.expire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Every keys are encoded in JSON and have the same expire
+			wants := map[string]string{"citizen:1": `{"name":"A"}`, "citizen:2": `"B"`, "count": "3"}
+			for key, want := range wants {
+				got, err := mr.Get(key)
+				if err != nil || got != want {
+					t.Errorf("%s = %s %v, want %s", key, got, err, want)
+				}
+				if ttl := mr.TTL(key); ttl != tt.wantTTL {
+					t.Errorf("TTL of %s = %s, want %s", key, ttl, tt.wantTTL)
+				}
+			}
+
+			got, err := cacher.MGet("citizen:2", "unknown", "count")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%q", got) != `["\"B\"" "" "3"]` {
+				t.Errorf("MGet() = %q, want the key that does not exist is empty string", got)
+			}
+		})
+	}
+}
+
+// startScanServer start Redis server that implement only PING and SCAN, each round trip return count keys of keys,
+// so Scan must follow the cursor, the cursors that have been sent are returned by the function
+func startScanServer(t *testing.T, keys []string) (*server.Server, func() []int) {
+	srv, err := server.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex := sync.Mutex{}
+	cursors := []int{}
+	srv.Register("PING", func(c *server.Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+	srv.Register("SCAN", func(c *server.Peer, cmd string, args []string) {
+		// SCAN cursor MATCH pattern COUNT count
+		cursor, _ := strconv.Atoi(args[0])
+		count, _ := strconv.Atoi(args[4])
+		mutex.Lock()
+		cursors = append(cursors, cursor)
+		mutex.Unlock()
+
+		// The keys that do not match are filtered after they are read as Redis, so the page can be empty
+		next := cursor + count
+		if next >= len(keys) {
+			next = len(keys)
+		}
+		page := []string{}
+		for _, key := range keys[cursor:next] {
+			if ok, _ := path.Match(args[2], key); ok {
+				page = append(page, key)
+			}
+		}
+		if next == len(keys) {
+			next = 0
+		}
+
+		c.WriteLen(2)
+		c.WriteBulk(strconv.Itoa(next))
+		c.WriteLen(len(page))
+		for _, key := range page {
+			c.WriteBulk(key)
+		}
+	})
+	return srv, func() []int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return cursors
+	}
+}
+
+func TestCacherScan(t *testing.T) {
+	keys := []string{}
+	for i := 0; i < 25; i++ {
+		keys = append(keys, fmt.Sprintf("citizen:%02d", i))
+	}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("other:%02d", i))
+	}
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name        string
+		count       int64
+		stopAt      int
+		wantKeys    int
+		wantCursors string
+		wantErr     error
+	}{
+		{"every keys", 10, -1, 25, "[0 10 20 30]", nil},
+		{"default count", 0, -1, 25, "[0]", nil},
+		{"stop when fn has failed", 10, 1, 20, "[0 10]", errStop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, cursors := startScanServer(t, keys)
+			defer srv.Close()
+			ms := NewMicroservice()
+			ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+			cacher := NewCacher(srv.Addr().String(), ms)
+			defer cacher.Close()
+
+			scanned := []string{}
+			rounds := 0
+			err := cacher.Scan("citizen:*", tt.count, func(keys []string) error {
+				scanned = append(scanned, keys...)
+				if rounds == tt.stopAt {
+					return errStop
+				}
+				rounds++
+				return nil
+			})
+			if err != tt.wantErr {
+				t.Fatalf("Scan() error = %v, want %v", err, tt.wantErr)
+			}
+			sort.Strings(scanned)
+			if len(scanned) != tt.wantKeys || scanned[0] != "citizen:00" || scanned[len(scanned)-1] != keys[tt.wantKeys-1] {
+				t.Errorf("scanned = %v, want %d keys", scanned, tt.wantKeys)
+			}
+			// The empty page (other:*) is not sent to fn, but the next cursor is followed
+			if got := fmt.Sprint(cursors()); got != tt.wantCursors {
+				t.Errorf("cursors = %s, want %s", got, tt.wantCursors)
+			}
+		})
+	}
+}
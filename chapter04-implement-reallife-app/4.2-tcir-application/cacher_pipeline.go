@@ -0,0 +1,391 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ICachePipeline queue commands, they are sent to Redis in one round trip after the function of Pipelined has returned
+// The values are encoded in JSON as Set, the result of each commands can be read from CacheCmd after Pipelined has returned
+type ICachePipeline interface {
+	Get(key string) *CacheCmd
+	Set(key string, value interface{}, expire time.Duration) *CacheCmd
+	SetS(key string, value string, expire time.Duration) *CacheCmd
+	Del(keys ...string) *CacheCmd
+	Exists(keys ...string) *CacheCmd
+	Expire(key string, expire time.Duration) *CacheCmd
+	TTL(key string) *CacheCmd
+	IncrBy(key string, incr int64) *CacheCmd
+
+	HSet(key string, fields map[string]interface{}, expire time.Duration) *CacheCmd
+	HGet(key string, field string) *CacheCmd
+	HGetAll(key string) *CacheCmd
+	HIncrBy(key string, field string, incr int64) *CacheCmd
+	HDel(key string, fields ...string) *CacheCmd
+
+	LPush(key string, values ...interface{}) *CacheCmd
+	RPush(key string, values ...interface{}) *CacheCmd
+	LRange(key string, start int64, stop int64) *CacheCmd
+	LTrim(key string, start int64, stop int64) *CacheCmd
+
+	SAdd(key string, members ...interface{}) *CacheCmd
+	SRem(key string, members ...interface{}) *CacheCmd
+	SMembers(key string) *CacheCmd
+
+	ZAdd(key string, members ...CacheZ) *CacheCmd
+	ZIncrBy(key string, incr float64, member interface{}) *CacheCmd
+	ZRem(key string, members ...interface{}) *CacheCmd
+	ZRemRangeByScore(key string, min string, max string) *CacheCmd
+	ZCard(key string) *CacheCmd
+	ZRevRange(key string, start int64, stop int64) *CacheCmd
+}
+
+// CacheCmd is the queued command of pipeline, its result is available after Pipelined has returned
+type CacheCmd struct {
+	cmd redis.Cmder
+	err error
+}
+
+// Err return error of command, the key that does not exist is not error
+func (cmd *CacheCmd) Err() error {
+	if cmd.err != nil {
+		return cmd.err
+	}
+	err := cmd.cmd.Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+func (cmd *CacheCmd) typeError(kind string) error {
+	return fmt.Errorf("Command %s does not return %s", cmd.cmd.Name(), kind)
+}
+
+// Text return the string result (such as Get), it is empty string if key does not exist
+func (cmd *CacheCmd) Text() (string, error) {
+	err := cmd.Err()
+	if err != nil {
+		return "", err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.StringCmd:
+		return c.Val(), nil
+	case *redis.StatusCmd:
+		return c.Val(), nil
+	}
+	return "", cmd.typeError("string")
+}
+
+// Int64 return the integer result (such as IncrBy, Del, Exists)
+func (cmd *CacheCmd) Int64() (int64, error) {
+	err := cmd.Err()
+	if err != nil {
+		return 0, err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.IntCmd:
+		return c.Val(), nil
+	case *redis.StringCmd:
+		if c.Err() == redis.Nil {
+			return 0, nil
+		}
+		return c.Int64()
+	}
+	return 0, cmd.typeError("integer")
+}
+
+// Float64 return the float result (such as ZIncrBy)
+func (cmd *CacheCmd) Float64() (float64, error) {
+	err := cmd.Err()
+	if err != nil {
+		return 0, err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.FloatCmd:
+		return c.Val(), nil
+	case *redis.IntCmd:
+		return float64(c.Val()), nil
+	}
+	return 0, cmd.typeError("float")
+}
+
+// Bool return the boolean result (such as Expire)
+func (cmd *CacheCmd) Bool() (bool, error) {
+	err := cmd.Err()
+	if err != nil {
+		return false, err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.BoolCmd:
+		return c.Val(), nil
+	}
+	return false, cmd.typeError("boolean")
+}
+
+// Duration return the duration result (such as TTL)
+func (cmd *CacheCmd) Duration() (time.Duration, error) {
+	err := cmd.Err()
+	if err != nil {
+		return 0, err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.DurationCmd:
+		return c.Val(), nil
+	}
+	return 0, cmd.typeError("duration")
+}
+
+// Strings return the list result (such as LRange, SMembers)
+func (cmd *CacheCmd) Strings() ([]string, error) {
+	err := cmd.Err()
+	if err != nil {
+		return nil, err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.StringSliceCmd:
+		return c.Val(), nil
+	}
+	return nil, cmd.typeError("list")
+}
+
+// StringMap return the hash result (such as HGetAll)
+func (cmd *CacheCmd) StringMap() (map[string]string, error) {
+	err := cmd.Err()
+	if err != nil {
+		return nil, err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.StringStringMapCmd:
+		return c.Val(), nil
+	}
+	return nil, cmd.typeError("hash")
+}
+
+// Zs return the members of sorted set with scores (such as ZRevRange)
+func (cmd *CacheCmd) Zs() ([]CacheZ, error) {
+	err := cmd.Err()
+	if err != nil {
+		return nil, err
+	}
+	switch c := cmd.cmd.(type) {
+	case *redis.ZSliceCmd:
+		return cacheZs(c.Val()), nil
+	}
+	return nil, cmd.typeError("sorted set")
+}
+
+// cachePipeline implement ICachePipeline with go-redis pipeline
+type cachePipeline struct {
+	pipe redis.Pipeliner
+	// err is the first error of encoding, the pipeline is not sent if it is set
+	err error
+}
+
+// failed return command with encoding error
+func (p *cachePipeline) failed(err error) *CacheCmd {
+	if p.err == nil {
+		p.err = err
+	}
+	return &CacheCmd{cmd: redis.NewCmd("encode"), err: err}
+}
+
+func (p *cachePipeline) Get(key string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.Get(key)}
+}
+
+func (p *cachePipeline) Set(key string, value interface{}, expire time.Duration) *CacheCmd {
+	str, err := encodeValue(value)
+	if err != nil {
+		return p.failed(err)
+	}
+	return &CacheCmd{cmd: p.pipe.Set(key, str, expire)}
+}
+
+func (p *cachePipeline) SetS(key string, value string, expire time.Duration) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.Set(key, value, expire)}
+}
+
+func (p *cachePipeline) Del(keys ...string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.Del(keys...)}
+}
+
+func (p *cachePipeline) Exists(keys ...string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.Exists(keys...)}
+}
+
+func (p *cachePipeline) Expire(key string, expire time.Duration) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.Expire(key, expire)}
+}
+
+func (p *cachePipeline) TTL(key string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.TTL(key)}
+}
+
+func (p *cachePipeline) IncrBy(key string, incr int64) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.IncrBy(key, incr)}
+}
+
+func (p *cachePipeline) HSet(key string, fields map[string]interface{}, expire time.Duration) *CacheCmd {
+	values := make(map[string]interface{}, len(fields))
+	for field, value := range fields {
+		str, err := encodeValue(value)
+		if err != nil {
+			return p.failed(err)
+		}
+		values[field] = str
+	}
+	cmd := p.pipe.HMSet(key, values)
+	if expire > 0 {
+		p.pipe.Expire(key, expire)
+	}
+	return &CacheCmd{cmd: cmd}
+}
+
+func (p *cachePipeline) HGet(key string, field string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.HGet(key, field)}
+}
+
+func (p *cachePipeline) HGetAll(key string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.HGetAll(key)}
+}
+
+func (p *cachePipeline) HIncrBy(key string, field string, incr int64) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.HIncrBy(key, field, incr)}
+}
+
+func (p *cachePipeline) HDel(key string, fields ...string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.HDel(key, fields...)}
+}
+
+func (p *cachePipeline) LPush(key string, values ...interface{}) *CacheCmd {
+	encoded, err := encodeValues(values)
+	if err != nil {
+		return p.failed(err)
+	}
+	return &CacheCmd{cmd: p.pipe.LPush(key, encoded...)}
+}
+
+func (p *cachePipeline) RPush(key string, values ...interface{}) *CacheCmd {
+	encoded, err := encodeValues(values)
+	if err != nil {
+		return p.failed(err)
+	}
+	return &CacheCmd{cmd: p.pipe.RPush(key, encoded...)}
+}
+
+func (p *cachePipeline) LRange(key string, start int64, stop int64) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.LRange(key, start, stop)}
+}
+
+func (p *cachePipeline) LTrim(key string, start int64, stop int64) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.LTrim(key, start, stop)}
+}
+
+func (p *cachePipeline) SAdd(key string, members ...interface{}) *CacheCmd {
+	encoded, err := encodeValues(members)
+	if err != nil {
+		return p.failed(err)
+	}
+	return &CacheCmd{cmd: p.pipe.SAdd(key, encoded...)}
+}
+
+func (p *cachePipeline) SRem(key string, members ...interface{}) *CacheCmd {
+	encoded, err := encodeValues(members)
+	if err != nil {
+		return p.failed(err)
+	}
+	return &CacheCmd{cmd: p.pipe.SRem(key, encoded...)}
+}
+
+func (p *cachePipeline) SMembers(key string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.SMembers(key)}
+}
+
+func (p *cachePipeline) ZAdd(key string, members ...CacheZ) *CacheCmd {
+	zs := make([]redis.Z, 0, len(members))
+	for _, member := range members {
+		encoded, err := encodeValue(member.Member)
+		if err != nil {
+			return p.failed(err)
+		}
+		zs = append(zs, redis.Z{Member: encoded, Score: member.Score})
+	}
+	return &CacheCmd{cmd: p.pipe.ZAdd(key, zs...)}
+}
+
+func (p *cachePipeline) ZIncrBy(key string, incr float64, member interface{}) *CacheCmd {
+	encoded, err := encodeValue(member)
+	if err != nil {
+		return p.failed(err)
+	}
+	return &CacheCmd{cmd: p.pipe.ZIncrBy(key, incr, encoded)}
+}
+
+func (p *cachePipeline) ZRem(key string, members ...interface{}) *CacheCmd {
+	encoded, err := encodeValues(members)
+	if err != nil {
+		return p.failed(err)
+	}
+	return &CacheCmd{cmd: p.pipe.ZRem(key, encoded...)}
+}
+
+func (p *cachePipeline) ZRemRangeByScore(key string, min string, max string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.ZRemRangeByScore(key, min, max)}
+}
+
+func (p *cachePipeline) ZCard(key string) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.ZCard(key)}
+}
+
+func (p *cachePipeline) ZRevRange(key string, start int64, stop int64) *CacheCmd {
+	return &CacheCmd{cmd: p.pipe.ZRevRangeWithScores(key, start, stop)}
+}
+
+// Pipelined send the commands that fn queue in one round trip, the commands of the other clients can run between them
+// It return error of fn, the first encoding error, or the first error of commands (except the key that does not exist)
+func (cache *Cacher) Pipelined(fn func(pipe ICachePipeline) error) error {
+	return cache.pipelined(fn, false)
+}
+
+// TxPipelined send the commands that fn queue in MULTI/EXEC, so they run together without the commands of the other clients
+// (such as INCR and EXPIRE of rate limiter)
+func (cache *Cacher) TxPipelined(fn func(pipe ICachePipeline) error) error {
+	return cache.pipelined(fn, true)
+}
+
+func (cache *Cacher) pipelined(fn func(pipe ICachePipeline) error, tx bool) error {
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	// 1. Queue the commands, nothing is sent if fn or encoding has failed
+	p := &cachePipeline{pipe: c.Pipeline()}
+	if tx {
+		p.pipe = c.TxPipeline()
+	}
+	defer p.pipe.Close()
+	err = fn(p)
+	if err != nil {
+		return err
+	}
+	if p.err != nil {
+		return p.err
+	}
+
+	// 2. Send every commands, the key that does not exist is not error
+	cmds, err := p.pipe.Exec()
+	if err != nil && err != redis.Nil && len(cmds) == 0 {
+		return err
+	}
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			return cmd.Err()
+		}
+	}
+	return nil
+}
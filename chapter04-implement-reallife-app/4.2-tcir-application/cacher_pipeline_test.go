@@ -0,0 +1,119 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheCmd(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   func(pipe ICachePipeline) *CacheCmd
+		result  func(cmd *CacheCmd) (interface{}, error)
+		want    interface{}
+		wantErr bool
+	}{
+		{"Get text", func(pipe ICachePipeline) *CacheCmd { return pipe.Get("text") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Text() }, `"a"`, false},
+		{"Get text of key does not exist", func(pipe ICachePipeline) *CacheCmd { return pipe.Get("unknown") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Text() }, "", false},
+		{"Set status", func(pipe ICachePipeline) *CacheCmd { return pipe.Set("new", 1, 0) },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Text() }, "OK", false},
+		{"IncrBy integer", func(pipe ICachePipeline) *CacheCmd { return pipe.IncrBy("count", 2) },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Int64() }, int64(7), false},
+		{"Get integer", func(pipe ICachePipeline) *CacheCmd { return pipe.Get("count") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Int64() }, int64(5), false},
+		{"Get integer of key does not exist", func(pipe ICachePipeline) *CacheCmd { return pipe.Get("unknown") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Int64() }, int64(0), false},
+		{"Get integer of text", func(pipe ICachePipeline) *CacheCmd { return pipe.Get("text") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Int64() }, int64(0), true},
+		{"ZIncrBy float", func(pipe ICachePipeline) *CacheCmd { return pipe.ZIncrBy("ranking", 1.5, "a") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Float64() }, 1.5, false},
+		{"ZCard float", func(pipe ICachePipeline) *CacheCmd { return pipe.ZCard("unknown") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Float64() }, float64(0), false},
+		{"Expire bool", func(pipe ICachePipeline) *CacheCmd { return pipe.Expire("text", time.Minute) },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Bool() }, true, false},
+		{"Expire bool of key does not exist", func(pipe ICachePipeline) *CacheCmd { return pipe.Expire("unknown", time.Minute) },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Bool() }, false, false},
+		{"TTL duration", func(pipe ICachePipeline) *CacheCmd { return pipe.TTL("expire") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Duration() }, time.Hour, false},
+		{"Text of integer", func(pipe ICachePipeline) *CacheCmd { return pipe.IncrBy("count", 1) },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Text() }, "", true},
+		{"Int64 of duration", func(pipe ICachePipeline) *CacheCmd { return pipe.TTL("expire") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Int64() }, int64(0), true},
+		{"Float64 of text", func(pipe ICachePipeline) *CacheCmd { return pipe.Get("text") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Float64() }, float64(0), true},
+		{"Bool of text", func(pipe ICachePipeline) *CacheCmd { return pipe.Get("text") },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Bool() }, false, true},
+		{"Duration of bool", func(pipe ICachePipeline) *CacheCmd { return pipe.Expire("text", time.Minute) },
+			func(cmd *CacheCmd) (interface{}, error) { return cmd.Duration() }, time.Duration(0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacher, mr := newTestCacher(t)
+			defer mr.Close()
+			defer cacher.Close()
+			mr.Set("text", `"a"`)
+			mr.Set("count", "5")
+			mr.Set("expire", "1")
+			mr.SetTTL("expire", time.Hour)
+
+			var cmd *CacheCmd
+			err := cacher.Pipelined(func(pipe ICachePipeline) error {
+				cmd = tt.queue(pipe)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.result(cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("result error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("result = %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelinedEncodeError(t *testing.T) {
+	tests := []struct {
+		name      string
+		pipelined func(cacher *Cacher, fn func(pipe ICachePipeline) error) error
+	}{
+		{"Pipelined", (*Cacher).Pipelined},
+		{"TxPipelined", (*Cacher).TxPipelined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacher, mr := newTestCacher(t)
+			defer mr.Close()
+			defer cacher.Close()
+
+			var before, failed, after *CacheCmd
+			err := tt.pipelined(cacher, func(pipe ICachePipeline) error {
+				before = pipe.Set("before", 1, 0)
+				failed = pipe.HSet("failed", map[string]interface{}{"ch": make(chan int)}, time.Minute)
+				after = pipe.IncrBy("after", 1)
+				return nil
+			})
+			if err == nil || failed.Err() != err {
+				t.Errorf("error = %v, want the encoding error %v", err, failed.Err())
+			}
+			// Nothing is sent, so the commands that have been queued have no results
+			if keys := mr.Keys(); len(keys) != 0 {
+				t.Errorf("keys = %v, want nothing has been sent", keys)
+			}
+			if text, _ := before.Text(); text != "" {
+				t.Errorf("result of the command before = %s, want nothing", text)
+			}
+			if n, _ := after.Int64(); n != 0 {
+				t.Errorf("result of the command after = %d, want nothing", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// CacheZ is member of sorted set with score, Member is encoded in JSON as Set when it is added,
+// and it is the JSON string when it is read
+type CacheZ struct {
+	Member interface{} `json:"member"`
+	Score  float64     `json:"score"`
+}
+
+// cacheZs convert members of sorted set from Redis
+func cacheZs(zs []redis.Z) []CacheZ {
+	members := make([]CacheZ, 0, len(zs))
+	for _, z := range zs {
+		members = append(members, CacheZ{Member: z.Member, Score: z.Score})
+	}
+	return members
+}
+
+// HDel delete fields of hash, and return the number of fields that have been deleted
+func (cache *Cacher) HDel(key string, fields ...string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.HDel(key, fields...).Result()
+}
+
+// HExists return true if field of hash exists
+func (cache *Cacher) HExists(key string, field string) (bool, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	return c.HExists(key, field).Result()
+}
+
+// HKeys return every fields of hash
+func (cache *Cacher) HKeys(key string) ([]string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.HKeys(key).Result()
+}
+
+// HLen return the number of fields of hash
+func (cache *Cacher) HLen(key string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.HLen(key).Result()
+}
+
+// LPush insert objects at the head of list, and return the length of list
+func (cache *Cacher) LPush(key string, values ...interface{}) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := encodeValues(values)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.LPush(key, encoded...).Result()
+}
+
+// RPush insert objects at the tail of list, and return the length of list
+func (cache *Cacher) RPush(key string, values ...interface{}) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := encodeValues(values)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.RPush(key, encoded...).Result()
+}
+
+// LPop remove and return the first object of list, it return empty string if list is empty
+func (cache *Cacher) LPop(key string) (string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	val, err := c.LPop(key).Result()
+	if err == redis.Nil {
+		// List is empty
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return val, nil
+}
+
+// RPop remove and return the last object of list, it return empty string if list is empty
+func (cache *Cacher) RPop(key string) (string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	val, err := c.RPop(key).Result()
+	if err == redis.Nil {
+		// List is empty
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return val, nil
+}
+
+// LRange return objects of list from start to stop (inclusive), the negative index is from the tail (-1 is the last)
+func (cache *Cacher) LRange(key string, start int64, stop int64) ([]string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.LRange(key, start, stop).Result()
+}
+
+// LLen return the length of list
+func (cache *Cacher) LLen(key string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.LLen(key).Result()
+}
+
+// LTrim keep only objects of list from start to stop (inclusive), such as LTrim(key, 0, 99) keep the first 100
+func (cache *Cacher) LTrim(key string, start int64, stop int64) error {
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	return c.LTrim(key, start, stop).Err()
+}
+
+// SAdd add objects to set, and return the number of objects that have not been in set
+func (cache *Cacher) SAdd(key string, members ...interface{}) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := encodeValues(members)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.SAdd(key, encoded...).Result()
+}
+
+// SRem remove objects from set, and return the number of objects that have been removed
+func (cache *Cacher) SRem(key string, members ...interface{}) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := encodeValues(members)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.SRem(key, encoded...).Result()
+}
+
+// SMembers return every objects of set
+func (cache *Cacher) SMembers(key string) ([]string, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SMembers(key).Result()
+}
+
+// SIsMember return true if object is in set
+func (cache *Cacher) SIsMember(key string, member interface{}) (bool, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	encoded, err := encodeValue(member)
+	if err != nil {
+		return false, err
+	}
+
+	return c.SIsMember(key, encoded).Result()
+}
+
+// SCard return the number of objects in set
+func (cache *Cacher) SCard(key string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.SCard(key).Result()
+}
+
+// ZAdd add members to sorted set (or update score of the existing members),
+// and return the number of members that have not been in sorted set
+func (cache *Cacher) ZAdd(key string, members ...CacheZ) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	zs := make([]redis.Z, 0, len(members))
+	for _, member := range members {
+		encoded, err := encodeValue(member.Member)
+		if err != nil {
+			return 0, err
+		}
+		zs = append(zs, redis.Z{Member: encoded, Score: member.Score})
+	}
+
+	return c.ZAdd(key, zs...).Result()
+}
+
+// ZIncrBy increase score of member by incr (the member that is not in sorted set is 0), and return the new score
+func (cache *Cacher) ZIncrBy(key string, incr float64, member interface{}) (float64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := encodeValue(member)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.ZIncrBy(key, incr, encoded).Result()
+}
+
+// ZRem remove members from sorted set, and return the number of members that have been removed
+func (cache *Cacher) ZRem(key string, members ...interface{}) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := encodeValues(members)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.ZRem(key, encoded...).Result()
+}
+
+// ZRemRangeByScore remove members with score between min and max, such as "-inf" and "(100" (exclusive)
+func (cache *Cacher) ZRemRangeByScore(key string, min string, max string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.ZRemRangeByScore(key, min, max).Result()
+}
+
+// ZScore return score of member, it return false if member is not in sorted set
+func (cache *Cacher) ZScore(key string, member interface{}) (float64, bool, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, false, err
+	}
+
+	encoded, err := encodeValue(member)
+	if err != nil {
+		return 0, false, err
+	}
+
+	score, err := c.ZScore(key, encoded).Result()
+	if err == redis.Nil {
+		// Member does not exists
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	return score, true, nil
+}
+
+// ZRank return rank of member (0 is the lowest score), it is -1 if member is not in sorted set
+func (cache *Cacher) ZRank(key string, member interface{}) (int64, error) {
+	return cache.zRank(key, member, false)
+}
+
+// ZRevRank return rank of member (0 is the highest score), it is -1 if member is not in sorted set
+func (cache *Cacher) ZRevRank(key string, member interface{}) (int64, error) {
+	return cache.zRank(key, member, true)
+}
+
+func (cache *Cacher) zRank(key string, member interface{}, rev bool) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := encodeValue(member)
+	if err != nil {
+		return 0, err
+	}
+
+	var cmd *redis.IntCmd
+	if rev {
+		cmd = c.ZRevRank(key, encoded)
+	} else {
+		cmd = c.ZRank(key, encoded)
+	}
+	rank, err := cmd.Result()
+	if err == redis.Nil {
+		// Member does not exists
+		return -1, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return rank, nil
+}
+
+// ZRange return members from start to stop (inclusive) by score from the lowest
+func (cache *Cacher) ZRange(key string, start int64, stop int64) ([]CacheZ, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	zs, err := c.ZRangeWithScores(key, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheZs(zs), nil
+}
+
+// ZRevRange return members from start to stop (inclusive) by score from the highest, such as the top 10 is 0 to 9
+func (cache *Cacher) ZRevRange(key string, start int64, stop int64) ([]CacheZ, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	zs, err := c.ZRevRangeWithScores(key, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheZs(zs), nil
+}
+
+// ZRangeByScore return members with score between min and max (such as "-inf", "(100"),
+// skip offset members and return at most count members (0 is every members)
+func (cache *Cacher) ZRangeByScore(key string, min string, max string, offset int64, count int64) ([]CacheZ, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	opt := redis.ZRangeBy{Min: min, Max: max}
+	if count > 0 {
+		opt.Offset = offset
+		opt.Count = count
+	}
+	zs, err := c.ZRangeByScoreWithScores(key, opt).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheZs(zs), nil
+}
+
+// ZCard return the number of members in sorted set
+func (cache *Cacher) ZCard(key string) (int64, error) {
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.ZCard(key).Result()
+}
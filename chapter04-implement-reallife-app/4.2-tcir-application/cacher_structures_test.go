@@ -0,0 +1,52 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"testing"
+)
+
+func TestCacherZScore(t *testing.T) {
+	cacher, mr := newTestCacher(t)
+	defer mr.Close()
+	defer cacher.Close()
+
+	_, err := cacher.ZAdd("ranking",
+		CacheZ{Member: map[string]string{"id": "1"}, Score: 2.5},
+		CacheZ{Member: "zero", Score: 0},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		member     interface{}
+		wantScore  float64
+		wantExists bool
+	}{
+		{"member", "ranking", map[string]string{"id": "1"}, 2.5, true},
+		{"member with score 0", "ranking", "zero", 0, true},
+		{"member is not in sorted set", "ranking", "unknown", 0, false},
+		{"member is the JSON of member", "ranking", `"zero"`, 0, false},
+		{"sorted set does not exist", "unknown", "zero", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, exists, err := cacher.ZScore(tt.key, tt.member)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if score != tt.wantScore || exists != tt.wantExists {
+				t.Errorf("ZScore() = %v %v, want %v %v", score, exists, tt.wantScore, tt.wantExists)
+			}
+		})
+	}
+
+	// The member that cannot be encoded is error
+	_, _, err = cacher.ZScore("ranking", make(chan int))
+	if err == nil {
+		t.Errorf("ZScore() of channel has no error")
+	}
+}
@@ -0,0 +1,284 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hamba/avro"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// headerContentType is the message header that tell consumer which codec has encoded the message
+const headerContentType = "content-type"
+
+// ICodec is interface to encode and decode message
+type ICodec interface {
+	// Name is sent in content-type header, so the consumer can select the same codec to decode message
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// ISchemaCodec is the codec that message has schema, the schema is registered in schema registry
+// and it is checked for compatibility when producer send the message
+type ISchemaCodec interface {
+	ICodec
+	// Schema return schema of v
+	Schema(v interface{}) (string, error)
+	// CheckCompatibility return error if message encoded with oldSchema cannot be read with newSchema
+	CheckCompatibility(newSchema string, oldSchema string) error
+}
+
+// JSONCodec implement ICodec with encoding/json
+type JSONCodec struct{}
+
+// NewJSONCodec return new JSONCodec
+func NewJSONCodec() *JSONCodec {
+	return &JSONCodec{}
+}
+
+// Name return content type of JSON
+func (c *JSONCodec) Name() string {
+	return "application/json"
+}
+
+// Marshal encode v into JSON
+func (c *JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decode JSON into v
+func (c *JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec implement ISchemaCodec with protocol buffers, value must be proto.Message
+type ProtobufCodec struct{}
+
+// NewProtobufCodec return new ProtobufCodec
+func NewProtobufCodec() *ProtobufCodec {
+	return &ProtobufCodec{}
+}
+
+// Name return content type of protobuf
+func (c *ProtobufCodec) Name() string {
+	return "application/x-protobuf"
+}
+
+// Marshal encode v (proto.Message) into protobuf
+func (c *ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("ProtobufCodec cannot marshal %T, it is not proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal decode protobuf into v (proto.Message)
+func (c *ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("ProtobufCodec cannot unmarshal into %T, it is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// protobufField is the field in protobuf schema
+type protobufField struct {
+	Number      int32  `json:"number"`
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Cardinality string `json:"cardinality"`
+}
+
+// protobufSchema is the schema of protobuf message, it is created from message descriptor
+type protobufSchema struct {
+	Name   string          `json:"name"`
+	Fields []protobufField `json:"fields"`
+}
+
+// Schema return schema of v (proto.Message) as JSON of its fields
+func (c *ProtobufCodec) Schema(v interface{}) (string, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return "", fmt.Errorf("ProtobufCodec cannot read schema of %T, it is not proto.Message", v)
+	}
+	desc := m.ProtoReflect().Descriptor()
+	schema := protobufSchema{
+		Name:   string(desc.FullName()),
+		Fields: []protobufField{},
+	}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		schema.Fields = append(schema.Fields, protobufField{
+			Number:      int32(f.Number()),
+			Name:        string(f.Name()),
+			Kind:        protobufKind(f),
+			Cardinality: f.Cardinality().String(),
+		})
+	}
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return string(schemaJSON), nil
+}
+
+func protobufKind(f protoreflect.FieldDescriptor) string {
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return f.Kind().String() + ":" + string(f.Message().FullName())
+	case protoreflect.EnumKind:
+		return f.Kind().String() + ":" + string(f.Enum().FullName())
+	}
+	return f.Kind().String()
+}
+
+// CheckCompatibility check that every field number that exists in both schema has the same kind and cardinality
+// (fields can be added, removed and renamed, but field number cannot be reused with different type)
+func (c *ProtobufCodec) CheckCompatibility(newSchema string, oldSchema string) error {
+	newS := protobufSchema{}
+	err := json.Unmarshal([]byte(newSchema), &newS)
+	if err != nil {
+		return err
+	}
+	oldS := protobufSchema{}
+	err = json.Unmarshal([]byte(oldSchema), &oldS)
+	if err != nil {
+		return err
+	}
+	if newS.Name != oldS.Name {
+		return fmt.Errorf("Message name has changed from %s to %s", oldS.Name, newS.Name)
+	}
+
+	oldFields := map[int32]protobufField{}
+	for _, f := range oldS.Fields {
+		oldFields[f.Number] = f
+	}
+	for _, f := range newS.Fields {
+		oldF, ok := oldFields[f.Number]
+		if !ok {
+			continue
+		}
+		if oldF.Kind != f.Kind || oldF.Cardinality != f.Cardinality {
+			return fmt.Errorf("Field number %d has changed from %s %s to %s %s",
+				f.Number, oldF.Cardinality, oldF.Kind, f.Cardinality, f.Kind)
+		}
+	}
+	return nil
+}
+
+// AvroCodec implement ISchemaCodec with Apache Avro, value is struct with `avro` tags
+type AvroCodec struct {
+	schema avro.Schema
+}
+
+// NewAvroCodec return new AvroCodec for the schema
+func NewAvroCodec(schema string) (*AvroCodec, error) {
+	s, err := avro.Parse(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroCodec{
+		schema: s,
+	}, nil
+}
+
+// Name return content type of avro with the schema name, so each avro schema has its own codec
+func (c *AvroCodec) Name() string {
+	named, ok := c.schema.(avro.NamedSchema)
+	if !ok {
+		return "application/avro"
+	}
+	return "application/avro; schema=" + named.FullName()
+}
+
+// Marshal encode v into avro binary
+func (c *AvroCodec) Marshal(v interface{}) ([]byte, error) {
+	return avro.Marshal(c.schema, v)
+}
+
+// Unmarshal decode avro binary into v
+func (c *AvroCodec) Unmarshal(data []byte, v interface{}) error {
+	return avro.Unmarshal(c.schema, data, v)
+}
+
+// Schema return the avro schema of this codec
+func (c *AvroCodec) Schema(v interface{}) (string, error) {
+	return c.schema.String(), nil
+}
+
+// CheckCompatibility check that newSchema (reader) can read the message that written with oldSchema (writer)
+func (c *AvroCodec) CheckCompatibility(newSchema string, oldSchema string) error {
+	// Parse with its own cache, so the old version will not replace the named schema in the default cache
+	reader, err := avro.ParseWithCache(newSchema, "", &avro.SchemaCache{})
+	if err != nil {
+		return err
+	}
+	writer, err := avro.ParseWithCache(oldSchema, "", &avro.SchemaCache{})
+	if err != nil {
+		return err
+	}
+	return avro.NewSchemaCompatibility().Compatible(reader, writer)
+}
+
+// decodeInputs decode each input into new element and append into v (pointer to slice)
+func decodeInputs(codecs []ICodec, inputs [][]byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("BindInputs need pointer to slice, but got %T", v)
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	for i, input := range inputs {
+		elem := reflect.New(elemType)
+		err := codecs[i].Unmarshal(input, elem.Interface())
+		if err != nil {
+			return err
+		}
+		if isPtr {
+			slice = reflect.Append(slice, elem)
+		} else {
+			slice = reflect.Append(slice, elem.Elem())
+		}
+	}
+	rv.Elem().Set(slice)
+	return nil
+}
+
+// RegisterCodec register codec for decoding the message that has content-type header equal codec.Name()
+func (ms *Microservice) RegisterCodec(codec ICodec) {
+	ms.codecMutex.Lock()
+	defer ms.codecMutex.Unlock()
+	if ms.codecs == nil {
+		ms.codecs = map[string]ICodec{}
+	}
+	ms.codecs[codec.Name()] = codec
+}
+
+// getCodec return codec by content type, JSONCodec is the default codec
+func (ms *Microservice) getCodec(contentType string) ICodec {
+	ms.codecMutex.Lock()
+	defer ms.codecMutex.Unlock()
+	codec, ok := ms.codecs[contentType]
+	if ok {
+		return codec
+	}
+	// Content type may have parameters such as application/json; charset=UTF-8
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	codec, ok = ms.codecs[mediaType]
+	if ok {
+		return codec
+	}
+	return NewJSONCodec()
+}
@@ -0,0 +1,195 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jsonSchema is the subset of JSON schema (type, properties, required, items) that is created from Go type
+type jsonSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+}
+
+// JSONSchemaCodec implement ISchemaCodec with encoding/json, the schema is JSON schema of the message type
+// (struct fields with `json` tags), so JSON subjects are checked for compatibility like avro and protobuf
+// Message of map has no fixed properties, its schema is only "object"
+type JSONSchemaCodec struct {
+	JSONCodec
+}
+
+// NewJSONSchemaCodec return new JSONSchemaCodec
+func NewJSONSchemaCodec() *JSONSchemaCodec {
+	return &JSONSchemaCodec{}
+}
+
+// Name return content type of JSON with schema parameter, consumer decode it with JSON codec
+func (c *JSONSchemaCodec) Name() string {
+	return "application/json; schema=json-schema"
+}
+
+// Schema return JSON schema of type of v
+func (c *JSONSchemaCodec) Schema(v interface{}) (string, error) {
+	if v == nil {
+		return "", fmt.Errorf("JSONSchemaCodec cannot read schema of nil")
+	}
+	schema := jsonSchemaOf(reflect.TypeOf(v), map[reflect.Type]bool{})
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return string(schemaJSON), nil
+}
+
+// CheckCompatibility check that newSchema (reader) can read the message that written with oldSchema (writer),
+// properties can be removed and optional properties can be added, but the property cannot change its type
+// and the new required property is not allowed (the old messages do not have it)
+func (c *JSONSchemaCodec) CheckCompatibility(newSchema string, oldSchema string) error {
+	newS := &jsonSchema{}
+	err := json.Unmarshal([]byte(newSchema), newS)
+	if err != nil {
+		return err
+	}
+	oldS := &jsonSchema{}
+	err = json.Unmarshal([]byte(oldSchema), oldS)
+	if err != nil {
+		return err
+	}
+	return checkJSONSchema("$", newS, oldS)
+}
+
+func checkJSONSchema(path string, reader *jsonSchema, writer *jsonSchema) error {
+	if reader == nil || writer == nil || len(reader.Type) == 0 {
+		// Reader accept any value
+		return nil
+	}
+	if reader.Type != writer.Type && !(reader.Type == "number" && writer.Type == "integer") {
+		return fmt.Errorf("%s has changed from %s to %s", path, writer.Type, reader.Type)
+	}
+
+	for _, name := range reader.Required {
+		_, ok := writer.Properties[name]
+		if !ok {
+			return fmt.Errorf("%s.%s is required, but it does not exist in the old schema", path, name)
+		}
+	}
+	for name, prop := range reader.Properties {
+		err := checkJSONSchema(path+"."+name, prop, writer.Properties[name])
+		if err != nil {
+			return err
+		}
+	}
+	err := checkJSONSchema(path+"[]", reader.Items, writer.Items)
+	if err != nil {
+		return err
+	}
+	return checkJSONSchema(path+"{}", reader.AdditionalProperties, writer.AdditionalProperties)
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// jsonSchemaOf return JSON schema of t as encoding/json encode it, visiting is used to stop at the recursive type
+func jsonSchemaOf(t reflect.Type, visiting map[reflect.Type]bool) *jsonSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		// Custom JSON can be anything
+		return &jsonSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded in base64
+			return &jsonSchema{Type: "string", Format: "byte"}
+		}
+		return &jsonSchema{Type: "array", Items: jsonSchemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: jsonSchemaOf(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return &jsonSchema{Type: "object", Title: t.Name()}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &jsonSchema{Type: "object", Title: t.Name(), Properties: map[string]*jsonSchema{}}
+		addJSONProperties(schema, t, visiting)
+		sort.Strings(schema.Required)
+		return schema
+	}
+	// Interface (and the other kinds) can be any value
+	return &jsonSchema{}
+}
+
+// addJSONProperties add exported fields of struct t into schema, fields of embedded struct are promoted as encoding/json
+func addJSONProperties(schema *jsonSchema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+
+		if f.Anonymous && len(name) == 0 {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addJSONProperties(schema, ft, visiting)
+				continue
+			}
+		}
+		if len(f.PkgPath) > 0 {
+			// Unexported field
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		prop := jsonSchemaOf(f.Type, visiting)
+		optional := f.Type.Kind() == reflect.Ptr
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				optional = true
+			case "string":
+				prop = &jsonSchema{Type: "string"}
+			}
+		}
+		schema.Properties[name] = prop
+		if !optional {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
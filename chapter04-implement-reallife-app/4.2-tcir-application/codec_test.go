@@ -0,0 +1,293 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testCitizen struct {
+	CitizenID string    `json:"citizen_id" avro:"citizen_id"`
+	Name      string    `json:"name,omitempty" avro:"name"`
+	Age       int       `json:"age" avro:"age"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const testCitizenAvroSchema = `{
+	"type": "record",
+	"name": "Citizen",
+	"namespace": "tcir",
+	"fields": [
+		{"name": "citizen_id", "type": "string"},
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"}
+	]
+}`
+
+func TestCodecRoundTrip(t *testing.T) {
+	avroCodec, err := NewAvroCodec(testCitizenAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		codec ICodec
+		in    interface{}
+		out   interface{}
+	}{
+		{"json", NewJSONCodec(), &testCitizen{CitizenID: "1", Name: "A", Age: 30}, &testCitizen{}},
+		{"json with schema", NewJSONSchemaCodec(), &testCitizen{CitizenID: "1", Age: 30}, &testCitizen{}},
+		{"json map", NewJSONCodec(), &map[string]interface{}{"citizen_id": "1"}, &map[string]interface{}{}},
+		{"avro", avroCodec, &testCitizen{CitizenID: "1", Name: "A", Age: 30}, &testCitizen{}},
+		{"protobuf", NewProtobufCodec(), wrapperspb.String("citizen"), &wrapperspb.StringValue{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.codec.Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			err = tt.codec.Unmarshal(data, tt.out)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if m, ok := tt.in.(proto.Message); ok {
+				if !proto.Equal(m, tt.out.(proto.Message)) {
+					t.Errorf("Unmarshal() = %v, want %v", tt.out, tt.in)
+				}
+				return
+			}
+			if !reflect.DeepEqual(tt.in, tt.out) {
+				t.Errorf("Unmarshal() = %v, want %v", tt.out, tt.in)
+			}
+		})
+	}
+}
+
+func TestProtobufCodecNotProtoMessage(t *testing.T) {
+	codec := NewProtobufCodec()
+	_, err := codec.Marshal(&testCitizen{})
+	if err == nil {
+		t.Error("Marshal() error = nil, want error")
+	}
+	err = codec.Unmarshal([]byte{}, &testCitizen{})
+	if err == nil {
+		t.Error("Unmarshal() error = nil, want error")
+	}
+	_, err = codec.Schema(&testCitizen{})
+	if err == nil {
+		t.Error("Schema() error = nil, want error")
+	}
+}
+
+func TestJSONSchemaCodecSchema(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+	type node struct {
+		Next *node `json:"next"`
+	}
+	type embedded struct {
+		ID string `json:"id"`
+	}
+
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"string", "citizen", `{"type":"string"}`},
+		{"map", map[string]interface{}{"a": 1}, `{"type":"object","additionalProperties":{}}`},
+		{
+			name: "struct with optional fields",
+			in:   &testCitizen{},
+			want: `{"type":"object","title":"testCitizen","properties":{` +
+				`"age":{"type":"integer"},"citizen_id":{"type":"string"},` +
+				`"created_at":{"type":"string","format":"date-time"},"name":{"type":"string"}},` +
+				`"required":["age","citizen_id","created_at"]}`,
+		},
+		{
+			name: "nested struct and slice",
+			in: struct {
+				Addresses []address `json:"addresses"`
+				Tags      []byte    `json:"tags,omitempty"`
+				secret    string
+				Skipped   string `json:"-"`
+			}{},
+			want: `{"type":"object","properties":{"addresses":{"type":"array","items":` +
+				`{"type":"object","title":"address","properties":{"city":{"type":"string"}},"required":["city"]}},` +
+				`"tags":{"type":"string","format":"byte"}},"required":["addresses"]}`,
+		},
+		{
+			name: "recursive struct",
+			in:   node{},
+			want: `{"type":"object","title":"node","properties":{"next":{"type":"object","title":"node"}}}`,
+		},
+		{
+			name: "embedded struct",
+			in: struct {
+				embedded
+				Count int64 `json:"count,string"`
+			}{},
+			want: `{"type":"object","properties":{"count":{"type":"string"},"id":{"type":"string"}},"required":["count","id"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewJSONSchemaCodec().Schema(tt.in)
+			if err != nil {
+				t.Fatalf("Schema() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Schema() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	type citizenV2 struct {
+		CitizenID string  `json:"citizen_id"`
+		Age       float64 `json:"age"`
+		Email     string  `json:"email,omitempty"`
+	}
+	type citizenRequiredEmail struct {
+		CitizenID string `json:"citizen_id"`
+		Email     string `json:"email"`
+	}
+	type citizenStringAge struct {
+		CitizenID string `json:"citizen_id"`
+		Age       string `json:"age"`
+	}
+	jsonSchema := func(v interface{}) string {
+		schema, err := NewJSONSchemaCodec().Schema(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return schema
+	}
+
+	avroV2 := `{"type": "record", "name": "Citizen", "namespace": "tcir", "fields": [
+		{"name": "citizen_id", "type": "string"},
+		{"name": "age", "type": "long"},
+		{"name": "email", "type": "string", "default": ""}
+	]}`
+	avroRequiredEmail := `{"type": "record", "name": "Citizen", "namespace": "tcir", "fields": [
+		{"name": "citizen_id", "type": "string"},
+		{"name": "email", "type": "string"}
+	]}`
+	avroStringAge := `{"type": "record", "name": "Citizen", "namespace": "tcir", "fields": [
+		{"name": "citizen_id", "type": "string"},
+		{"name": "age", "type": "string"}
+	]}`
+
+	protoV1 := `{"name":"tcir.Citizen","fields":[{"number":1,"name":"citizen_id","kind":"string","cardinality":"optional"}]}`
+	protoV2 := `{"name":"tcir.Citizen","fields":[{"number":1,"name":"id","kind":"string","cardinality":"optional"},` +
+		`{"number":2,"name":"age","kind":"int32","cardinality":"optional"}]}`
+	protoChangedKind := `{"name":"tcir.Citizen","fields":[{"number":1,"name":"citizen_id","kind":"int64","cardinality":"optional"}]}`
+	protoChangedCardinality := `{"name":"tcir.Citizen","fields":[{"number":1,"name":"citizen_id","kind":"string","cardinality":"repeated"}]}`
+	protoRenamed := `{"name":"tcir.Person","fields":[]}`
+
+	avroCodec, err := NewAvroCodec(testCitizenAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		codec     ISchemaCodec
+		newSchema string
+		oldSchema string
+		wantErr   bool
+	}{
+		{"json same schema", NewJSONSchemaCodec(), jsonSchema(testCitizen{}), jsonSchema(testCitizen{}), false},
+		{"json remove field, add optional field, widen integer", NewJSONSchemaCodec(), jsonSchema(citizenV2{}), jsonSchema(testCitizen{}), false},
+		{"json add required field", NewJSONSchemaCodec(), jsonSchema(citizenRequiredEmail{}), jsonSchema(testCitizen{}), true},
+		{"json change field type", NewJSONSchemaCodec(), jsonSchema(citizenStringAge{}), jsonSchema(testCitizen{}), true},
+		{"json narrow number", NewJSONSchemaCodec(), jsonSchema(testCitizen{}), jsonSchema(citizenV2{}), true},
+		{"json map", NewJSONSchemaCodec(), jsonSchema(map[string]interface{}{}), jsonSchema(testCitizen{}), false},
+		{"avro same schema", avroCodec, testCitizenAvroSchema, testCitizenAvroSchema, false},
+		{"avro remove field, add field with default, promote int", avroCodec, avroV2, testCitizenAvroSchema, false},
+		{"avro add field without default", avroCodec, avroRequiredEmail, testCitizenAvroSchema, true},
+		{"avro change field type", avroCodec, avroStringAge, testCitizenAvroSchema, true},
+		{"protobuf add and rename field", NewProtobufCodec(), protoV2, protoV1, false},
+		{"protobuf change field kind", NewProtobufCodec(), protoChangedKind, protoV1, true},
+		{"protobuf change field cardinality", NewProtobufCodec(), protoChangedCardinality, protoV1, true},
+		{"protobuf change message name", NewProtobufCodec(), protoRenamed, protoV1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.codec.CheckCompatibility(tt.newSchema, tt.oldSchema)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckCompatibility() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetCodec(t *testing.T) {
+	ms := NewMicroservice()
+	avroCodec, err := NewAvroCodec(testCitizenAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.RegisterCodec(avroCodec)
+	ms.RegisterCodec(NewProtobufCodec())
+
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"", "application/json"},
+		{"application/json; charset=UTF-8", "application/json"},
+		{"application/json; schema=json-schema", "application/json"},
+		{"application/x-protobuf", "application/x-protobuf"},
+		{"application/avro; schema=tcir.Citizen", "application/avro; schema=tcir.Citizen"},
+		{"application/unknown", "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got := ms.getCodec(tt.contentType).Name()
+			if got != tt.want {
+				t.Errorf("getCodec() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInputs(t *testing.T) {
+	codecs := []ICodec{NewJSONCodec(), NewJSONCodec()}
+	inputs := [][]byte{[]byte(`{"citizen_id":"1"}`), []byte(`{"citizen_id":"2"}`)}
+
+	values := []testCitizen{}
+	err := decodeInputs(codecs, inputs, &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0].CitizenID != "1" || values[1].CitizenID != "2" {
+		t.Errorf("decodeInputs() = %v", values)
+	}
+
+	pointers := []*testCitizen{}
+	err = decodeInputs(codecs, inputs, &pointers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 2 || pointers[1].CitizenID != "2" {
+		t.Errorf("decodeInputs() = %v", pointers)
+	}
+
+	err = decodeInputs(codecs, inputs, values)
+	if err == nil {
+		t.Error("decodeInputs() of non pointer error = nil, want error")
+	}
+}
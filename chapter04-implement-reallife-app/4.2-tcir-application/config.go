@@ -13,6 +13,9 @@ type IConfig interface {
 	CitizenValidationAPI() string
 	CitizenDeliveryAPI() string
 	BatchDeliverAPI() string
+	LogLevel() string
+	TracingExporter() string
+	TracingEndpoint() string
 }
 
 // Config implement IConfig
@@ -62,3 +65,18 @@ func (cfg *Config) CitizenDeliveryAPI() string {
 func (cfg *Config) BatchDeliverAPI() string {
 	return "http://batch-ptask-api:8080/ptask/delivery"
 }
+
+// LogLevel return minimum level of log (debug, info, warn or error)
+func (cfg *Config) LogLevel() string {
+	return os.Getenv("LOG_LEVEL")
+}
+
+// TracingExporter return span exporter (otlp, file or empty to not export spans)
+func (cfg *Config) TracingExporter() string {
+	return os.Getenv("TRACING_EXPORTER")
+}
+
+// TracingEndpoint return OTLP/HTTP traces URL or the file path of span exporter
+func (cfg *Config) TracingEndpoint() string {
+	return os.Getenv("TRACING_ENDPOINT")
+}
@@ -0,0 +1,293 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/labstack/echo"
+)
+
+// consumerPollTimeout is the max time to wait for message, so the consumer can check its flow on time
+const consumerPollTimeout = time.Second
+
+// consumerLagInterval is the interval to update consumer lag when BackpressurePolicy is not set
+const consumerLagInterval = 5 * time.Second
+
+// BackpressurePolicy is the policy to pause assigned partitions when the consumer cannot keep up,
+// the partitions are resumed automatically when the condition is back to normal
+type BackpressurePolicy struct {
+	// MaxInFlight pause partitions when the messages that have read but not completed reach this number (0 = no limit)
+	// It can be used with ConsumeBatch and WithConcurrency only, the other consumers handle one message at a time
+	MaxInFlight int
+
+	// HealthCheck pause partitions when it return error, such as the downstream API or database is down
+	HealthCheck func() error
+
+	// CheckInterval is the interval to execute HealthCheck and update consumer lag (default 1 second)
+	CheckInterval time.Duration
+}
+
+// PartitionLag is the lag of consumer group in partition
+type PartitionLag struct {
+	GroupID       string `json:"group_id"`
+	Topic         string `json:"topic"`
+	Partition     int32  `json:"partition"`
+	Offset        int64  `json:"offset"`
+	HighWatermark int64  `json:"high_watermark"`
+	// Lag is the number of messages that have not consumed, -1 if the consumer has not fetched the partition yet
+	Lag    int64 `json:"lag"`
+	Paused bool  `json:"paused"`
+}
+
+// consumerFlow pause and resume the assigned partitions by BackpressurePolicy and publish consumer lag
+// It must be used in the goroutine that read message, except the health check that run in its own goroutine
+type consumerFlow struct {
+	ms       *Microservice
+	c        *kafka.Consumer
+	id       string
+	groupID  string
+	policy   *BackpressurePolicy
+	interval time.Duration
+
+	paused    bool
+	reason    string
+	lastRead  time.Time
+	lastCheck time.Time
+
+	healthErr   error
+	healthMutex sync.Mutex
+	stop        chan bool
+}
+
+func newConsumerFlow(ms *Microservice, c *kafka.Consumer, groupID string, topics []string, opts *ConsumerOptions) *consumerFlow {
+	fc := &consumerFlow{
+		ms:       ms,
+		c:        c,
+		id:       ms.newConsumerFlowID(groupID + "/" + strings.Join(topics, ",")),
+		groupID:  groupID,
+		policy:   opts.Backpressure,
+		interval: consumerLagInterval,
+		lastRead: time.Now(),
+		stop:     make(chan bool),
+	}
+	if fc.policy != nil {
+		fc.interval = time.Second
+		if fc.policy.CheckInterval > 0 {
+			fc.interval = fc.policy.CheckInterval
+		}
+		if fc.policy.HealthCheck != nil {
+			go fc.checkHealth()
+		}
+	}
+	return fc
+}
+
+// checkHealth execute HealthCheck every interval, it run in its own goroutine so the slow health check
+// will not block the consumer
+func (fc *consumerFlow) checkHealth() {
+	ticker := time.NewTicker(fc.interval)
+	defer ticker.Stop()
+	for {
+		err := fc.policy.HealthCheck()
+		fc.healthMutex.Lock()
+		fc.healthErr = err
+		fc.healthMutex.Unlock()
+
+		select {
+		case <-fc.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (fc *consumerFlow) health() error {
+	fc.healthMutex.Lock()
+	defer fc.healthMutex.Unlock()
+	return fc.healthErr
+}
+
+// read mark that consumer has read the message
+func (fc *consumerFlow) read() {
+	fc.lastRead = time.Now()
+}
+
+// timedOut return true if no message has read within readTimeout (readTimeout <= 0 is no timeout),
+// the time that partitions have paused is not counted
+func (fc *consumerFlow) timedOut(readTimeout time.Duration) bool {
+	if readTimeout <= 0 || fc.paused {
+		return false
+	}
+	return time.Since(fc.lastRead) >= readTimeout
+}
+
+// check pause or resume the assigned partitions by number of inFlight messages and health check,
+// and update consumer lag every interval
+func (fc *consumerFlow) check(inFlight int) {
+	reason := ""
+	if fc.policy != nil {
+		if fc.policy.MaxInFlight > 0 && inFlight >= fc.policy.MaxInFlight {
+			reason = fmt.Sprintf("%d messages in-flight", inFlight)
+		}
+		healthErr := fc.health()
+		if healthErr != nil {
+			reason = "health check failed: " + healthErr.Error()
+		}
+	}
+
+	periodic := time.Since(fc.lastCheck) >= fc.interval
+	if periodic {
+		fc.lastCheck = time.Now()
+	}
+
+	switch {
+	case len(reason) > 0 && (!fc.paused || periodic):
+		// Pause again every interval, so the partitions that have assigned after pause are paused as well
+		fc.pause(reason)
+	case len(reason) == 0 && fc.paused:
+		fc.resume()
+	}
+
+	if periodic {
+		fc.updateLag()
+	}
+}
+
+func (fc *consumerFlow) pause(reason string) {
+	tps, err := fc.c.Assignment()
+	if err == nil {
+		err = fc.c.Pause(tps)
+	}
+	if err != nil {
+		fc.ms.LogError("Consumer", err)
+		return
+	}
+	if !fc.paused || fc.reason != reason {
+		fc.ms.Log("Consumer", fmt.Sprintf("Pause %s because %s", fc.id, reason))
+	}
+	fc.paused = true
+	fc.reason = reason
+}
+
+func (fc *consumerFlow) resume() {
+	tps, err := fc.c.Assignment()
+	if err == nil {
+		err = fc.c.Resume(tps)
+	}
+	if err != nil {
+		fc.ms.LogError("Consumer", err)
+		return
+	}
+	fc.ms.Log("Consumer", fmt.Sprintf("Resume %s", fc.id))
+	fc.paused = false
+	fc.reason = ""
+	fc.lastRead = time.Now()
+}
+
+// updateLag read position and the cached high watermark of assigned partitions, it does not call the broker
+func (fc *consumerFlow) updateLag() {
+	tps, err := fc.c.Assignment()
+	if err == nil {
+		tps, err = fc.c.Position(tps)
+	}
+	if err != nil {
+		fc.ms.LogError("Consumer", err)
+		return
+	}
+
+	lags := make([]PartitionLag, 0, len(tps))
+	for _, tp := range tps {
+		if tp.Topic == nil {
+			continue
+		}
+		lag := PartitionLag{
+			GroupID:   fc.groupID,
+			Topic:     *tp.Topic,
+			Partition: tp.Partition,
+			Offset:    int64(tp.Offset),
+			Lag:       -1,
+			Paused:    fc.paused,
+		}
+		_, high, err := fc.c.GetWatermarkOffsets(*tp.Topic, tp.Partition)
+		if err == nil {
+			lag.HighWatermark = high
+			if tp.Offset >= 0 && high >= 0 {
+				lag.Lag = high - int64(tp.Offset)
+			}
+		}
+		lags = append(lags, lag)
+	}
+	fc.ms.setConsumerLags(fc.id, lags)
+}
+
+// close stop health check and remove lag of this consumer
+func (fc *consumerFlow) close() {
+	close(fc.stop)
+	fc.ms.setConsumerLags(fc.id, nil)
+}
+
+// newConsumerFlowID return unique id of consumer instance, so the consumers of the same group and topics
+// in this service do not replace (or remove) lags of each other
+func (ms *Microservice) newConsumerFlowID(name string) string {
+	ms.lagMutex.Lock()
+	defer ms.lagMutex.Unlock()
+	ms.flowCount++
+	return fmt.Sprintf("%s#%d", name, ms.flowCount)
+}
+
+func (ms *Microservice) setConsumerLags(id string, lags []PartitionLag) {
+	ms.lagMutex.Lock()
+	defer ms.lagMutex.Unlock()
+	if ms.lags == nil {
+		ms.lags = map[string][]PartitionLag{}
+	}
+	if lags == nil {
+		delete(ms.lags, id)
+		return
+	}
+	ms.lags[id] = lags
+}
+
+// ConsumerLags return the latest lag of every partitions that are assigned to consumers in this service
+func (ms *Microservice) ConsumerLags() []PartitionLag {
+	ms.lagMutex.Lock()
+	defer ms.lagMutex.Unlock()
+	lags := []PartitionLag{}
+	for _, consumerLags := range ms.lags {
+		lags = append(lags, consumerLags...)
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].GroupID != lags[j].GroupID {
+			return lags[i].GroupID < lags[j].GroupID
+		}
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags
+}
+
+// RegisterConsumerLagEndpoint register endpoint that response lag of every partitions in JSON,
+// total_lag can be used as the metric for autoscaler
+func (ms *Microservice) RegisterConsumerLagEndpoint(path string) {
+	ms.echo.GET(path, func(c echo.Context) error {
+		lags := ms.ConsumerLags()
+		total := int64(0)
+		for _, lag := range lags {
+			if lag.Lag > 0 {
+				total += lag.Lag
+			}
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"total_lag":  total,
+			"partitions": lags,
+		})
+	})
+}
@@ -0,0 +1,54 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsumerLagsOfDuplicateConsumers(t *testing.T) {
+	ms := NewMicroservice()
+	first := ms.newConsumerFlowID("mail/citizen")
+	second := ms.newConsumerFlowID("mail/citizen")
+	if first == second {
+		t.Fatalf("newConsumerFlowID() = %s for both consumers", first)
+	}
+
+	ms.setConsumerLags(first, []PartitionLag{{GroupID: "mail", Topic: "citizen", Partition: 0, Lag: 3}})
+	ms.setConsumerLags(second, []PartitionLag{{GroupID: "mail", Topic: "citizen", Partition: 1, Lag: 5}})
+	if lags := ms.ConsumerLags(); len(lags) != 2 || lags[0].Partition != 0 || lags[1].Partition != 1 {
+		t.Errorf("ConsumerLags() = %+v, want partition 0 and 1", lags)
+	}
+
+	// The first consumer has closed, the lag of the second consumer is kept
+	ms.setConsumerLags(first, nil)
+	if lags := ms.ConsumerLags(); len(lags) != 1 || lags[0].Partition != 1 {
+		t.Errorf("ConsumerLags() = %+v, want partition 1", lags)
+	}
+}
+
+func TestConsumeBackpressureOptions(t *testing.T) {
+	h := func(ctx IContext) error { return nil }
+	tests := []struct {
+		name    string
+		opts    []ConsumerOption
+		wantErr bool
+	}{
+		{"max in-flight without concurrency", []ConsumerOption{WithBackpressure(&BackpressurePolicy{MaxInFlight: 10})}, true},
+		{"max in-flight with transaction", []ConsumerOption{
+			WithTransaction("mail-0"),
+			WithBackpressure(&BackpressurePolicy{MaxInFlight: 10}),
+		}, true},
+		{"concurrency with transaction", []ConsumerOption{WithTransaction("mail-0"), WithConcurrency(4)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := NewMicroservice()
+			err := ms.Consume("localhost:9092", "citizen", "mail", time.Second, h, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Consume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
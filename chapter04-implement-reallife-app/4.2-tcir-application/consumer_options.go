@@ -0,0 +1,107 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import "time"
+
+// ConsumerOptions is the options for Consume and ConsumeBatch
+type ConsumerOptions struct {
+	// AtLeastOnce will store the offset only after the handler has returned nil,
+	// the failed message will be redelivered instead of skipped
+	AtLeastOnce bool
+
+	// RetryBackoff is the delay before redeliver the failed message (AtLeastOnce only)
+	RetryBackoff time.Duration
+
+	// RetryPolicy will republish the failed message to retry topics and dead letter queue (Consume only)
+	RetryPolicy *RetryPolicy
+
+	// Transactional will execute handler inside producer transaction, the consumer offset and messages
+	// sent from ctx.Producer are committed together in one transaction (Consume only)
+	Transactional bool
+
+	// TransactionalID is the transactional.id of the producer, it must be unique and stable for each consumer instance
+	// (the same id after the instance has restarted)
+	TransactionalID string
+
+	// Concurrency is the number of workers per partition, messages with the same key are handled
+	// by the same worker in order (Consume only, cannot be used with Transactional)
+	Concurrency int
+
+	// Backpressure will pause the assigned partitions when the consumer cannot keep up (retry topics are not paused)
+	Backpressure *BackpressurePolicy
+
+	// Middlewares are run after the global middlewares (Use)
+	Middlewares []MiddlewareFunc
+}
+
+// ConsumerOption is the function to set ConsumerOptions
+type ConsumerOption func(opts *ConsumerOptions)
+
+// WithAtLeastOnce turn on at-least-once delivery, the offset is stored after the handler succeeded
+// (per message in Consume, per batch in ConsumeBatch) and the failed message is redelivered after retryBackoff
+func WithAtLeastOnce(retryBackoff time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.AtLeastOnce = true
+		if retryBackoff > 0 {
+			opts.RetryBackoff = retryBackoff
+		}
+	}
+}
+
+// WithRetryPolicy republish the failed message to <topic>-retry-<delay> topics in order,
+// and finally to <topic>-dlq when every retry has failed
+// The retry topics are always consumed at least once, so the message that is waiting for the delay is not lost
+func WithRetryPolicy(policy *RetryPolicy) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.RetryPolicy = policy
+	}
+}
+
+// WithTransaction turn on transactional consume-transform-produce (exactly-once between topics),
+// if transactionalID is empty, it will be created from group id and hostname, the service must be run as StatefulSet
+// (hostname is <statefulset name>-<ordinal>), Consume return error if hostname is not the pod name of StatefulSet
+func WithTransaction(transactionalID string) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.Transactional = true
+		opts.TransactionalID = transactionalID
+		// Offsets are never stored automatically in transactional mode
+		opts.AtLeastOnce = true
+	}
+}
+
+// WithConcurrency handle messages of each partition with workers concurrently, messages with the same key
+// are handled in order, and the offset is stored only up to the lowest message that has not completed
+func WithConcurrency(workers int) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.Concurrency = workers
+	}
+}
+
+// WithBackpressure pause the assigned partitions when in-flight messages are over the limit
+// or the health check has failed, and resume them when it is back to normal
+// MaxInFlight of Consume requires WithConcurrency, Consume return error if it is set without concurrency
+func WithBackpressure(policy *BackpressurePolicy) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.Backpressure = policy
+	}
+}
+
+// WithMiddlewares add middlewares to the handler of this consumer
+func WithMiddlewares(middlewares ...MiddlewareFunc) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.Middlewares = append(opts.Middlewares, middlewares...)
+	}
+}
+
+// newConsumerOptions return ConsumerOptions with default values applied by opts
+func newConsumerOptions(opts []ConsumerOption) *ConsumerOptions {
+	options := &ConsumerOptions{
+		AtLeastOnce:  false,
+		RetryBackoff: time.Second,
+		Concurrency:  1,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
@@ -0,0 +1,266 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Headers added to the message that has been republished to retry topic or dead letter queue
+const (
+	headerRetryAttempt      = "x-retry-attempt"
+	headerRetryError        = "x-retry-error"
+	headerOriginalTopic     = "x-original-topic"
+	headerOriginalPartition = "x-original-partition"
+	headerOriginalOffset    = "x-original-offset"
+)
+
+// RetryPolicy is the policy to republish the failed message to retry topics and dead letter queue
+type RetryPolicy struct {
+	// Delays is the delay of each retry topic, the failed message will be retried after delays[0],
+	// then delays[1] and so on, before it is sent to dead letter queue
+	Delays []time.Duration
+
+	// Partitions, Replications and RetentionPeriod are used to create retry topics and dead letter queue
+	Partitions      int
+	Replications    int
+	RetentionPeriod time.Duration
+}
+
+// retryTopicName return name of retry topic, for example topic-retry-1m, topic-retry-10m
+func retryTopicName(topic string, delay time.Duration) string {
+	var d string
+	if delay%time.Hour == 0 {
+		d = fmt.Sprintf("%dh", delay/time.Hour)
+	} else if delay%time.Minute == 0 {
+		d = fmt.Sprintf("%dm", delay/time.Minute)
+	} else {
+		d = fmt.Sprintf("%ds", delay/time.Second)
+	}
+	return topic + "-retry-" + d
+}
+
+// dlqTopicName return name of dead letter queue of topic
+func dlqTopicName(topic string) string {
+	return topic + "-dlq"
+}
+
+// consumerRetry republish failed message of topic by RetryPolicy
+type consumerRetry struct {
+	ms      *Microservice
+	servers string
+	topic   string
+	policy  *RetryPolicy
+}
+
+func newConsumerRetry(ms *Microservice, servers string, topic string, policy *RetryPolicy) *consumerRetry {
+	return &consumerRetry{
+		ms:      ms,
+		servers: servers,
+		topic:   topic,
+		policy:  policy,
+	}
+}
+
+// createTopics create every retry topics and dead letter queue if not exists
+func (r *consumerRetry) createTopics() error {
+	partitions := r.policy.Partitions
+	if partitions <= 0 {
+		partitions = 5
+	}
+	replications := r.policy.Replications
+	if replications <= 0 {
+		replications = 1
+	}
+	retentionPeriod := r.policy.RetentionPeriod
+	if retentionPeriod <= 0 {
+		retentionPeriod = time.Hour * 24 * 30 // retain message for 30 days
+	}
+
+	mq := NewMQ(r.servers, r.ms)
+	topics := []string{}
+	for _, delay := range r.policy.Delays {
+		topics = append(topics, retryTopicName(r.topic, delay))
+	}
+	topics = append(topics, dlqTopicName(r.topic))
+
+	for _, topic := range topics {
+		err := mq.CreateTopicR(topic, partitions, replications, retentionPeriod)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// republish send the failed message to the next retry topic, or to dead letter queue if no retry left
+// It return error only when the message cannot be republished (prod can be transactional producer)
+func (r *consumerRetry) republish(prod IProducer, msg *kafka.Message, handleErr error) error {
+	headers := headersMap(msg.Headers)
+
+	attempt, _ := strconv.Atoi(headers[headerRetryAttempt])
+	attempt++
+
+	// Keep the position of the first failure, so the message can be traced back
+	if len(headers[headerOriginalTopic]) == 0 && msg.TopicPartition.Topic != nil {
+		headers[headerOriginalTopic] = *msg.TopicPartition.Topic
+		headers[headerOriginalPartition] = fmt.Sprintf("%d", msg.TopicPartition.Partition)
+		headers[headerOriginalOffset] = fmt.Sprintf("%d", int64(msg.TopicPartition.Offset))
+	}
+	headers[headerRetryAttempt] = fmt.Sprintf("%d", attempt)
+	headers[headerRetryError] = handleErr.Error()
+
+	// Invalid input will never succeed, so it is sent to dead letter queue without retry
+	topic := dlqTopicName(r.topic)
+	if attempt <= len(r.policy.Delays) && !isInvalidInput(handleErr) {
+		topic = retryTopicName(r.topic, r.policy.Delays[attempt-1])
+	}
+
+	err := prod.SendMessageRaw(topic, string(msg.Key), msg.Value, headers)
+	if err != nil {
+		return err
+	}
+
+	r.ms.Log("Consumer", fmt.Sprintf("Message has sent to %s (attempt %d)", topic, attempt))
+	return nil
+}
+
+// handoverFailed republish the failed message by retry (if not nil), the invalid input is skipped
+// when there is no retry, because redelivering it will always fail
+// It return nil when the offset of the failed message can be stored
+func (ms *Microservice) handoverFailed(retry *consumerRetry, prod IProducer, msg *kafka.Message, handleErr error) error {
+	if retry != nil {
+		return retry.republish(prod, msg, handleErr)
+	}
+	if isInvalidInput(handleErr) {
+		ms.Log("Consumer", fmt.Sprintf("Skip invalid message %s", msg.TopicPartition))
+		return nil
+	}
+	return handleErr
+}
+
+// retryConsumerOptions return options of retry consumers, the offset is always stored manually after the message
+// has been handled or handed over, so the offset of the message that is waiting for the delay is not committed
+// (it would be lost if the consumer has restarted during the delay)
+// Retry consumer handle one message at a time, so Concurrency of the main consumer is not used
+func retryConsumerOptions(opts *ConsumerOptions) *ConsumerOptions {
+	retryOpts := *opts
+	retryOpts.AtLeastOnce = true
+	retryOpts.Concurrency = 0
+	return &retryOpts
+}
+
+// consumeRetryTopic consume message from retry topic, and execute handler when the delay has passed
+func (ms *Microservice) consumeRetryTopic(servers string, groupID string, retry *consumerRetry, delay time.Duration, h ServiceHandleFunc, opts *ConsumerOptions) {
+	topic := retryTopicName(retry.topic, delay)
+
+	c, err := ms.newKafkaConsumer(servers, groupID, opts)
+	if err != nil {
+		return
+	}
+
+	defer c.Close()
+
+	// In transactional mode, each retry topic has its own transactional producer
+	var prod *Producer
+	if opts.Transactional {
+		prod, err = ms.newTransactionalProducer(servers, transactionalID(opts, topic))
+		if err != nil {
+			ms.LogError("Consumer", err)
+			ms.Stop()
+			return
+		}
+		defer prod.Close()
+	}
+
+	// Partition that is waiting for the delay will be paused until resumeAt
+	paused := map[int32]time.Time{}
+
+	c.Subscribe(topic, ms.rebalanceCallback(groupID, func(c *kafka.Consumer, tps []kafka.TopicPartition) {
+		// Revoked partition is not paused anymore, the new owner will wait for the delay by itself
+		for _, tp := range tps {
+			delete(paused, tp.Partition)
+		}
+		if prod == nil {
+			ms.commitOffsets(c)
+		}
+	}))
+
+	for {
+		// Stop reading new message when the service is shutting down,
+		// the stored offsets are committed when the consumer is closed
+		if ms.isStopping() {
+			return
+		}
+
+		now := time.Now()
+		for partition, resumeAt := range paused {
+			if now.Before(resumeAt) {
+				continue
+			}
+			c.Resume([]kafka.TopicPartition{{Topic: &topic, Partition: partition}})
+			delete(paused, partition)
+		}
+
+		// Read with short timeout, so the paused partitions can be resumed on time
+		msg, err := c.ReadMessage(time.Second)
+		if err != nil {
+			kafkaErr, ok := err.(kafka.Error)
+			if ok && kafkaErr.Code() == kafka.ErrTimedOut {
+				continue
+			}
+			ms.LogError("Consumer", err)
+			ms.Stop()
+			return
+		}
+
+		// Message in the same retry topic has the same delay, so if this message is not due,
+		// the next messages in this partition are not due as well, just pause and read this message again later
+		// (its offset is not stored, so it is read again after restart or rebalance)
+		dueAt := msg.Timestamp.Add(delay)
+		if now.Before(dueAt) {
+			c.Pause([]kafka.TopicPartition{msg.TopicPartition})
+			c.Seek(msg.TopicPartition, 0)
+			paused[msg.TopicPartition.Partition] = dueAt
+			continue
+		}
+
+		if prod != nil {
+			err = ms.handleTransaction(c, prod, msg, h, retry)
+			if err != nil {
+				ms.rewind(c, msg, opts)
+			}
+			continue
+		}
+
+		// Execute Handler
+		err = h(NewConsumerContext(ms, NewMessage(msg)))
+		if err != nil {
+			ms.LogError("Consumer", err)
+			err = ms.handoverFailed(retry, ms.getProducer(servers), msg, err)
+		}
+		ms.afterHandle(c, msg, err, opts)
+	}
+}
+
+// startRetryConsumers create retry topics and start consumer for each retry topic,
+// the topics are created after every dependencies have responded, before the consumers start
+func (ms *Microservice) startRetryConsumers(servers string, groupID string, retry *consumerRetry, h ServiceHandleFunc, opts *ConsumerOptions) {
+	ms.OnStartup(retry.createTopics)
+	retryOpts := retryConsumerOptions(opts)
+	for _, delay := range retry.policy.Delays {
+		delay := delay
+		ms.startWorker(func() {
+			ms.consumeRetryTopic(servers, groupID, retry, delay, h, retryOpts)
+		})
+	}
+}
+
+// isRetryHeader return true if the header is added by consumerRetry
+func isRetryHeader(key string) bool {
+	return strings.HasPrefix(key, "x-retry-") || strings.HasPrefix(key, "x-original-")
+}
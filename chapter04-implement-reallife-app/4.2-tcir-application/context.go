@@ -1,23 +1,53 @@
 // Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
 package main
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // IContext is the context for service
 type IContext interface {
 	Log(message string)
+	Logger() ILogger
 	Param(name string) string
 	QueryParam(name string) string
 	Response(responseCode int, responseData interface{})
 	ReadInput() string
 	ReadInputs() []string
+	ReadMessage() *Message
+	ReadMessages() []*Message
+	BindInput(v interface{}) error
+	BindInputs(v interface{}) error
 
 	// Time
 	Now() time.Time
 
+	// Context is cancelled when the work should be stopped (such as HTTP client has disconnected
+	// or the service has shutdown), every dependencies below are bound to this context
+	Context() context.Context
+
+	// Span is the span of the work in this context, it is propagated to the dependencies through Context()
+	Span() *Span
+
 	// Dependency
 	Cacher(server string) ICacher
 	Producer(servers string) IProducer
 	MQ(servers string) IMQ
 	Requester(baseURL string, timeout time.Duration) IRequester
+	Metrics() IMetrics
+}
+
+// mergeContext return context that is cancelled when ctx or other is done, values are read from ctx
+// The goroutine exit when either context is done, so ctx must be done eventually (such as request context)
+func mergeContext(ctx context.Context, other context.Context) context.Context {
+	merged, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-other.Done():
+		case <-merged.Done():
+		}
+		cancel()
+	}()
+	return merged
 }
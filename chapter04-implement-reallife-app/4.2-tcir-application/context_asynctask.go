@@ -2,9 +2,9 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"runtime"
-	"strings"
 	"time"
 )
 
@@ -14,23 +14,38 @@ type AsyncTaskContext struct {
 	cacheServer string
 	ref         string
 	input       string
+	ctx         context.Context
+	span        *Span
+	logger      ILogger
 }
 
-// NewAsyncTaskContext is the constructor function for AsyncTaskContext
-func NewAsyncTaskContext(ms *Microservice, cacheServer string, ref string, input string) *AsyncTaskContext {
+// NewAsyncTaskContext is the constructor function for AsyncTaskContext,
+// the span of task is the child of span in parent (the context of consumer that read the task)
+func NewAsyncTaskContext(ms *Microservice, parent context.Context, cacheServer string, ref string, input string) *AsyncTaskContext {
+	ctx, span := ms.tracer.StartSpan(parent, "asynctask", SpanKindInternal)
+	span.SetAttribute("asynctask.ref", ref)
 	return &AsyncTaskContext{
 		ms:          ms,
 		cacheServer: cacheServer,
 		ref:         ref,
 		input:       input,
+		ctx:         ctx,
+		span:        span,
+		logger: ms.contextLogger(span, LogFields{
+			"context": "asynctask",
+			"ref":     ref,
+		}),
 	}
 }
 
-// Log will log a message
+// Log will log a message at info level with the fields of this context
 func (ctx *AsyncTaskContext) Log(message string) {
-	_, fn, line, _ := runtime.Caller(1)
-	fns := strings.Split(fn, "/")
-	fmt.Println("ATASK:", fns[len(fns)-1], line, message)
+	ctx.logger.WithCallerSkip(1).Info(message)
+}
+
+// Logger return logger with the fields of this context, such as trace_id
+func (ctx *AsyncTaskContext) Logger() ILogger {
+	return ctx.logger
 }
 
 // Param return parameter by name (empty in AsyncTask)
@@ -53,7 +68,27 @@ func (ctx *AsyncTaskContext) ReadInputs() []string {
 	return nil
 }
 
-// Response return response to client
+// ReadMessage return nil in AsyncTask
+func (ctx *AsyncTaskContext) ReadMessage() *Message {
+	return nil
+}
+
+// ReadMessages return nil in AsyncTask
+func (ctx *AsyncTaskContext) ReadMessages() []*Message {
+	return nil
+}
+
+// BindInput decode input (the request body of AsyncTask) into v with JSON codec
+func (ctx *AsyncTaskContext) BindInput(v interface{}) error {
+	return NewJSONCodec().Unmarshal([]byte(ctx.input), v)
+}
+
+// BindInputs return error in AsyncTask
+func (ctx *AsyncTaskContext) BindInputs(v interface{}) error {
+	return fmt.Errorf("BindInputs is not supported in AsyncTask, use BindInput instead")
+}
+
+// Response return response to client, only the first response is kept (such as the message has been redelivered)
 func (ctx *AsyncTaskContext) Response(responseCode int, responseData interface{}) {
 	cacher := ctx.Cacher(ctx.cacheServer)
 	res := map[string]interface{}{
@@ -61,7 +96,22 @@ func (ctx *AsyncTaskContext) Response(responseCode int, responseData interface{}
 		"code":   responseCode,
 		"data":   responseData,
 	}
-	cacher.Set(ctx.ref, res, 30*time.Minute)
+	err := cacher.Update(ctx.ref, 30*time.Minute, func(current string) (interface{}, error) {
+		status := map[string]interface{}{}
+		if len(current) > 0 {
+			err := json.Unmarshal([]byte(current), &status)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if status["status"] == "success" {
+			return nil, ErrSkipUpdate
+		}
+		return res, nil
+	})
+	if err != nil {
+		ctx.Logger().Error(err.Error())
+	}
 }
 
 // Now return now
@@ -69,22 +119,41 @@ func (ctx *AsyncTaskContext) Now() time.Time {
 	return time.Now()
 }
 
-// Cacher return cacher
+// Context return the service context, it is cancelled when the service has shutdown
+func (ctx *AsyncTaskContext) Context() context.Context {
+	return ctx.ctx
+}
+
+func (ctx *AsyncTaskContext) setContext(c context.Context) {
+	ctx.ctx = c
+}
+
+// Cacher return cacher that is bound to the context
 func (ctx *AsyncTaskContext) Cacher(server string) ICacher {
-	return ctx.ms.getCacher(server)
+	return ctx.ms.getCacher(server).WithContext(ctx.Context())
 }
 
-// Producer return producer
+// Producer return producer that is bound to the context
 func (ctx *AsyncTaskContext) Producer(servers string) IProducer {
-	return ctx.ms.getProducer(servers)
+	return ctx.ms.getProducer(servers).WithContext(ctx.Context())
 }
 
-// MQ return MQ
+// MQ return MQ that is bound to the context
 func (ctx *AsyncTaskContext) MQ(servers string) IMQ {
-	return NewMQ(servers, ctx.ms)
+	return NewMQ(servers, ctx.ms).WithContext(ctx.Context())
 }
 
-// Requester return Requester
+// Requester return Requester that is bound to the context
 func (ctx *AsyncTaskContext) Requester(baseURL string, timeout time.Duration) IRequester {
-	return NewRequester(baseURL, timeout, ctx.ms)
+	return NewRequester(baseURL, timeout, ctx.ms).WithContext(ctx.Context())
+}
+
+// Metrics return business metrics, they are exposed with the built-in metrics
+func (ctx *AsyncTaskContext) Metrics() IMetrics {
+	return ctx.ms.Metrics()
+}
+
+// Span return span of this context, handler can add attributes to it
+func (ctx *AsyncTaskContext) Span() *Span {
+	return ctx.span
 }
@@ -2,31 +2,69 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"runtime"
-	"strings"
 	"time"
 )
 
 // ConsumerContext implement IContext it is context for Consumer
 type ConsumerContext struct {
 	ms      *Microservice
-	message string
+	message *Message
+	prod    IProducer
+	span    *Span
+	logger  ILogger
+	ctx     context.Context
 }
 
-// NewConsumerContext is the constructor function for ConsumerContext
-func NewConsumerContext(ms *Microservice, message string) *ConsumerContext {
+// NewConsumerContext is the constructor function for ConsumerContext, it start the consumer span of message
+func NewConsumerContext(ms *Microservice, message *Message) *ConsumerContext {
+	span := ms.startMessageSpan(message)
 	return &ConsumerContext{
 		ms:      ms,
 		message: message,
+		span:    span,
+		logger:  ms.contextLogger(span, messageLogFields(message)),
+		ctx:     contextWithSpan(ms.ctx, span),
 	}
 }
 
-// Log will log a message
+// NewTransactionalConsumerContext return ConsumerContext that Producer return the transactional producer,
+// so every messages sent from handler are part of the consumer transaction
+func NewTransactionalConsumerContext(ms *Microservice, message *Message, prod IProducer) *ConsumerContext {
+	span := ms.startMessageSpan(message)
+	return &ConsumerContext{
+		ms:      ms,
+		message: message,
+		prod:    prod,
+		span:    span,
+		logger:  ms.contextLogger(span, messageLogFields(message)),
+		ctx:     contextWithSpan(ms.ctx, span),
+	}
+}
+
+// messageLogFields return log fields that identify message
+func messageLogFields(message *Message) LogFields {
+	fields := LogFields{
+		"context":   "consumer",
+		"topic":     message.Topic,
+		"partition": message.Partition,
+		"offset":    message.Offset,
+	}
+	if len(message.Key) > 0 {
+		fields["key"] = message.Key
+	}
+	return fields
+}
+
+// Log will log a message at info level with the fields of this context
 func (ctx *ConsumerContext) Log(message string) {
-	_, fn, line, _ := runtime.Caller(1)
-	fns := strings.Split(fn, "/")
-	fmt.Println("Consumer:", fns[len(fns)-1], line, message)
+	ctx.logger.WithCallerSkip(1).Info(message)
+}
+
+// Logger return logger with the fields of this context, such as trace_id
+func (ctx *ConsumerContext) Logger() ILogger {
+	return ctx.logger
 }
 
 // Param return parameter by name (empty in case of Consumer)
@@ -41,7 +79,7 @@ func (ctx *ConsumerContext) QueryParam(name string) string {
 
 // ReadInput return message
 func (ctx *ConsumerContext) ReadInput() string {
-	return ctx.message
+	return ctx.message.Value
 }
 
 // ReadInputs return nil in case Consumer
@@ -49,6 +87,27 @@ func (ctx *ConsumerContext) ReadInputs() []string {
 	return nil
 }
 
+// ReadMessage return message with key, headers, partition, offset and timestamp
+func (ctx *ConsumerContext) ReadMessage() *Message {
+	return ctx.message
+}
+
+// ReadMessages return nil in case Consumer
+func (ctx *ConsumerContext) ReadMessages() []*Message {
+	return nil
+}
+
+// BindInput decode message into v with the codec of content-type header (JSON by default)
+func (ctx *ConsumerContext) BindInput(v interface{}) error {
+	codec := ctx.ms.getCodec(ctx.message.Header(headerContentType))
+	return codec.Unmarshal([]byte(ctx.message.Value), v)
+}
+
+// BindInputs return error in Consumer
+func (ctx *ConsumerContext) BindInputs(v interface{}) error {
+	return fmt.Errorf("BindInputs is not supported in Consumer, use BindInput instead")
+}
+
 // Response return response to client
 func (ctx *ConsumerContext) Response(responseCode int, responseData interface{}) {
 	return
@@ -59,22 +118,44 @@ func (ctx *ConsumerContext) Now() time.Time {
 	return time.Now()
 }
 
-// Cacher return cacher
+// Context return the service context, it is cancelled when the service has shutdown
+func (ctx *ConsumerContext) Context() context.Context {
+	return ctx.ctx
+}
+
+func (ctx *ConsumerContext) setContext(c context.Context) {
+	ctx.ctx = c
+}
+
+// Cacher return cacher that is bound to the context
 func (ctx *ConsumerContext) Cacher(server string) ICacher {
-	return ctx.ms.getCacher(server)
+	return ctx.ms.getCacher(server).WithContext(ctx.Context())
 }
 
-// Producer return producer
+// Producer return producer that is bound to the context (transactional producer in transactional mode)
 func (ctx *ConsumerContext) Producer(servers string) IProducer {
-	return ctx.ms.getProducer(servers)
+	if ctx.prod != nil {
+		return ctx.prod.WithContext(ctx.Context())
+	}
+	return ctx.ms.getProducer(servers).WithContext(ctx.Context())
 }
 
-// MQ return MQ
+// MQ return MQ that is bound to the context
 func (ctx *ConsumerContext) MQ(servers string) IMQ {
-	return NewMQ(servers, ctx.ms)
+	return NewMQ(servers, ctx.ms).WithContext(ctx.Context())
 }
 
-// Requester return Requester
+// Requester return Requester that is bound to the context
 func (ctx *ConsumerContext) Requester(baseURL string, timeout time.Duration) IRequester {
-	return NewRequester(baseURL, timeout, ctx.ms)
+	return NewRequester(baseURL, timeout, ctx.ms).WithContext(ctx.Context())
+}
+
+// Metrics return business metrics, they are exposed with the built-in metrics
+func (ctx *ConsumerContext) Metrics() IMetrics {
+	return ctx.ms.Metrics()
+}
+
+// Span return span of this context, handler can add attributes to it
+func (ctx *ConsumerContext) Span() *Span {
+	return ctx.span
 }
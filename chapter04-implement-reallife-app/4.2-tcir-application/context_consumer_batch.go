@@ -2,31 +2,50 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"runtime"
-	"strings"
 	"time"
 )
 
 // BatchConsumerContext implement IContext it is context for Consumer
 type BatchConsumerContext struct {
 	ms       *Microservice
-	messages []string
+	messages []*Message
+	span     *Span
+	logger   ILogger
+	ctx      context.Context
 }
 
-// NewBatchConsumerContext is the constructor function for BatchConsumerContext
-func NewBatchConsumerContext(ms *Microservice, messages []string) *BatchConsumerContext {
+// NewBatchConsumerContext is the constructor function for BatchConsumerContext, it start the consumer span of batch
+func NewBatchConsumerContext(ms *Microservice, messages []*Message) *BatchConsumerContext {
+	span := ms.startBatchSpan(messages)
+	fields := LogFields{
+		"context":       "batch_consumer",
+		"message_count": len(messages),
+	}
+	if len(messages) > 0 {
+		// Offsets of the first message, the batch is in order of the reading
+		fields["topic"] = messages[0].Topic
+		fields["partition"] = messages[0].Partition
+		fields["offset"] = messages[0].Offset
+	}
 	return &BatchConsumerContext{
 		ms:       ms,
 		messages: messages,
+		span:     span,
+		logger:   ms.contextLogger(span, fields),
+		ctx:      contextWithSpan(ms.ctx, span),
 	}
 }
 
-// Log will log a message
+// Log will log a message at info level with the fields of this context
 func (ctx *BatchConsumerContext) Log(message string) {
-	_, fn, line, _ := runtime.Caller(1)
-	fns := strings.Split(fn, "/")
-	fmt.Println("Batch Consumer:", fns[len(fns)-1], line, message)
+	ctx.logger.WithCallerSkip(1).Info(message)
+}
+
+// Logger return logger with the fields of this context, such as trace_id
+func (ctx *BatchConsumerContext) Logger() ILogger {
+	return ctx.logger
 }
 
 // Param return parameter by name (empty in case of Consumer)
@@ -46,9 +65,39 @@ func (ctx *BatchConsumerContext) ReadInput() string {
 
 // ReadInputs return messages in batch
 func (ctx *BatchConsumerContext) ReadInputs() []string {
+	inputs := make([]string, 0, len(ctx.messages))
+	for _, message := range ctx.messages {
+		inputs = append(inputs, message.Value)
+	}
+	return inputs
+}
+
+// ReadMessage return nil in batch consumer
+func (ctx *BatchConsumerContext) ReadMessage() *Message {
+	return nil
+}
+
+// ReadMessages return messages in batch with key, headers, partition, offset and timestamp
+func (ctx *BatchConsumerContext) ReadMessages() []*Message {
 	return ctx.messages
 }
 
+// BindInput return error in batch consumer
+func (ctx *BatchConsumerContext) BindInput(v interface{}) error {
+	return fmt.Errorf("BindInput is not supported in Batch Consumer, use BindInputs instead")
+}
+
+// BindInputs decode every messages in batch into v (pointer to slice) with the codec of content-type header
+func (ctx *BatchConsumerContext) BindInputs(v interface{}) error {
+	codecs := make([]ICodec, 0, len(ctx.messages))
+	inputs := make([][]byte, 0, len(ctx.messages))
+	for _, message := range ctx.messages {
+		codecs = append(codecs, ctx.ms.getCodec(message.Header(headerContentType)))
+		inputs = append(inputs, []byte(message.Value))
+	}
+	return decodeInputs(codecs, inputs, v)
+}
+
 // Response return response to client
 func (ctx *BatchConsumerContext) Response(responseCode int, responseData interface{}) {
 	return
@@ -59,22 +108,41 @@ func (ctx *BatchConsumerContext) Now() time.Time {
 	return time.Now()
 }
 
-// Cacher return cacher
+// Context return the service context, it is cancelled when the service has shutdown
+func (ctx *BatchConsumerContext) Context() context.Context {
+	return ctx.ctx
+}
+
+func (ctx *BatchConsumerContext) setContext(c context.Context) {
+	ctx.ctx = c
+}
+
+// Cacher return cacher that is bound to the context
 func (ctx *BatchConsumerContext) Cacher(server string) ICacher {
-	return ctx.ms.getCacher(server)
+	return ctx.ms.getCacher(server).WithContext(ctx.Context())
 }
 
-// Producer return producer
+// Producer return producer that is bound to the context
 func (ctx *BatchConsumerContext) Producer(servers string) IProducer {
-	return ctx.ms.getProducer(servers)
+	return ctx.ms.getProducer(servers).WithContext(ctx.Context())
 }
 
-// MQ return MQ
+// MQ return MQ that is bound to the context
 func (ctx *BatchConsumerContext) MQ(servers string) IMQ {
-	return NewMQ(servers, ctx.ms)
+	return NewMQ(servers, ctx.ms).WithContext(ctx.Context())
 }
 
-// Requester return Requester
+// Requester return Requester that is bound to the context
 func (ctx *BatchConsumerContext) Requester(baseURL string, timeout time.Duration) IRequester {
-	return NewRequester(baseURL, timeout, ctx.ms)
+	return NewRequester(baseURL, timeout, ctx.ms).WithContext(ctx.Context())
+}
+
+// Metrics return business metrics, they are exposed with the built-in metrics
+func (ctx *BatchConsumerContext) Metrics() IMetrics {
+	return ctx.ms.Metrics()
+}
+
+// Span return span of this context, handler can add attributes to it
+func (ctx *BatchConsumerContext) Span() *Span {
+	return ctx.span
 }
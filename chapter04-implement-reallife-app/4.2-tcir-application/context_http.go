@@ -1,10 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"runtime"
-	"strings"
+	"net/http"
 	"time"
 
 	"github.com/labstack/echo"
@@ -12,23 +12,36 @@ import (
 
 // HTTPContext implement IContext it is context for HTTP
 type HTTPContext struct {
-	ms *Microservice
-	c  echo.Context
+	ms     *Microservice
+	c      echo.Context
+	ctx    context.Context
+	span   *Span
+	logger ILogger
 }
 
-// NewHTTPContext is the constructor function for HTTPContext
+// NewHTTPContext is the constructor function for HTTPContext, it start the server span of request
 func NewHTTPContext(ms *Microservice, c echo.Context) *HTTPContext {
+	span := ms.startHTTPSpan(c)
 	return &HTTPContext{
-		ms: ms,
-		c:  c,
+		ms:   ms,
+		c:    c,
+		span: span,
+		logger: ms.contextLogger(span, LogFields{
+			"context": "http",
+			"method":  c.Request().Method,
+			"route":   c.Path(),
+		}),
 	}
 }
 
-// Log will log a message
+// Log will log a message at info level with the fields of this context
 func (ctx *HTTPContext) Log(message string) {
-	_, fn, line, _ := runtime.Caller(1)
-	fns := strings.Split(fn, "/")
-	fmt.Println("HTTP:", fns[len(fns)-1], line, message)
+	ctx.logger.WithCallerSkip(1).Info(message)
+}
+
+// Logger return logger with the fields of this context, such as trace_id
+func (ctx *HTTPContext) Logger() ILogger {
+	return ctx.logger
 }
 
 // Param return parameter by name
@@ -55,6 +68,32 @@ func (ctx *HTTPContext) ReadInputs() []string {
 	return nil
 }
 
+// ReadMessage return nil in HTTP Context
+func (ctx *HTTPContext) ReadMessage() *Message {
+	return nil
+}
+
+// ReadMessages return nil in HTTP Context
+func (ctx *HTTPContext) ReadMessages() []*Message {
+	return nil
+}
+
+// BindInput decode the request body into v with the codec of Content-Type header (JSON by default),
+// GET and DELETE request without body are bound from query params (`query` tags)
+func (ctx *HTTPContext) BindInput(v interface{}) error {
+	req := ctx.c.Request()
+	if req.ContentLength == 0 && (req.Method == http.MethodGet || req.Method == http.MethodDelete) {
+		return ctx.c.Bind(v)
+	}
+	codec := ctx.ms.getCodec(ctx.c.Request().Header.Get("Content-Type"))
+	return codec.Unmarshal([]byte(ctx.ReadInput()), v)
+}
+
+// BindInputs return error in HTTP Context
+func (ctx *HTTPContext) BindInputs(v interface{}) error {
+	return fmt.Errorf("BindInputs is not supported in HTTP, use BindInput instead")
+}
+
 // Response return response to client
 func (ctx *HTTPContext) Response(responseCode int, responseData interface{}) {
 	ctx.c.JSON(responseCode, responseData)
@@ -65,22 +104,44 @@ func (ctx *HTTPContext) Now() time.Time {
 	return time.Now()
 }
 
-// Cacher return cacher
+// Context return the request context, it is cancelled when client has disconnected or the service has shutdown
+func (ctx *HTTPContext) Context() context.Context {
+	if ctx.ctx == nil {
+		ctx.ctx = contextWithSpan(mergeContext(ctx.c.Request().Context(), ctx.ms.ctx), ctx.span)
+	}
+	return ctx.ctx
+}
+
+func (ctx *HTTPContext) setContext(c context.Context) {
+	ctx.ctx = c
+}
+
+// Cacher return cacher that is bound to the context
 func (ctx *HTTPContext) Cacher(server string) ICacher {
-	return ctx.ms.getCacher(server)
+	return ctx.ms.getCacher(server).WithContext(ctx.Context())
 }
 
-// Producer return producer
+// Producer return producer that is bound to the context
 func (ctx *HTTPContext) Producer(servers string) IProducer {
-	return ctx.ms.getProducer(servers)
+	return ctx.ms.getProducer(servers).WithContext(ctx.Context())
 }
 
-// MQ return MQ
+// MQ return MQ that is bound to the context
 func (ctx *HTTPContext) MQ(servers string) IMQ {
-	return NewMQ(servers, ctx.ms)
+	return NewMQ(servers, ctx.ms).WithContext(ctx.Context())
 }
 
-// Requester return Requester
+// Requester return Requester that is bound to the context
 func (ctx *HTTPContext) Requester(baseURL string, timeout time.Duration) IRequester {
-	return NewRequester(baseURL, timeout, ctx.ms)
+	return NewRequester(baseURL, timeout, ctx.ms).WithContext(ctx.Context())
+}
+
+// Metrics return business metrics, they are exposed with the built-in metrics
+func (ctx *HTTPContext) Metrics() IMetrics {
+	return ctx.ms.Metrics()
+}
+
+// Span return span of this context, handler can add attributes to it
+func (ctx *HTTPContext) Span() *Span {
+	return ctx.span
 }
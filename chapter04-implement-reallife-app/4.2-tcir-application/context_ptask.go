@@ -2,10 +2,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"runtime"
-	"strings"
 	"time"
 )
 
@@ -16,24 +15,41 @@ type PTaskContext struct {
 	taskID      string
 	workerID    string
 	input       string
+	ctx         context.Context
+	span        *Span
+	logger      ILogger
 }
 
-// NewPTaskContext is the constructor function for PTaskContext
-func NewPTaskContext(ms *Microservice, cacheServer string, taskID string, workerID string, input string) *PTaskContext {
+// NewPTaskContext is the constructor function for PTaskContext,
+// the span of worker is the child of span in parent (the context of consumer that read the task)
+func NewPTaskContext(ms *Microservice, parent context.Context, cacheServer string, taskID string, workerID string, input string) *PTaskContext {
+	ctx, span := ms.tracer.StartSpan(parent, "ptask", SpanKindInternal)
+	span.SetAttribute("ptask.task_id", taskID)
+	span.SetAttribute("ptask.worker_id", workerID)
 	return &PTaskContext{
 		ms:          ms,
 		cacheServer: cacheServer,
 		taskID:      taskID,
 		workerID:    workerID,
 		input:       input,
+		ctx:         ctx,
+		span:        span,
+		logger: ms.contextLogger(span, LogFields{
+			"context":   "ptask",
+			"task_id":   taskID,
+			"worker_id": workerID,
+		}),
 	}
 }
 
-// Log will log a message
+// Log will log a message at info level with the fields of this context
 func (ctx *PTaskContext) Log(message string) {
-	_, fn, line, _ := runtime.Caller(1)
-	fns := strings.Split(fn, "/")
-	fmt.Println("PTASK:", fns[len(fns)-1], line, message)
+	ctx.logger.WithCallerSkip(1).Info(message)
+}
+
+// Logger return logger with the fields of this context, such as trace_id
+func (ctx *PTaskContext) Logger() ILogger {
+	return ctx.logger
 }
 
 // Param return parameter by name (empty in AsyncTask)
@@ -56,86 +72,59 @@ func (ctx *PTaskContext) ReadInputs() []string {
 	return nil
 }
 
-// Response return response to client
+// ReadMessage return nil in ParallelTask
+func (ctx *PTaskContext) ReadMessage() *Message {
+	return nil
+}
+
+// ReadMessages return nil in ParallelTask
+func (ctx *PTaskContext) ReadMessages() []*Message {
+	return nil
+}
+
+// BindInput decode input (the request body of ParallelTask) into v with JSON codec
+func (ctx *PTaskContext) BindInput(v interface{}) error {
+	return NewJSONCodec().Unmarshal([]byte(ctx.input), v)
+}
+
+// BindInputs return error in ParallelTask
+func (ctx *PTaskContext) BindInputs(v interface{}) error {
+	return fmt.Errorf("BindInputs is not supported in ParallelTask, use BindInput instead")
+}
+
+// Response set the response of this worker, and set the task status to complete when every workers have completed
+// Each workers update only their own status in one script, so the workers that complete at the same time
+// do not overwrite the status of each others
 func (ctx *PTaskContext) Response(responseCode int, responseData interface{}) {
-	maxLimit := 100
-	for true {
-		// Just check the limit to prevent infinite loop
-		maxLimit--
-		if maxLimit < 0 {
-			return
-		}
-
-		// 1. Get the current task status
-		cacher := ctx.Cacher(ctx.cacheServer)
-		currentStatusStr, err := cacher.Get(ctx.taskID)
-		if err != nil {
-			ctx.Log(err.Error())
-			return
-		}
-		currentStatus := map[string]interface{}{}
-		if len(currentStatusStr) > 0 {
-			err = json.Unmarshal([]byte(currentStatusStr), &currentStatus)
-			if err != nil {
-				ctx.Log(err.Error())
-				return
-			}
-		}
-
-		// 2. If task is complete, return
-		taskStatus, _ := currentStatus["status"].(string)
-		if taskStatus == "complete" {
-			return
-		}
-		workers, _ := currentStatus["workers"].([]interface{})
-		if len(workers) == 0 {
-			ctx.Log("No Workers")
-			return
-		}
-
-		// 3. Find worker that match ctx, and set the status to complete
-		for _, w := range workers {
-			worker := w.(map[string]interface{})
-			workerID, _ := worker["worker_id"]
-			if workerID != ctx.workerID {
-				continue
-			}
-
-			worker["status"] = "complete"
-			worker["response"] = responseData
-			worker["code"] = responseCode
-			break
-		}
-
-		// 4. If all workers has completed, set the task status to complete
-		allWorkerComplete := true
-		for _, w := range workers {
-			worker := w.(map[string]interface{})
-			if worker["status"] == "running" {
-				allWorkerComplete = false
-				break
-			}
-		}
-		if allWorkerComplete {
-			currentStatus["status"] = "complete"
-		}
-
-		// 5. Before send status update, just check race condition
-		if len(currentStatusStr) > 0 {
-			hasChanged, err := cacher.HasChanged(ctx.taskID, currentStatusStr)
-			if err != nil {
-				ctx.Log(err.Error())
-				return
-			}
-			// If race condition happen, just refresh status and try to update again
-			if hasChanged {
-				continue
-			}
-		}
-
-		// 6. Save status in cache
-		cacher.Set(ctx.taskID, currentStatus, 30*time.Minute)
-		break
+	// 1. Create the status of this worker
+	worker, err := json.Marshal(map[string]interface{}{
+		"status":    "complete",
+		"worker_id": ctx.workerID,
+		"response":  responseData,
+		"code":      responseCode,
+		"error":     "",
+	})
+	if err != nil {
+		ctx.Logger().Error(err.Error())
+		return
+	}
+	complete, _ := json.Marshal("complete")
+
+	// 2. Set worker status, and set the task status to complete if this is the last running worker
+	cacher := ctx.Cacher(ctx.cacheServer)
+	res, err := cacher.Eval(completePTaskWorkerScript, []string{ctx.taskID},
+		ptaskWorkerField(ctx.workerID), string(worker), string(complete))
+	if err != nil {
+		ctx.Logger().Error(err.Error())
+		return
+	}
+	running, _ := res.(int64)
+	if running < 0 {
+		ctx.Log("No Workers")
+		return
+	}
+	if running == 0 {
+		ctx.Log("Task has completed")
 	}
 }
 
@@ -144,22 +133,41 @@ func (ctx *PTaskContext) Now() time.Time {
 	return time.Now()
 }
 
-// Cacher return cacher
+// Context return the service context, it is cancelled when the service has shutdown
+func (ctx *PTaskContext) Context() context.Context {
+	return ctx.ctx
+}
+
+func (ctx *PTaskContext) setContext(c context.Context) {
+	ctx.ctx = c
+}
+
+// Cacher return cacher that is bound to the context
 func (ctx *PTaskContext) Cacher(server string) ICacher {
-	return ctx.ms.getCacher(server)
+	return ctx.ms.getCacher(server).WithContext(ctx.Context())
 }
 
-// Producer return producer
+// Producer return producer that is bound to the context
 func (ctx *PTaskContext) Producer(servers string) IProducer {
-	return ctx.ms.getProducer(servers)
+	return ctx.ms.getProducer(servers).WithContext(ctx.Context())
 }
 
-// MQ return MQ
+// MQ return MQ that is bound to the context
 func (ctx *PTaskContext) MQ(servers string) IMQ {
-	return NewMQ(servers, ctx.ms)
+	return NewMQ(servers, ctx.ms).WithContext(ctx.Context())
 }
 
-// Requester return Requester
+// Requester return Requester that is bound to the context
 func (ctx *PTaskContext) Requester(baseURL string, timeout time.Duration) IRequester {
-	return NewRequester(baseURL, timeout, ctx.ms)
+	return NewRequester(baseURL, timeout, ctx.ms).WithContext(ctx.Context())
+}
+
+// Metrics return business metrics, they are exposed with the built-in metrics
+func (ctx *PTaskContext) Metrics() IMetrics {
+	return ctx.ms.Metrics()
+}
+
+// Span return span of this context, handler can add attributes to it
+func (ctx *PTaskContext) Span() *Span {
+	return ctx.span
 }
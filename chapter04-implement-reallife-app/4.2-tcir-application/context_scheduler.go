@@ -2,29 +2,47 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"runtime"
-	"strings"
 	"time"
 )
 
 // SchedulerContext implement IContext it is context for Consumer
 type SchedulerContext struct {
-	ms *Microservice
+	ms        *Microservice
+	span      *Span
+	logger    ILogger
+	ctx       context.Context
+	scheduled time.Time
 }
 
-// NewSchedulerContext is the constructor function for SchedulerContext
-func NewSchedulerContext(ms *Microservice) *SchedulerContext {
+// NewSchedulerContext is the constructor function for SchedulerContext, every runs start new trace
+// scheduled is the time that the run is scheduled (in timezone of the schedule)
+func NewSchedulerContext(ms *Microservice, name string, scheduled time.Time) *SchedulerContext {
+	span := ms.tracer.startSpan(SpanContext{}, "schedule "+name, SpanKindInternal)
+	span.SetAttribute("schedule.name", name)
+	span.SetAttribute("schedule.scheduled_time", scheduled.Format(time.RFC3339))
 	return &SchedulerContext{
-		ms: ms,
+		ms:   ms,
+		span: span,
+		logger: ms.contextLogger(span, LogFields{
+			"context":        "scheduler",
+			"schedule":       name,
+			"scheduled_time": scheduled.Format(time.RFC3339),
+		}),
+		ctx:       contextWithSpan(ms.ctx, span),
+		scheduled: scheduled,
 	}
 }
 
-// Log will log a message
+// Log will log a message at info level with the fields of this context
 func (ctx *SchedulerContext) Log(message string) {
-	_, fn, line, _ := runtime.Caller(1)
-	fns := strings.Split(fn, "/")
-	fmt.Println("Scheduler:", fns[len(fns)-1], line, message)
+	ctx.logger.WithCallerSkip(1).Info(message)
+}
+
+// Logger return logger with the fields of this context, such as trace_id
+func (ctx *SchedulerContext) Logger() ILogger {
+	return ctx.logger
 }
 
 // Param return parameter by name (empty in scheduler)
@@ -47,32 +65,72 @@ func (ctx *SchedulerContext) ReadInputs() []string {
 	return nil
 }
 
+// ReadMessage return nil in scheduler
+func (ctx *SchedulerContext) ReadMessage() *Message {
+	return nil
+}
+
+// ReadMessages return nil in scheduler
+func (ctx *SchedulerContext) ReadMessages() []*Message {
+	return nil
+}
+
+// BindInput return error in scheduler (scheduler has no input)
+func (ctx *SchedulerContext) BindInput(v interface{}) error {
+	return fmt.Errorf("BindInput is not supported in Scheduler")
+}
+
+// BindInputs return error in scheduler (scheduler has no input)
+func (ctx *SchedulerContext) BindInputs(v interface{}) error {
+	return fmt.Errorf("BindInputs is not supported in Scheduler")
+}
+
 // Response return response to client
 func (ctx *SchedulerContext) Response(responseCode int, responseData interface{}) {
 	return
 }
 
-// Now return now
+// Now return the scheduled time of this run in timezone of the schedule (not the time that the handler is called),
+// so the missed run that is run later (MisfireCatchUp) see its own time
 func (ctx *SchedulerContext) Now() time.Time {
-	return time.Now()
+	return ctx.scheduled
+}
+
+// Context return the service context, it is cancelled when the service has shutdown
+func (ctx *SchedulerContext) Context() context.Context {
+	return ctx.ctx
+}
+
+func (ctx *SchedulerContext) setContext(c context.Context) {
+	ctx.ctx = c
 }
 
-// Cacher return cacher
+// Cacher return cacher that is bound to the context
 func (ctx *SchedulerContext) Cacher(server string) ICacher {
-	return ctx.ms.getCacher(server)
+	return ctx.ms.getCacher(server).WithContext(ctx.Context())
 }
 
-// Producer return producer
+// Producer return producer that is bound to the context
 func (ctx *SchedulerContext) Producer(servers string) IProducer {
-	return ctx.ms.getProducer(servers)
+	return ctx.ms.getProducer(servers).WithContext(ctx.Context())
 }
 
-// MQ return MQ
+// MQ return MQ that is bound to the context
 func (ctx *SchedulerContext) MQ(servers string) IMQ {
-	return NewMQ(servers, ctx.ms)
+	return NewMQ(servers, ctx.ms).WithContext(ctx.Context())
 }
 
-// Requester return Requester
+// Requester return Requester that is bound to the context
 func (ctx *SchedulerContext) Requester(baseURL string, timeout time.Duration) IRequester {
-	return NewRequester(baseURL, timeout, ctx.ms)
+	return NewRequester(baseURL, timeout, ctx.ms).WithContext(ctx.Context())
+}
+
+// Metrics return business metrics, they are exposed with the built-in metrics
+func (ctx *SchedulerContext) Metrics() IMetrics {
+	return ctx.ms.Metrics()
+}
+
+// Span return span of this context, handler can add attributes to it
+func (ctx *SchedulerContext) Span() *Span {
+	return ctx.span
 }
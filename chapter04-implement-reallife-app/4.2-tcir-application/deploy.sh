@@ -7,6 +7,17 @@ TIMESTAMP=20210118001006
 DEPLOY_ENV=prd
 DOCKER_REPOSITORY=3dsinteractive
 
+# Modules are pinned to the versions that build with Go 1.14 (the version of the build image),
+# go get resolve the other modules to the latest versions
+GO_MODULES=(
+    github.com/hamba/avro@v1.6.6
+    google.golang.org/protobuf@v1.27.1
+    github.com/go-playground/validator/v10@v10.2.0
+    github.com/prometheus/client_golang@v1.8.0
+    github.com/robfig/cron/v3@v3.0.1
+    github.com/alicebob/miniredis/v2@v2.14.3
+)
+
 # 2. commit will push docker image to repository
 function commit() {
     local IMAGE=$1
@@ -22,10 +33,12 @@ function build_api() {
     GO=/usr/local/go/bin/go
     if [ -f "$GO" ]; then
         /usr/local/go/bin/go mod init automationworkshop/main
+        /usr/local/go/bin/go get "${GO_MODULES[@]}"
         /usr/local/go/bin/go get
         /usr/local/go/bin/go mod vendor
     else 
         go mod init automationworkshop/main
+        go get "${GO_MODULES[@]}"
         go get
         go mod vendor
     fi
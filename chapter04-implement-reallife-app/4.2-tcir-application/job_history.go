@@ -0,0 +1,326 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// maxJobRuns is the number of latest runs that are kept per schedule
+	maxJobRuns = 100
+	// jobRunTTL is how long the run is kept in Redis
+	jobRunTTL = 30 * 24 * time.Hour
+	// maxJobRunLogs is the number of the last log lines that are kept in run
+	maxJobRunLogs = 50
+	// maxJobRunLogLength is the max length of each log lines in run
+	maxJobRunLogLength = 500
+)
+
+// Job run statuses
+const (
+	JobRunRunning = "running"
+	JobRunSuccess = "success"
+	JobRunFailed  = "failed"
+	// JobRunMissed is the run that has been skipped by misfire policy
+	JobRunMissed = "missed"
+)
+
+// Job run triggers
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// JobRun is the record of scheduler run
+type JobRun struct {
+	ID            string    `json:"id"`
+	Schedule      string    `json:"schedule"`
+	ScheduledTime time.Time `json:"scheduled_time"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end,omitempty"`
+	DurationMs    int64     `json:"duration_ms"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	Trigger       string    `json:"trigger"`
+	Instance      string    `json:"instance"`
+	TraceID       string    `json:"trace_id,omitempty"`
+	Logs          []string  `json:"logs,omitempty"`
+}
+
+// IJobStore is interface to persist scheduler runs and the paused schedules, it is shared by every instances
+type IJobStore interface {
+	// SaveRun insert or update run by ID, it is called when the run has started and ended
+	SaveRun(run *JobRun) error
+	// ListRuns return the latest runs of schedule, the latest first
+	ListRuns(schedule string, limit int) ([]*JobRun, error)
+	SetPaused(schedule string, paused bool) error
+	IsPaused(schedule string) (bool, error)
+}
+
+// MemoryJobStore implement IJobStore in memory, the runs are lost when the service has restarted
+// and they are not shared between instances, it is the default store
+type MemoryJobStore struct {
+	runs   map[string][]*JobRun
+	paused map[string]bool
+	mutex  sync.Mutex
+}
+
+// NewMemoryJobStore return new MemoryJobStore
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		runs:   map[string][]*JobRun{},
+		paused: map[string]bool{},
+	}
+}
+
+// SaveRun insert or update run
+func (store *MemoryJobStore) SaveRun(run *JobRun) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	saved := *run
+	runs := store.runs[run.Schedule]
+	for i, r := range runs {
+		if r.ID == run.ID {
+			runs[i] = &saved
+			return nil
+		}
+	}
+	runs = append(runs, &saved)
+	if len(runs) > maxJobRuns {
+		runs = runs[len(runs)-maxJobRuns:]
+	}
+	store.runs[run.Schedule] = runs
+	return nil
+}
+
+// ListRuns return the latest runs of schedule
+func (store *MemoryJobStore) ListRuns(schedule string, limit int) ([]*JobRun, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	runs := store.runs[schedule]
+	result := []*JobRun{}
+	for i := len(runs) - 1; i >= 0 && len(result) < limit; i-- {
+		run := *runs[i]
+		result = append(result, &run)
+	}
+	return result, nil
+}
+
+// SetPaused pause or resume schedule
+func (store *MemoryJobStore) SetPaused(schedule string, paused bool) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.paused[schedule] = paused
+	return nil
+}
+
+// IsPaused return true if schedule has paused
+func (store *MemoryJobStore) IsPaused(schedule string) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.paused[schedule], nil
+}
+
+// RedisJobStore implement IJobStore with Redis, every runs are kept as JSON for 30 days
+// and the latest 100 run ids of each schedules are kept in sorted set by start time
+type RedisJobStore struct {
+	ms     *Microservice
+	server string
+}
+
+// NewRedisJobStore return store that use the cacher of service (the same connection as ctx.Cacher)
+func NewRedisJobStore(cacheServer string, ms *Microservice) *RedisJobStore {
+	return &RedisJobStore{
+		ms:     ms,
+		server: cacheServer,
+	}
+}
+
+func (store *RedisJobStore) client() (*redis.Client, error) {
+	cache, ok := store.ms.getCacher(store.server).(*Cacher)
+	if !ok {
+		return nil, fmt.Errorf("RedisJobStore require Redis cacher")
+	}
+	return cache.getClient()
+}
+
+func jobRunsKey(schedule string) string {
+	return "jobs:{" + schedule + "}:runs"
+}
+
+func jobRunKey(schedule string, id string) string {
+	return "jobs:{" + schedule + "}:run:" + id
+}
+
+func jobPausedKey(schedule string) string {
+	return "jobs:{" + schedule + "}:paused"
+}
+
+// SaveRun insert or update run
+func (store *RedisJobStore) SaveRun(run *JobRun) error {
+	c, err := store.client()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	_, err = c.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(jobRunKey(run.Schedule, run.ID), value, jobRunTTL)
+		pipe.ZAdd(jobRunsKey(run.Schedule), redis.Z{Score: float64(run.Start.UnixNano()), Member: run.ID})
+		// The removed runs are expired by TTL
+		pipe.ZRemRangeByRank(jobRunsKey(run.Schedule), 0, -maxJobRuns-1)
+		return nil
+	})
+	return err
+}
+
+// ListRuns return the latest runs of schedule
+func (store *RedisJobStore) ListRuns(schedule string, limit int) ([]*JobRun, error) {
+	c, err := store.client()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := c.ZRevRange(jobRunsKey(schedule), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*JobRun{}, nil
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, jobRunKey(schedule, id))
+	}
+	values, err := c.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*JobRun, 0, len(values))
+	for _, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			// The run has expired
+			continue
+		}
+		run := &JobRun{}
+		err := json.Unmarshal([]byte(str), run)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// SetPaused pause or resume schedule
+func (store *RedisJobStore) SetPaused(schedule string, paused bool) error {
+	c, err := store.client()
+	if err != nil {
+		return err
+	}
+	if paused {
+		return c.Set(jobPausedKey(schedule), "1", 0).Err()
+	}
+	return c.Del(jobPausedKey(schedule)).Err()
+}
+
+// IsPaused return true if schedule has paused
+func (store *RedisJobStore) IsPaused(schedule string) (bool, error) {
+	c, err := store.client()
+	if err != nil {
+		return false, err
+	}
+	n, err := c.Exists(jobPausedKey(schedule)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// runLogCapture keep the last log lines of run
+type runLogCapture struct {
+	lines []string
+	mutex sync.Mutex
+}
+
+func (capture *runLogCapture) add(level LogLevel, message string) {
+	if len(message) > maxJobRunLogLength {
+		message = message[:maxJobRunLogLength] + "..."
+	}
+	line := fmt.Sprintf("%s %s %s", time.Now().UTC().Format("15:04:05.000"), level.String(), message)
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+	capture.lines = append(capture.lines, line)
+	if len(capture.lines) > maxJobRunLogs {
+		capture.lines = capture.lines[len(capture.lines)-maxJobRunLogs:]
+	}
+}
+
+func (capture *runLogCapture) excerpt() []string {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+	return append([]string{}, capture.lines...)
+}
+
+// captureLogger implement ILogger, it write to logger and keep the lines in capture
+type captureLogger struct {
+	logger  ILogger
+	capture *runLogCapture
+}
+
+// newCaptureLogger return logger that keep the lines in capture, the caller is skipped for this wrapper
+func newCaptureLogger(logger ILogger, capture *runLogCapture) ILogger {
+	return &captureLogger{
+		logger:  logger.WithCallerSkip(1),
+		capture: capture,
+	}
+}
+
+func (l *captureLogger) log(level LogLevel, message string) {
+	if level >= l.logger.Level() {
+		l.capture.add(level, message)
+	}
+}
+
+func (l *captureLogger) Debug(message string) {
+	l.log(LogLevelDebug, message)
+	l.logger.Debug(message)
+}
+
+func (l *captureLogger) Info(message string) {
+	l.log(LogLevelInfo, message)
+	l.logger.Info(message)
+}
+
+func (l *captureLogger) Warn(message string) {
+	l.log(LogLevelWarn, message)
+	l.logger.Warn(message)
+}
+
+func (l *captureLogger) Error(message string) {
+	l.log(LogLevelError, message)
+	l.logger.Error(message)
+}
+
+func (l *captureLogger) With(fields LogFields) ILogger {
+	return &captureLogger{logger: l.logger.With(fields), capture: l.capture}
+}
+
+func (l *captureLogger) WithCallerSkip(skip int) ILogger {
+	return &captureLogger{logger: l.logger.WithCallerSkip(skip), capture: l.capture}
+}
+
+func (l *captureLogger) Level() LogLevel {
+	return l.logger.Level()
+}
+
+func (l *captureLogger) SetLevel(level LogLevel) {
+	l.logger.SetLevel(level)
+}
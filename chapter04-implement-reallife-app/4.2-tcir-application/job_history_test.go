@@ -0,0 +1,216 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJobStores return every job stores, the Redis store use in-memory Redis that is closed by the returned function
+func testJobStores(t *testing.T) (map[string]IJobStore, func()) {
+	cacher, mr := newTestCacher(t)
+	ms := cacher.ms
+	ms.cacher = cacher
+	stores := map[string]IJobStore{
+		"memory": NewMemoryJobStore(),
+		"redis":  NewRedisJobStore(mr.Addr(), ms),
+	}
+	return stores, func() {
+		cacher.Close()
+		mr.Close()
+	}
+}
+
+func testJobRun(i int, start time.Time) *JobRun {
+	return &JobRun{
+		ID:       fmt.Sprintf("run-%d", i),
+		Schedule: "job",
+		Start:    start.Add(time.Duration(i) * time.Minute),
+		Status:   JobRunRunning,
+		Trigger:  JobTriggerSchedule,
+	}
+}
+
+// jobRunIDs return ids of runs in order, so the results can be compared
+func jobRunIDs(runs []*JobRun) []string {
+	ids := []string{}
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	return ids
+}
+
+func TestJobStoreListRuns(t *testing.T) {
+	stores, closeStores := testJobStores(t)
+	defer closeStores()
+	start := mustParseTime(t, "2021-01-18T10:00:00Z")
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			// Only the last 100 runs are kept
+			for i := 0; i < maxJobRuns+5; i++ {
+				err := store.SaveRun(testJobRun(i, start))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			runs, err := store.ListRuns("job", maxJobRuns+10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := jobRunIDs(runs)
+			if len(ids) != maxJobRuns || ids[0] != "run-104" || ids[len(ids)-1] != "run-5" {
+				t.Errorf("ListRuns() = %d runs from %s to %s, want 100 runs from run-104 to run-5", len(ids), ids[0], ids[len(ids)-1])
+			}
+
+			// The latest first, up to limit
+			runs, err = store.ListRuns("job", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(jobRunIDs(runs)); got != "[run-104 run-103 run-102]" {
+				t.Errorf("ListRuns() = %s, want [run-104 run-103 run-102]", got)
+			}
+
+			// The run is updated by id when it has ended
+			ended := testJobRun(103, start)
+			ended.Status = JobRunSuccess
+			ended.DurationMs = 1500
+			err = store.SaveRun(ended)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs, err = store.ListRuns("job", maxJobRuns+10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != maxJobRuns || runs[1].ID != "run-103" || runs[1].Status != JobRunSuccess || runs[1].DurationMs != 1500 {
+				t.Errorf("ListRuns() = %d runs, second %+v, want run-103 has updated in place", len(runs), runs[1])
+			}
+
+			// The other schedule has no runs
+			runs, err = store.ListRuns("other", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != 0 {
+				t.Errorf("ListRuns() of the other schedule = %d runs, want 0", len(runs))
+			}
+		})
+	}
+}
+
+func TestJobStorePaused(t *testing.T) {
+	stores, closeStores := testJobStores(t)
+	defer closeStores()
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			steps := []struct {
+				paused bool
+				want   map[string]bool
+			}{
+				{true, map[string]bool{"job": true, "other": false}},
+				{true, map[string]bool{"job": true, "other": false}},
+				{false, map[string]bool{"job": false, "other": false}},
+			}
+			for i, step := range steps {
+				err := store.SetPaused("job", step.paused)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for schedule, want := range step.want {
+					got, err := store.IsPaused(schedule)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got != want {
+						t.Errorf("step %d IsPaused(%s) = %v, want %v", i, schedule, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryJobStoreReturnCopies(t *testing.T) {
+	store := NewMemoryJobStore()
+	run := testJobRun(1, time.Now())
+	err := store.SaveRun(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.Status = JobRunFailed
+	runs, _ := store.ListRuns("job", 1)
+	runs[0].Status = JobRunMissed
+
+	runs, _ = store.ListRuns("job", 1)
+	if runs[0].Status != JobRunRunning {
+		t.Errorf("Status = %s, want the status that has been saved", runs[0].Status)
+	}
+}
+
+func TestRunLogCapture(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []string
+		wantLines int
+		wantFirst string
+		wantLast  string
+	}{
+		{"short line", []string{"started"}, 1, "info started", "info started"},
+		{"long line is truncated", []string{strings.Repeat("a", maxJobRunLogLength+100)}, 1,
+			"info " + strings.Repeat("a", maxJobRunLogLength) + "...", "info " + strings.Repeat("a", maxJobRunLogLength) + "..."},
+		{"line at max length is kept", []string{strings.Repeat("b", maxJobRunLogLength)}, 1,
+			"info " + strings.Repeat("b", maxJobRunLogLength), "info " + strings.Repeat("b", maxJobRunLogLength)},
+	}
+	lines := []string{}
+	for i := 0; i < maxJobRunLogs+10; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	tests = append(tests, struct {
+		name      string
+		messages  []string
+		wantLines int
+		wantFirst string
+		wantLast  string
+	}{"only the last 50 lines are kept", lines, maxJobRunLogs, "info line 10", "info line 59"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture := &runLogCapture{}
+			for _, message := range tt.messages {
+				capture.add(LogLevelInfo, message)
+			}
+			excerpt := capture.excerpt()
+			if len(excerpt) != tt.wantLines {
+				t.Fatalf("excerpt = %d lines, want %d", len(excerpt), tt.wantLines)
+			}
+			// Each lines start with time (15:04:05.000)
+			first, last := excerpt[0][13:], excerpt[len(excerpt)-1][13:]
+			if first != tt.wantFirst || last != tt.wantLast {
+				t.Errorf("excerpt = %.40s ... %.40s, want %.40s ... %.40s", first, last, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestCaptureLogger(t *testing.T) {
+	sink := NewCaptureLogSink()
+	capture := &runLogCapture{}
+	logger := newCaptureLogger(NewLogger(sink, LogLevelInfo), capture).With(LogFields{"schedule": "job"})
+
+	logger.Debug("dropped")
+	logger.Info("info")
+	logger.Error("error")
+
+	// The lines below the level are not kept, as they are not written
+	if got := len(capture.excerpt()); got != 2 {
+		t.Errorf("excerpt = %d lines, want 2", got)
+	}
+	if got := logMessages(sink.Entries()); got != "[info:info error:error]" {
+		t.Errorf("entries = %s, want [info:info error:error]", got)
+	}
+}
@@ -0,0 +1,214 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	// ErrLockNotAcquired is returned when the lock is held by the other owner
+	ErrLockNotAcquired = errors.New("Lock is held by the other owner")
+	// ErrLockNotHeld is returned when the lock has expired or has been acquired by the other owner
+	ErrLockNotHeld = errors.New("Lock is not held by this owner")
+)
+
+const (
+	lockRetryMinBackoff = 50 * time.Millisecond
+	lockRetryMaxBackoff = time.Second
+)
+
+// acquireLockScript set lock key with owner if it does not exist, and return the next fencing token (0 if not acquired)
+// KEYS[1] = lock key, KEYS[2] = fencing token key, ARGV[1] = owner, ARGV[2] = lease in milliseconds
+var acquireLockScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// refreshLockScript extend lease of lock key only if it is held by owner
+var refreshLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript delete lock key only if it is held by owner, so the lock that has expired
+// and has been acquired by the other owner is not released
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// ILock is the distributed lock, it is held until Release or the lease has expired (such as the owner has died)
+type ILock interface {
+	// Key return the name of lock
+	Key() string
+	// Token return fencing token, it is increased every time the lock is acquired, so the storage can reject
+	// the write from the owner that has lost the lock (the write with token lower than the last token)
+	Token() int64
+	// Refresh extend lease, it return ErrLockNotHeld if the lock has been lost
+	Refresh(lease time.Duration) error
+	// Release release the lock, it return ErrLockNotHeld if the lock has been lost
+	Release() error
+}
+
+// Lock implement ILock with Redis
+type Lock struct {
+	cache *Cacher
+	key   string
+	owner string
+	token int64
+}
+
+// lockKeys return Redis keys of lock and fencing token, they have the same hash tag so they are in the same slot
+func lockKeys(key string) []string {
+	return []string{"lock:{" + key + "}", "lock:{" + key + "}:token"}
+}
+
+// Key return the name of lock
+func (lock *Lock) Key() string {
+	return lock.key
+}
+
+// Token return fencing token
+func (lock *Lock) Token() int64 {
+	return lock.token
+}
+
+// Refresh extend lease of the lock
+func (lock *Lock) Refresh(lease time.Duration) error {
+	c, err := lock.cache.getClient()
+	if err != nil {
+		return err
+	}
+	ok, err := refreshLockScript.Run(c, lockKeys(lock.key)[:1], lock.owner, lease.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release release the lock
+func (lock *Lock) Release() error {
+	c, err := lock.cache.getClient()
+	if err != nil {
+		return err
+	}
+	ok, err := releaseLockScript.Run(c, lockKeys(lock.key)[:1], lock.owner).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// KeepAlive refresh lease of lock every lease/3 until ctx is done, it call lost (if not nil) when the lock has been lost,
+// it is used when the work can take longer than the lease
+func KeepAlive(ctx context.Context, lock ILock, lease time.Duration, lost func(err error)) {
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := lock.Refresh(lease)
+			if err == ErrLockNotHeld {
+				if lost != nil {
+					lost(err)
+				}
+				return
+			}
+			// The other errors (such as timeout) are retried, the lock is lost only when the lease has expired
+		}
+	}
+}
+
+type lockContextKey struct{}
+
+// contextWithLock return ctx that carry lock, so handler can read the fencing token
+func contextWithLock(ctx context.Context, lock ILock) context.Context {
+	return context.WithValue(ctx, lockContextKey{}, lock)
+}
+
+// LockFromContext return lock that ctx carry (such as the lock of singleton schedule), or nil
+func LockFromContext(ctx context.Context) ILock {
+	if ctx == nil {
+		return nil
+	}
+	lock, _ := ctx.Value(lockContextKey{}).(ILock)
+	return lock
+}
+
+// TryLock acquire lock by key with lease, it return ErrLockNotAcquired if the lock is held by the other owner
+// The lock is acquired with the connection of this cacher, but it can be released after the context has done
+func (cache *Cacher) TryLock(key string, lease time.Duration) (ILock, error) {
+	if lease < time.Millisecond {
+		return nil, fmt.Errorf("Lease of lock %s must be at least 1ms", key)
+	}
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+	owner := newHexID(32)
+	token, err := acquireLockScript.Run(c, lockKeys(key), owner, lease.Milliseconds()).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, ErrLockNotAcquired
+	}
+	return &Lock{
+		cache: cache.root(),
+		key:   key,
+		owner: owner,
+		token: token,
+	}, nil
+}
+
+// Lock acquire lock by key with lease, it wait until the lock is acquired, wait has passed (ErrLockNotAcquired)
+// or the context of cacher is done
+func (cache *Cacher) Lock(key string, lease time.Duration, wait time.Duration) (ILock, error) {
+	ctx := cache.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	deadline := time.Now().Add(wait)
+	backoff := lockRetryMinBackoff
+	for {
+		lock, err := cache.TryLock(key, lease)
+		if err != ErrLockNotAcquired {
+			return lock, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ErrLockNotAcquired
+		}
+		if backoff > remaining {
+			backoff = remaining
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		if backoff > lockRetryMaxBackoff {
+			backoff = lockRetryMaxBackoff
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestCacher return cacher that is connected to in-memory Redis, the lease and expire are passed with FastForward
+func newTestCacher(t *testing.T) (*Cacher, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := NewMicroservice()
+	ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+	return NewCacher(mr.Addr(), ms), mr
+}
+
+func TestTryLock(t *testing.T) {
+	cacher, mr := newTestCacher(t)
+	defer mr.Close()
+	defer cacher.Close()
+
+	first, err := cacher.TryLock("job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cacher.TryLock("job", time.Minute)
+	if err != ErrLockNotAcquired {
+		t.Errorf("TryLock() of held lock error = %v, want ErrLockNotAcquired", err)
+	}
+	other, err := cacher.TryLock("other-job", time.Minute)
+	if err != nil {
+		t.Errorf("TryLock() of the other key error = %v", err)
+	} else if other.Token() != 1 {
+		t.Errorf("Token() of the other key = %d, want 1", other.Token())
+	}
+
+	err = first.Refresh(time.Minute)
+	if err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	err = first.Release()
+	if err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+	err = first.Release()
+	if err != ErrLockNotHeld {
+		t.Errorf("Release() of released lock error = %v, want ErrLockNotHeld", err)
+	}
+
+	second, err := cacher.TryLock("job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Token() <= first.Token() {
+		t.Errorf("Token() = %d after %d, want increased token", second.Token(), first.Token())
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	tests := []struct {
+		name string
+		lose func(mr *miniredis.Miniredis)
+	}{
+		{"lease has expired", func(mr *miniredis.Miniredis) { mr.FastForward(2 * time.Second) }},
+		{"lock key is deleted", func(mr *miniredis.Miniredis) { mr.Del(lockKeys("job")[0]) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacher, mr := newTestCacher(t)
+			defer mr.Close()
+			defer cacher.Close()
+
+			lost, err := cacher.TryLock("job", time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.lose(mr)
+
+			// The other owner acquire the lock with higher fencing token
+			owner, err := cacher.TryLock("job", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owner.Token() <= lost.Token() {
+				t.Errorf("Token() = %d after %d, want increased token", owner.Token(), lost.Token())
+			}
+
+			// The owner that has lost the lock cannot refresh or release the lock of the other owner
+			if err := lost.Refresh(time.Minute); err != ErrLockNotHeld {
+				t.Errorf("Refresh() of lost lock error = %v, want ErrLockNotHeld", err)
+			}
+			if err := lost.Release(); err != ErrLockNotHeld {
+				t.Errorf("Release() of lost lock error = %v, want ErrLockNotHeld", err)
+			}
+			if err := owner.Release(); err != nil {
+				t.Errorf("Release() of the other owner error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	tests := []struct {
+		name         string
+		releaseAfter time.Duration
+		wait         time.Duration
+		wantErr      error
+	}{
+		{"lock is free", 0, 0, nil},
+		{"lock is not released before wait", time.Second, 100 * time.Millisecond, ErrLockNotAcquired},
+		{"lock is released while waiting", 100 * time.Millisecond, 2 * time.Second, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacher, mr := newTestCacher(t)
+			defer mr.Close()
+			defer cacher.Close()
+
+			if tt.releaseAfter > 0 {
+				held, err := cacher.TryLock("job", time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				timer := time.AfterFunc(tt.releaseAfter, func() { held.Release() })
+				defer timer.Stop()
+			}
+
+			lock, err := cacher.Lock("job", time.Minute, tt.wait)
+			if err != tt.wantErr {
+				t.Fatalf("Lock() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && lock.Key() != "job" {
+				t.Errorf("Key() = %s, want job", lock.Key())
+			}
+		})
+	}
+}
+
+func TestLockWaitCancelled(t *testing.T) {
+	cacher, mr := newTestCacher(t)
+	defer mr.Close()
+	defer cacher.Close()
+
+	_, err := cacher.TryLock("job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = cacher.WithContext(ctx).Lock("job", time.Minute, time.Minute)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Lock() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestTryLockLease(t *testing.T) {
+	cacher, mr := newTestCacher(t)
+	defer mr.Close()
+	defer cacher.Close()
+
+	_, err := cacher.TryLock("job", time.Microsecond)
+	if err == nil {
+		t.Errorf("TryLock() with lease less than 1ms has no error")
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	cacher, mr := newTestCacher(t)
+	defer mr.Close()
+	defer cacher.Close()
+
+	lock, err := cacher.TryLock("job", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lostErr := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		KeepAlive(context.Background(), lock, 30*time.Millisecond, func(err error) { lostErr <- err })
+		close(done)
+	}()
+
+	// The lease is refreshed to 30ms
+	time.Sleep(50 * time.Millisecond)
+	if ttl := mr.TTL(lockKeys("job")[0]); ttl > 30*time.Millisecond {
+		t.Errorf("TTL() = %s, want refreshed lease", ttl)
+	}
+
+	// The lock is acquired by the other owner, KeepAlive call lost and stop
+	mr.Del(lockKeys("job")[0])
+	mr.Set(lockKeys("job")[0], "other")
+	select {
+	case err := <-lostErr:
+		if err != ErrLockNotHeld {
+			t.Errorf("lost error = %v, want ErrLockNotHeld", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive has not called lost")
+	}
+	<-done
+}
+
+func TestLockFromContext(t *testing.T) {
+	lock := &Lock{key: "job", token: 3}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want ILock
+	}{
+		{"nil context", nil, nil},
+		{"context without lock", context.Background(), nil},
+		{"context with lock", contextWithLock(context.Background(), lock), lock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LockFromContext(tt.ctx); got != tt.want {
+				t.Errorf("LockFromContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel is the severity of log entry, the entries below the logger level are not written
+type LogLevel int32
+
+// Log levels
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// String return name of level that is written in log entry
+func (level LogLevel) String() string {
+	switch level {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(level))
+}
+
+// ParseLogLevel return level by name (debug, info, warn or error)
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LogLevelDebug, nil
+	case "info", "":
+		return LogLevelInfo, nil
+	case "warn", "warning":
+		return LogLevelWarn, nil
+	case "error":
+		return LogLevelError, nil
+	}
+	return LogLevelInfo, fmt.Errorf("Unknown log level %s", name)
+}
+
+// LogFields is the structured fields of log entry
+type LogFields map[string]interface{}
+
+// LogEntry is the log entry that is sent to sink
+type LogEntry struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+	Caller  string
+	Fields  LogFields
+}
+
+// ILogSink is interface to write log entries, Write can be called from many goroutines
+type ILogSink interface {
+	Write(entry *LogEntry)
+}
+
+// ILogger is interface for structured and leveled logger
+type ILogger interface {
+	Debug(message string)
+	Info(message string)
+	Warn(message string)
+	Error(message string)
+
+	// With return logger that add fields to every entries, the level is shared with this logger
+	With(fields LogFields) ILogger
+	// WithCallerSkip return logger that skip more stack frames to find the caller, it is used by log wrappers
+	WithCallerSkip(skip int) ILogger
+	Level() LogLevel
+	SetLevel(level LogLevel)
+}
+
+// Logger implement ILogger
+type Logger struct {
+	level      *int32
+	sink       ILogSink
+	fields     LogFields
+	callerSkip int
+}
+
+// NewLogger return logger that write entries at level and above to sink
+func NewLogger(sink ILogSink, level LogLevel) *Logger {
+	l := int32(level)
+	return &Logger{
+		level:  &l,
+		sink:   sink,
+		fields: LogFields{},
+	}
+}
+
+// Debug log message at debug level
+func (logger *Logger) Debug(message string) {
+	logger.log(2, LogLevelDebug, message)
+}
+
+// Info log message at info level
+func (logger *Logger) Info(message string) {
+	logger.log(2, LogLevelInfo, message)
+}
+
+// Warn log message at warn level
+func (logger *Logger) Warn(message string) {
+	logger.log(2, LogLevelWarn, message)
+}
+
+// Error log message at error level
+func (logger *Logger) Error(message string) {
+	logger.log(2, LogLevelError, message)
+}
+
+// With return logger that add fields to every entries, the fields override the existing fields with the same name
+func (logger *Logger) With(fields LogFields) ILogger {
+	merged := make(LogFields, len(logger.fields)+len(fields))
+	for key, value := range logger.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Logger{
+		level:      logger.level,
+		sink:       logger.sink,
+		fields:     merged,
+		callerSkip: logger.callerSkip,
+	}
+}
+
+// WithCallerSkip return logger that skip more stack frames to find the caller
+func (logger *Logger) WithCallerSkip(skip int) ILogger {
+	return &Logger{
+		level:      logger.level,
+		sink:       logger.sink,
+		fields:     logger.fields,
+		callerSkip: logger.callerSkip + skip,
+	}
+}
+
+// Level return current level
+func (logger *Logger) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(logger.level))
+}
+
+// SetLevel change level of this logger and every loggers that are derived from it by With
+func (logger *Logger) SetLevel(level LogLevel) {
+	atomic.StoreInt32(logger.level, int32(level))
+}
+
+// log write entry, skip is the number of stack frames to the caller that is written in entry
+func (logger *Logger) log(skip int, level LogLevel, message string) {
+	if level < logger.Level() {
+		return
+	}
+	caller := ""
+	_, fn, line, ok := runtime.Caller(skip + logger.callerSkip)
+	if ok {
+		fns := strings.Split(fn, "/")
+		caller = fmt.Sprintf("%s:%d", fns[len(fns)-1], line)
+	}
+	logger.sink.Write(&LogEntry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: message,
+		Caller:  caller,
+		Fields:  logger.fields,
+	})
+}
+
+// JSONLogSink implement ILogSink, it write one entry per line in JSON
+type JSONLogSink struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+// NewJSONLogSink return sink that write entries to w (such as os.Stdout)
+func NewJSONLogSink(w io.Writer) *JSONLogSink {
+	return &JSONLogSink{
+		w: w,
+	}
+}
+
+// Write write entry as JSON line, the fields are in the same object as time, level, msg and caller
+func (sink *JSONLogSink) Write(entry *LogEntry) {
+	line := make(map[string]interface{}, len(entry.Fields)+4)
+	for key, value := range entry.Fields {
+		err, ok := value.(error)
+		if ok {
+			// error is marshalled as {} by encoding/json
+			value = err.Error()
+		}
+		line[key] = value
+	}
+	line["time"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	line["level"] = entry.Level.String()
+	line["msg"] = entry.Message
+	line["caller"] = entry.Caller
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"time":   line["time"],
+			"level":  line["level"],
+			"msg":    entry.Message,
+			"caller": entry.Caller,
+			"error":  "Marshal log fields failed: " + err.Error(),
+		})
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.w.Write(append(b, '\n'))
+}
+
+// CaptureLogSink implement ILogSink, it keep entries in memory so the tests can assert them
+type CaptureLogSink struct {
+	entries []*LogEntry
+	mutex   sync.Mutex
+}
+
+// NewCaptureLogSink return new CaptureLogSink
+func NewCaptureLogSink() *CaptureLogSink {
+	return &CaptureLogSink{}
+}
+
+// Write keep entry
+func (sink *CaptureLogSink) Write(entry *LogEntry) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.entries = append(sink.entries, entry)
+}
+
+// Entries return copy of the captured entries
+func (sink *CaptureLogSink) Entries() []*LogEntry {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]*LogEntry{}, sink.entries...)
+}
+
+// Reset remove the captured entries
+func (sink *CaptureLogSink) Reset() {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.entries = nil
+}
@@ -0,0 +1,213 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// logMessages return messages of entries in order, so the results can be compared
+func logMessages(entries []*LogEntry) string {
+	messages := []string{}
+	for _, entry := range entries {
+		messages = append(messages, entry.Level.String()+":"+entry.Message)
+	}
+	return fmt.Sprint(messages)
+}
+
+// callerLine return file:line of the line before the caller, it is the line that has logged
+func callerLine() string {
+	_, fn, line, _ := runtime.Caller(1)
+	fns := strings.Split(fn, "/")
+	return fmt.Sprintf("%s:%d", fns[len(fns)-1], line-1)
+}
+
+func TestLoggerLevel(t *testing.T) {
+	tests := []struct {
+		level LogLevel
+		want  []string
+	}{
+		{LogLevelDebug, []string{"debug:d", "info:i", "warn:w", "error:e"}},
+		{LogLevelInfo, []string{"info:i", "warn:w", "error:e"}},
+		{LogLevelWarn, []string{"warn:w", "error:e"}},
+		{LogLevelError, []string{"error:e"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			sink := NewCaptureLogSink()
+			logger := NewLogger(sink, tt.level)
+			logger.Debug("d")
+			logger.Info("i")
+			logger.Warn("w")
+			logger.Error("e")
+			if got := logMessages(sink.Entries()); got != fmt.Sprint(tt.want) {
+				t.Errorf("entries = %s, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerSetLevelOfDerivedLoggers(t *testing.T) {
+	sink := NewCaptureLogSink()
+	logger := NewLogger(sink, LogLevelInfo)
+	child := logger.With(LogFields{"tag": "child"})
+	grandchild := child.WithCallerSkip(1).With(LogFields{"tag": "grandchild"})
+
+	// The level of parent apply to the loggers that are derived from it
+	logger.SetLevel(LogLevelError)
+	child.Warn("dropped")
+	grandchild.Warn("dropped")
+	if got := len(sink.Entries()); got != 0 {
+		t.Errorf("entries = %d, want 0 after SetLevel(error)", got)
+	}
+
+	// The level of derived logger is shared with parent as well
+	grandchild.SetLevel(LogLevelDebug)
+	logger.Debug("written")
+	if logger.Level() != LogLevelDebug || child.Level() != LogLevelDebug {
+		t.Errorf("Level() = %s %s, want debug", logger.Level(), child.Level())
+	}
+	if got := logMessages(sink.Entries()); got != "[debug:written]" {
+		t.Errorf("entries = %s, want [debug:written]", got)
+	}
+}
+
+func TestLoggerWith(t *testing.T) {
+	sink := NewCaptureLogSink()
+	logger := NewLogger(sink, LogLevelInfo).With(LogFields{"service_id": "mail", "tag": "MS"})
+	child := logger.With(LogFields{"tag": "Consumer", "topic": "citizen"})
+
+	child.Info("child")
+	logger.Info("parent")
+
+	entries := sink.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(entries))
+	}
+	want := LogFields{"service_id": "mail", "tag": "Consumer", "topic": "citizen"}
+	if fmt.Sprint(entries[0].Fields) != fmt.Sprint(want) {
+		t.Errorf("fields of child = %v, want %v", entries[0].Fields, want)
+	}
+	// The fields of parent are not changed by child
+	want = LogFields{"service_id": "mail", "tag": "MS"}
+	if fmt.Sprint(entries[1].Fields) != fmt.Sprint(want) {
+		t.Errorf("fields of parent = %v, want %v", entries[1].Fields, want)
+	}
+}
+
+func TestLoggerCaller(t *testing.T) {
+	sink := NewCaptureLogSink()
+	ms := NewMicroservice()
+	ms.SetLogger(NewLogger(sink, LogLevelDebug))
+	ctx := NewPTaskContext(ms, context.Background(), "", "ptask-1", "w1", "")
+	logger := NewLogger(sink, LogLevelDebug)
+
+	// The caller is the line that call the logger, not the log wrappers
+	wants := []string{}
+	logger.Info("logger")
+	wants = append(wants, callerLine())
+	ms.Log("MS", "ms.Log")
+	wants = append(wants, callerLine())
+	ms.LogError("MS", errors.New("ms.LogError"))
+	wants = append(wants, callerLine())
+	ctx.Log("ctx.Log")
+	wants = append(wants, callerLine())
+	ctx.Logger().Warn("ctx.Logger")
+	wants = append(wants, callerLine())
+
+	entries := sink.Entries()
+	if len(entries) != len(wants) {
+		t.Fatalf("entries = %d, want %d", len(entries), len(wants))
+	}
+	for i, entry := range entries {
+		if entry.Caller != wants[i] {
+			t.Errorf("caller of %s = %s, want %s", entry.Message, entry.Caller, wants[i])
+		}
+	}
+}
+
+func TestJSONLogSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewLogger(NewJSONLogSink(buf), LogLevelInfo)
+	logger.With(LogFields{"error": errors.New("connection refused"), "partition": 3}).Error("Consume failed")
+	caller := callerLine()
+	logger.Info("next")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %d, want one line per entry", len(lines))
+	}
+	line := map[string]interface{}{}
+	err := json.Unmarshal([]byte(lines[0]), &line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"error":     "connection refused",
+		"partition": float64(3),
+		"level":     "error",
+		"msg":       "Consume failed",
+		"caller":    caller,
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %v", key, line[key], value)
+		}
+	}
+	if _, ok := line["time"].(string); !ok {
+		t.Errorf("time = %v, want RFC3339 time", line["time"])
+	}
+}
+
+func TestLogLevelEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantCode  int
+		wantLevel LogLevel
+	}{
+		{"debug", `{"level":"debug"}`, http.StatusOK, LogLevelDebug},
+		{"case insensitive", `{"level":"WARNING"}`, http.StatusOK, LogLevelWarn},
+		{"empty level", `{"level":""}`, http.StatusBadRequest, LogLevelInfo},
+		{"no level", `{}`, http.StatusBadRequest, LogLevelInfo},
+		{"unknown level", `{"level":"verbose"}`, http.StatusBadRequest, LogLevelInfo},
+		{"invalid json", `{"level":`, http.StatusBadRequest, LogLevelInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := NewMicroservice()
+			ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelInfo))
+			ms.RegisterLogLevelEndpoint("/admin/log-level")
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			ms.echo.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("PUT status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			req = httptest.NewRequest(http.MethodGet, "/admin/log-level", nil)
+			rec = httptest.NewRecorder()
+			ms.echo.ServeHTTP(rec, req)
+			res := logLevelRequest{}
+			err := json.Unmarshal(rec.Body.Bytes(), &res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Level != tt.wantLevel.String() {
+				t.Errorf("GET level = %s, want %s", res.Level, tt.wantLevel)
+			}
+		})
+	}
+}
@@ -4,16 +4,36 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"os"
 	"time"
 )
 
 func main() {
 	cfg := NewConfig()
+	serviceID := cfg.ServiceID()
 
 	ms := NewMicroservice()
+	logLevel, err := ParseLogLevel(cfg.LogLevel())
+	if err != nil {
+		ms.LogError("Main", err)
+	}
+	ms.SetLogger(NewLogger(NewJSONLogSink(os.Stdout), logLevel).With(LogFields{"service_id": serviceID}))
+
+	exporter, err := NewSpanExporter(cfg.TracingExporter(), cfg.TracingEndpoint())
+	if err != nil {
+		ms.LogError("Main", err)
+	}
+	ms.SetTracer(NewTracer(serviceID, exporter, ms))
 	ms.RegisterLivenessProbeEndpoint("/healthz")
+	ms.RegisterReadinessProbeEndpoint("/readyz")
+	ms.RegisterStartupProbeEndpoint("/startupz")
+	ms.RegisterMetricsEndpoint("/metrics")
+	ms.RegisterConsumerLagEndpoint("/consumer-lag")
+	ms.RegisterLogLevelEndpoint("/admin/log-level")
+	ms.RegisterJobAdminEndpoints("/admin/jobs")
 
-	serviceID := cfg.ServiceID()
+	// Every handlers (HTTP, consumer, scheduler) recover from panic, and HTTP requests have request id
+	ms.Use(RecoverMiddleware(), RequestIDMiddleware())
 
 	switch serviceID {
 	case "register-api":
@@ -30,10 +50,23 @@ func main() {
 		start3rdPartyMockAPI(ms, cfg)
 	}
 
-	ms.Start()
+	// Start has logged the error, exit with error so k8s will restart the pod
+	err = ms.Start()
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
 func startRegisterAPI(ms *Microservice, cfg IConfig) {
+	// Readiness: the request is accepted only when the task can be saved and sent to MQ
+	ms.RegisterHealthCheck("redis", 0, ms.CacherHealthCheck(cfg.CacheServer()))
+	ms.RegisterHealthCheck("kafka-producer", 0, ms.ProducerHealthCheck(cfg.MQServers()))
+	ms.WaitFor("redis", ms.CacherHealthCheck(cfg.CacheServer()))
+	ms.WaitFor("kafka", ms.ProducerHealthCheck(cfg.MQServers()))
+
+	// The registration is small JSON, larger body is rejected before it is read
+	ms.Use(BodyLimitMiddleware(1 << 20))
+
 	ms.AsyncPOST("/api/citizen", cfg.CacheServer(), cfg.MQServers(), func(ctx IContext) error {
 		// 1. Read Input (Not using it right now, just for example)
 		input := ctx.ReadInput()
@@ -45,14 +78,20 @@ func startRegisterAPI(ms *Microservice, cfg IConfig) {
 		citizen := map[string]interface{}{
 			"citizen_id": citizenID,
 		}
+		//    Message is keyed by citizen_id, so every event of the same citizen is in order (same partition)
+		//    and correlation-id is sent in header to trace this registration in the downstream services
+		headers := map[string]string{
+			"correlation-id": randString(),
+		}
 		prod := ctx.Producer(cfg.MQServers())
-		err := prod.SendMessage(cfg.CitizenRegisteredTopic(), "", citizen)
+		err := prod.SendMessageWithHeaders(cfg.CitizenRegisteredTopic(), citizenID, citizen, headers)
 		if err != nil {
-			ctx.Log(err.Error())
+			ctx.Logger().Error(err.Error())
 			return err
 		}
 
-		// 3. Response citizenID
+		// 3. Count registered citizens (business metric), then response citizenID
+		ctx.Metrics().IncCounter("tcir_citizen_registered_total", nil)
 		status := map[string]interface{}{
 			"status":     "success",
 			"citizen_id": citizenID,
@@ -67,35 +106,41 @@ func startMailConsumer(ms *Microservice, cfg IConfig) {
 	groupID := "mail-consumer"
 	timeout := time.Duration(-1)
 
+	// Readiness: consumer has joined the group, and the services that the handler depends on are reachable
+	ms.RegisterHealthCheck("kafka-producer", 0, ms.ProducerHealthCheck(cfg.MQServers()))
+	ms.RegisterHealthCheck("consumer-group", 0, ms.ConsumerGroupHealthCheck(groupID))
+	ms.RegisterHealthCheck("citizen-validation-api", 0, HTTPHealthCheck(cfg.CitizenValidationAPI()))
+	ms.WaitFor("kafka", ms.ProducerHealthCheck(cfg.MQServers()))
+	// The messages in dead letter queue are replayed after the validation API has been fixed
+	ms.RegisterDLQReplayEndpoint("/admin/dlq/replay", cfg.MQServers())
+
 	// 1. Create topic "citizen registered" if not exists
-	mq := NewMQ(cfg.MQServers(), ms)
-	mq.CreateTopicR(topic, 5, 1, time.Hour*24*30)
+	//    Topic is created when Kafka is reachable, before the consumer start
+	ms.OnStartup(func() error {
+		mq := NewMQ(cfg.MQServers(), ms)
+		return mq.CreateTopicR(topic, 5, 1, time.Hour*24*30)
+	})
 
 	// 2. Start consumer to consume message from "citizen registered" topic
-	ms.Consume(cfg.MQServers(), topic, groupID, timeout, func(ctx IContext) error {
-		msg := ctx.ReadInput()
-
-		// 3. Parse input to citizen object
-		citizen := &Citizen{}
-		err := json.Unmarshal([]byte(msg), &citizen)
-		if err != nil {
-			ctx.Log(err.Error())
-			return err
-		}
+	//    The message is decoded and validated into citizen object before handler is called,
+	//    the invalid message is sent to dead letter queue
+	err := ms.TypedConsume(cfg.MQServers(), topic, groupID, timeout, func(ctx IContext, citizen *Citizen) error {
+		// 3. Read correlation-id from message header
+		correlationID := ctx.ReadMessage().Header("correlation-id")
 
 		// 4. Call validation API (Response AVG at 1 second, so we set timeout at 5 seconds)
 		req := ctx.Requester("", 5*time.Second)
 		validationResStr, err := req.Post(cfg.CitizenValidationAPI(),
 			map[string]string{"citizen_id": citizen.CitizenID})
 		if err != nil {
-			ctx.Log(err.Error())
+			ctx.Logger().Error(err.Error())
 			return err
 		}
 
 		validationRes := map[string]interface{}{}
 		err = json.Unmarshal([]byte(validationResStr), &validationRes)
 		if err != nil {
-			ctx.Log(err.Error())
+			ctx.Logger().Error(err.Error())
 			return err
 		}
 
@@ -104,59 +149,94 @@ func startMailConsumer(ms *Microservice, cfg IConfig) {
 			// 5. Send Email to citizen to reject register if validation is not OK
 			//    We just log to console, but for the real code, this should send the email
 			ctx.Log("Mail rejection has sent to " + citizen.CitizenID)
+			ctx.Metrics().IncCounter("tcir_citizen_validated_total", map[string]string{"result": "rejected"})
 			return nil
 		}
 
 		// 6. Send Email to citizen to confirm validation
 		//    We just log to console, but for the real code, this should send the email
-		ctx.Log("Mail confirmation has sent to " + citizen.CitizenID)
+		ctx.Log("Mail confirmation has sent to " + citizen.CitizenID + " (correlation-id: " + correlationID + ")")
+		ctx.Metrics().IncCounter("tcir_citizen_validated_total", map[string]string{"result": "confirmed"})
 
-		// 7. Produce message to topic "citizen confirmed"
+		// 7. Produce message to topic "citizen confirmed" (keyed by citizen_id with the same correlation-id)
+		//    This producer is transactional, the message is committed together with the offset of the consumed message
 		prod := ctx.Producer(cfg.MQServers())
-		err = prod.SendMessage(cfg.CitizenConfirmedTopic(), "", citizen)
+		err = prod.SendMessageWithHeaders(cfg.CitizenConfirmedTopic(), citizen.CitizenID, citizen,
+			map[string]string{"correlation-id": correlationID})
 		if err != nil {
-			ctx.Log(err.Error())
+			ctx.Logger().Error(err.Error())
 			return err
 		}
 
 		return nil
-	})
+	},
+		// Citizen registration must not be dropped, failed message will be redelivered after 5 seconds
+		WithAtLeastOnce(5*time.Second),
+		// Consume "citizen registered" and produce "citizen confirmed" in one transaction (no duplicate and no loss)
+		// mail-consumer is StatefulSet, so transactional id is created from its stable pod name (mail-consumer-0, ...)
+		WithTransaction(""),
+		// If validation API has failed, retry after 1 minute, then 10 minutes, then send to dead letter queue
+		WithRetryPolicy(&RetryPolicy{
+			Delays: []time.Duration{time.Minute, 10 * time.Minute},
+		}))
+	if err != nil {
+		ms.LogError("Main", err)
+	}
 }
 
 func startBatchScheduler(ms *Microservice, cfg IConfig) {
-	ms.Schedule(time.Hour, func(ctx IContext) error {
-		// 1. Batch Scheduler will run during 00.00 - 00.59
-		nowH := ctx.Now().Hour()
-		if nowH != 0 {
-			return nil
-		}
+	ms.RegisterHealthCheck("batch-deliver-api", 0, HTTPHealthCheck(cfg.BatchDeliverAPI()))
+	// The lock of singleton schedule and the run history are in Redis, so every replicas share them
+	ms.WaitFor("redis", ms.CacherHealthCheck(cfg.CacheServer()))
+	ms.SetJobStore(NewRedisJobStore(cfg.CacheServer(), ms))
 
+	// 1. Batch Scheduler will run at 00.00 in Thailand, the run that is late (such as the pod has paused)
+	//    is still run if it is late within 1 hour, and it is run on only one replica
+	_, err := ms.ScheduleCron("0 0 * * *", func(ctx IContext) error {
 		// 2. Will start PTask to execute all workers
 		//    This run only 1 time a day, to make sure it will run, use 30 secs timeout
 		rqt := ctx.Requester("", 30*time.Second)
 		res, err := rqt.Post(cfg.BatchDeliverAPI(),
 			map[string]string{"task_id": "batch_deliver", "worker_count": "5"})
 		if err != nil {
-			ctx.Log(err.Error())
+			ctx.Logger().Error(err.Error())
 			return err
 		}
 		ctx.Log(res)
 
 		return nil
-	})
+	},
+		WithScheduleName("batch-deliver"),
+		WithTimezone("Asia/Bangkok"),
+		WithMisfirePolicy(MisfireSkip, time.Hour),
+		WithSingleton(cfg.CacheServer(), 0))
+	if err != nil {
+		ms.LogError("Main", err)
+	}
 }
 
 func startBatchPTaskAPI(ms *Microservice, cfg IConfig) {
+	ms.RegisterHealthCheck("redis", 0, ms.CacherHealthCheck(cfg.CacheServer()))
+	ms.RegisterHealthCheck("kafka-producer", 0, ms.ProducerHealthCheck(cfg.MQServers()))
+	ms.WaitFor("redis", ms.CacherHealthCheck(cfg.CacheServer()))
+	ms.WaitFor("kafka", ms.ProducerHealthCheck(cfg.MQServers()))
+
 	ms.PTaskEndpoint("/ptask/delivery", cfg.CacheServer(), cfg.MQServers())
 }
 
 func startBatchPTaskWorkerNode(ms *Microservice, cfg IConfig) {
+	ms.RegisterHealthCheck("redis", 0, ms.CacherHealthCheck(cfg.CacheServer()))
+	ms.RegisterHealthCheck("kafka-producer", 0, ms.ProducerHealthCheck(cfg.MQServers()))
+	ms.WaitFor("redis", ms.CacherHealthCheck(cfg.CacheServer()))
+	ms.WaitFor("kafka", ms.ProducerHealthCheck(cfg.MQServers()))
+
 	ms.PTaskWorkerNode("/ptask/delivery",
 		cfg.CacheServer(),
 		cfg.MQServers(),
 		func(ctx IContext) error {
 
 			newMS := NewMicroservice()
+			newMS.SetLogger(ms.Logger())
 			newMS.ConsumeBatch(
 				cfg.MQServers(),
 				cfg.CitizenConfirmedTopic(),
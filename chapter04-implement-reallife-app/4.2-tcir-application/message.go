@@ -0,0 +1,44 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Message is the message consumed from message queue with its metadata
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       string
+	Value     string
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// NewMessage convert kafka message into Message
+func NewMessage(msg *kafka.Message) *Message {
+	topic := ""
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+	return &Message{
+		Topic:     topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Key:       string(msg.Key),
+		Value:     string(msg.Value),
+		Headers:   headersMap(msg.Headers),
+		Timestamp: msg.Timestamp,
+	}
+}
+
+// Header return header value by key (empty if not exists)
+func (m *Message) Header(key string) string {
+	if m.Headers == nil {
+		return ""
+	}
+	return m.Headers[key]
+}
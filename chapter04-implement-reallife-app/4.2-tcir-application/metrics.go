@@ -0,0 +1,257 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IMetrics is interface for business metrics, they are exposed with the built-in metrics in Prometheus format
+// The label names of metric must be the same in every calls
+type IMetrics interface {
+	IncCounter(name string, labels map[string]string)
+	AddCounter(name string, value float64, labels map[string]string)
+	SetGauge(name string, value float64, labels map[string]string)
+	AddGauge(name string, value float64, labels map[string]string)
+}
+
+// Metrics implement IMetrics, it also hold the built-in metrics of every service types
+type Metrics struct {
+	ms       *Microservice
+	registry *prometheus.Registry
+
+	httpDuration      *prometheus.HistogramVec
+	consumerDuration  *prometheus.HistogramVec
+	consumerMessages  *prometheus.CounterVec
+	batchSize         *prometheus.HistogramVec
+	batchFlushes      *prometheus.CounterVec
+	schedulerDuration *prometheus.HistogramVec
+	requesterDuration *prometheus.HistogramVec
+	cacherDuration    *prometheus.HistogramVec
+
+	// queues is the topics of AsyncTask and PTask, the queue depth is the lag of their consumers
+	queues     map[string]string
+	queueMutex sync.Mutex
+
+	counters    map[string]*prometheus.CounterVec
+	gauges      map[string]*prometheus.GaugeVec
+	labelNames  map[string]string
+	customMutex sync.Mutex
+}
+
+// NewMetrics return new Metrics with its own registry, so many Microservice can run in the same process
+func NewMetrics(ms *Microservice) *Metrics {
+	m := &Metrics{
+		ms:         ms,
+		registry:   prometheus.NewRegistry(),
+		queues:     map[string]string{},
+		counters:   map[string]*prometheus.CounterVec{},
+		gauges:     map[string]*prometheus.GaugeVec{},
+		labelNames: map[string]string{},
+	}
+
+	m.httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ms_http_request_duration_seconds",
+		Help: "Latency of HTTP requests by route and status code",
+	}, []string{"method", "path", "status"})
+	m.consumerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ms_consumer_handle_duration_seconds",
+		Help: "Latency of consumer handler",
+	}, []string{"group_id", "topic"})
+	m.consumerMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ms_consumer_messages_total",
+		Help: "Number of messages handled by consumer, result is success or error",
+	}, []string{"group_id", "topic", "result"})
+	m.batchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ms_batch_size",
+		Help:    "Number of items in executed batch",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"name"})
+	m.batchFlushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ms_batch_flushes_total",
+		Help: "Number of executed batches by reason (size, timeout, flush, close)",
+	}, []string{"name", "reason"})
+	m.schedulerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ms_scheduler_run_duration_seconds",
+		Help:    "Duration of scheduler runs, result is success or error",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"schedule", "result"})
+	m.requesterDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ms_requester_duration_seconds",
+		Help: "Latency of outbound HTTP requests, status is the response code or error",
+	}, []string{"method", "host", "status"})
+	m.cacherDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ms_cacher_duration_seconds",
+		Help:    "Latency of Redis commands, result is success or error",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"command", "result"})
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.consumerDuration,
+		m.consumerMessages,
+		m.batchSize,
+		m.batchFlushes,
+		m.schedulerDuration,
+		m.requesterDuration,
+		m.cacherDuration,
+		&lagCollector{m: m},
+	)
+	return m
+}
+
+// IncCounter increase counter by 1
+func (m *Metrics) IncCounter(name string, labels map[string]string) {
+	m.AddCounter(name, 1, labels)
+}
+
+// AddCounter add value (must not be negative) to counter
+func (m *Metrics) AddCounter(name string, value float64, labels map[string]string) {
+	names, values := splitLabels(labels)
+	m.customMutex.Lock()
+	defer m.customMutex.Unlock()
+	err := m.checkLabels(name, names)
+	if err != nil {
+		m.ms.LogError("METRICS", err)
+		return
+	}
+	counter, ok := m.counters[name]
+	if !ok {
+		counter = prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: "Business metric " + name}, names)
+		err = m.registry.Register(counter)
+		if err != nil {
+			m.ms.LogError("METRICS", err)
+			return
+		}
+		m.counters[name] = counter
+	}
+	counter.WithLabelValues(values...).Add(value)
+}
+
+// SetGauge set value of gauge
+func (m *Metrics) SetGauge(name string, value float64, labels map[string]string) {
+	gauge := m.gauge(name, labels)
+	if gauge != nil {
+		gauge.Set(value)
+	}
+}
+
+// AddGauge add value (can be negative) to gauge
+func (m *Metrics) AddGauge(name string, value float64, labels map[string]string) {
+	gauge := m.gauge(name, labels)
+	if gauge != nil {
+		gauge.Add(value)
+	}
+}
+
+func (m *Metrics) gauge(name string, labels map[string]string) prometheus.Gauge {
+	names, values := splitLabels(labels)
+	m.customMutex.Lock()
+	defer m.customMutex.Unlock()
+	err := m.checkLabels(name, names)
+	if err != nil {
+		m.ms.LogError("METRICS", err)
+		return nil
+	}
+	gauge, ok := m.gauges[name]
+	if !ok {
+		gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: "Business metric " + name}, names)
+		err = m.registry.Register(gauge)
+		if err != nil {
+			m.ms.LogError("METRICS", err)
+			return nil
+		}
+		m.gauges[name] = gauge
+	}
+	return gauge.WithLabelValues(values...)
+}
+
+// checkLabels return error if metric has been used with the other label names
+func (m *Metrics) checkLabels(name string, names []string) error {
+	joined := strings.Join(names, ",")
+	current, ok := m.labelNames[name]
+	if !ok {
+		m.labelNames[name] = joined
+		return nil
+	}
+	if current != joined {
+		return fmt.Errorf("Metric %s has labels [%s] but got [%s]", name, current, joined)
+	}
+	return nil
+}
+
+// splitLabels return label names (sorted) and their values
+func splitLabels(labels map[string]string) ([]string, []string) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, 0, len(labels))
+	for _, name := range names {
+		values = append(values, labels[name])
+	}
+	return names, values
+}
+
+// watchQueue mark topic as the queue of kind (asynctask, ptask)
+func (m *Metrics) watchQueue(kind string, topic string) {
+	m.queueMutex.Lock()
+	defer m.queueMutex.Unlock()
+	m.queues[topic] = kind
+}
+
+var (
+	consumerLagDesc = prometheus.NewDesc(
+		"ms_consumer_lag",
+		"Number of messages that have not consumed in partition",
+		[]string{"group_id", "topic", "partition"}, nil)
+	queueDepthDesc = prometheus.NewDesc(
+		"ms_task_queue_depth",
+		"Number of AsyncTask and PTask messages that have not consumed",
+		[]string{"kind", "topic"}, nil)
+)
+
+// lagCollector collect consumer lag and queue depth when metrics are scraped,
+// the lags are updated by consumers, so scraping does not call Kafka
+type lagCollector struct {
+	m *Metrics
+}
+
+// Describe send descriptions of lag metrics
+func (lc *lagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- consumerLagDesc
+	ch <- queueDepthDesc
+}
+
+// Collect send consumer lag of every partitions and queue depth of every queues
+func (lc *lagCollector) Collect(ch chan<- prometheus.Metric) {
+	lc.m.queueMutex.Lock()
+	queues := map[string]string{}
+	for topic, kind := range lc.m.queues {
+		queues[topic] = kind
+	}
+	lc.m.queueMutex.Unlock()
+
+	depths := map[string]int64{}
+	for _, lag := range lc.m.ms.ConsumerLags() {
+		if lag.Lag < 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(consumerLagDesc, prometheus.GaugeValue, float64(lag.Lag),
+			lag.GroupID, lag.Topic, fmt.Sprintf("%d", lag.Partition))
+		_, isQueue := queues[lag.Topic]
+		if isQueue {
+			depths[lag.Topic] += lag.Lag
+		}
+	}
+	for topic, kind := range queues {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depths[topic]), kind, topic)
+	}
+}
@@ -2,11 +2,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
-	"runtime"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,25 +19,47 @@ type IMicroservice interface {
 	Start() error
 	Stop()
 	Cleanup() error
+	SetShutdownTimeout(timeout time.Duration)
+	SetStartupTimeout(timeout time.Duration)
 	Log(tag string, message string)
+	LogError(tag string, err error)
+	RegisterCodec(codec ICodec)
+
+	// Middlewares of every services that are registered after Use
+	Use(middlewares ...MiddlewareFunc)
 
 	// HTTP Services
-	GET(path string, h ServiceHandleFunc)
-	POST(path string, h ServiceHandleFunc)
-	PUT(path string, h ServiceHandleFunc)
-	PATCH(path string, h ServiceHandleFunc)
-	DELETE(path string, h ServiceHandleFunc)
+	GET(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc)
+	POST(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc)
+	PUT(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc)
+	PATCH(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc)
+	DELETE(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc)
 
 	// Consumer Services
 	Consume(servers string, topic string, groupID string, readTimeout time.Duration,
-		h ServiceHandleFunc) error
+		h ServiceHandleFunc, opts ...ConsumerOption) error
+	ConsumeTopics(servers string, topics []string, groupID string, readTimeout time.Duration,
+		h ServiceHandleFunc, opts ...ConsumerOption) error
 
 	// Batch Consumer Services
 	ConsumeBatch(servers string, topic string, groupID string, readTimeout time.Duration,
-		batchSize int, batchTimeout time.Duration, h ServiceHandleFunc) error
+		batchSize int, batchTimeout time.Duration, h ServiceHandleFunc, opts ...ConsumerOption) error
+	ConsumeBatchTopics(servers string, topics []string, groupID string, readTimeout time.Duration,
+		batchSize int, batchTimeout time.Duration, h ServiceHandleFunc, opts ...ConsumerOption) error
+
+	// Consumer group rebalance hooks
+	OnPartitionsAssigned(h RebalanceHandleFunc)
+	OnPartitionsRevoked(h RebalanceHandleFunc)
+
+	// Replay dead letter queue of topic back to the topic
+	RegisterDLQReplayEndpoint(path string, mqServers string)
 
 	// Scheduler Services
-	Schedule(timer time.Duration, h ServiceHandleFunc) chan bool /*exit channel*/
+	Schedule(timer time.Duration, h ServiceHandleFunc, opts ...ScheduleOption) chan bool /*exit channel*/
+	ScheduleCron(spec string, h ServiceHandleFunc, opts ...ScheduleOption) (chan bool /*exit channel*/, error)
+	NextScheduleRuns(name string, n int) ([]time.Time, error)
+	SetJobStore(store IJobStore)
+	RegisterJobAdminEndpoints(prefix string)
 
 	// AsyncTask Services
 	AsyncPOST(path string, cacheServer string, mqServers string, h ServiceHandleFunc)
@@ -47,16 +69,89 @@ type IMicroservice interface {
 	PTaskWorkerNode(path string, cacheServer string, mqServers string, h ServiceHandleFunc)
 	PTaskEndpoint(path string, cacheServer string, mqServers string)
 
+	// Typed Services, h is func(ctx IContext, req *T) error or func(ctx IContext, req *T) (R, error)
+	TypedGET(path string, h interface{}, middlewares ...MiddlewareFunc)
+	TypedPOST(path string, h interface{}, middlewares ...MiddlewareFunc)
+	TypedConsume(servers string, topic string, groupID string, readTimeout time.Duration,
+		h interface{}, opts ...ConsumerOption) error
+	TypedConsumeBatch(servers string, topic string, groupID string, readTimeout time.Duration,
+		batchSize int, batchTimeout time.Duration, h interface{}, opts ...ConsumerOption) error
+	TypedAsyncPOST(path string, cacheServer string, mqServers string, h interface{})
+	TypedPTaskWorkerNode(path string, cacheServer string, mqServers string, h interface{})
+
 	// Healthcheck
 	RegisterLivenessProbeEndpoint(path string)
+	RegisterReadinessProbeEndpoint(path string)
+	RegisterHealthCheck(name string, timeout time.Duration, check HealthCheckFunc)
+	HealthChecks() map[string]HealthCheckResult
+
+	// Startup, consumers and schedulers start after every dependencies have responded
+	RegisterStartupProbeEndpoint(path string)
+	WaitFor(name string, check HealthCheckFunc)
+	OnStartup(h func() error)
+	DependencyStatuses() map[string]DependencyStatus
+
+	// Metrics in Prometheus format
+	RegisterMetricsEndpoint(path string)
+	Metrics() IMetrics
+
+	// Structured logging
+	SetLogger(logger ILogger)
+	Logger() ILogger
+	RegisterLogLevelEndpoint(path string)
+
+	// Tracing with W3C trace-context
+	SetTracer(tracer *Tracer)
+	Tracer() *Tracer
+
+	// Consumer lag of every assigned partitions
+	ConsumerLags() []PartitionLag
+	RegisterConsumerLagEndpoint(path string)
 }
 
 // Microservice is the centralized service management
 type Microservice struct {
-	echo        *echo.Echo
-	exitChannel chan bool
-	prod        IProducer
-	cacher      ICacher
+	echo       *echo.Echo
+	prod       IProducer
+	cacher     ICacher
+	depMutex   sync.Mutex
+	codecs     map[string]ICodec
+	codecMutex sync.Mutex
+	logger     ILogger
+	metrics    *Metrics
+	tracer     *Tracer
+
+	middlewares []MiddlewareFunc
+
+	schedules     map[string]*scheduleJob
+	scheduleMutex sync.Mutex
+	jobStore      IJobStore
+
+	onAssigned     []RebalanceHandleFunc
+	onRevoked      []RebalanceHandleFunc
+	members        map[string]map[int]bool
+	memberCount    int
+	rebalanceMutex sync.Mutex
+
+	healthCheckers []*healthChecker
+	healthMutex    sync.Mutex
+
+	started        chan struct{}
+	startupTimeout time.Duration
+	dependencies   []*startupDependency
+	startupHooks   []func() error
+	startupMutex   sync.Mutex
+
+	lags      map[string][]PartitionLag
+	lagMutex  sync.Mutex
+	flowCount int
+
+	stop            chan struct{}
+	stopOnce        sync.Once
+	ctx             context.Context
+	cancel          context.CancelFunc
+	workers         sync.WaitGroup
+	shutdownTimeout time.Duration
 }
 
 // ServiceHandleFunc is the handler for each Microservice
@@ -64,12 +159,28 @@ type ServiceHandleFunc func(ctx IContext) error
 
 // NewMicroservice is the constructor function of Microservice
 func NewMicroservice() *Microservice {
-	return &Microservice{
-		echo: echo.New(),
+	ctx, cancel := context.WithCancel(context.Background())
+	ms := &Microservice{
+		echo:            echo.New(),
+		stop:            make(chan struct{}),
+		started:         make(chan struct{}),
+		schedules:       map[string]*scheduleJob{},
+		jobStore:        NewMemoryJobStore(),
+		startupTimeout:  defaultStartupTimeout,
+		ctx:             ctx,
+		cancel:          cancel,
+		shutdownTimeout: defaultShutdownTimeout,
+		logger:          newDefaultLogger(),
 	}
+	ms.metrics = NewMetrics(ms)
+	ms.tracer = NewTracer("", nil, ms)
+	return ms
 }
 
 func (ms *Microservice) getProducer(mqServers string) IProducer {
+	// Handlers can run concurrently (HTTP, Consumer with Concurrency), so only one producer is created
+	ms.depMutex.Lock()
+	defer ms.depMutex.Unlock()
 	if ms.prod == nil {
 		ms.prod = NewProducer(mqServers, ms)
 	}
@@ -77,84 +188,85 @@ func (ms *Microservice) getProducer(mqServers string) IProducer {
 }
 
 func (ms *Microservice) getCacher(cacheServer string) ICacher {
+	ms.depMutex.Lock()
+	defer ms.depMutex.Unlock()
 	if ms.cacher == nil {
 		ms.cacher = NewCacher(cacheServer, ms)
 	}
 	return ms.cacher
 }
 
-// Start start all registered services
+// Start start all registered services, it block until SIGTERM (or Stop) and return after graceful shutdown
+// HTTP is started immediately (so the probes can response), consumers and schedulers are started
+// after every dependencies have responded, Start return error if they have not responded within startup timeout
 func (ms *Microservice) Start() error {
 
 	httpN := len(ms.echo.Routes())
-	var exitHTTP chan bool
 	if httpN > 0 {
-		exitHTTP = make(chan bool, 1)
 		go func() {
-			ms.startHTTP(exitHTTP)
+			ms.startHTTP()
 		}()
 	}
 
 	// There are 2 ways to exit from Microservices
 	// 1. The SigTerm can be send from outside program such as from k8s
-	// 2. Send true to ms.exitChannel
+	// 2. Call ms.Stop()
 	osQuit := make(chan os.Signal, 1)
-	ms.exitChannel = make(chan bool, 1)
 	signal.Notify(osQuit, syscall.SIGTERM, syscall.SIGINT)
-	exit := false
-	for {
-		if exit {
-			break
+
+	startupErr := make(chan error, 1)
+	go func() {
+		startupErr <- ms.startup()
+	}()
+
+	select {
+	case <-osQuit:
+	case <-ms.stop:
+	case err := <-startupErr:
+		if err != nil {
+			// Exit with error, so k8s will restart the pod
+			ms.LogError("MS", fmt.Errorf("Startup failed: %v", err))
+			ms.shutdown(httpN > 0)
+			return err
 		}
 		select {
 		case <-osQuit:
-			// Exit from HTTP as well
-			if exitHTTP != nil {
-				exitHTTP <- true
-			}
-			exit = true
-		case <-ms.exitChannel:
-			// Exit from HTTP as well
-			if exitHTTP != nil {
-				exitHTTP <- true
-			}
-			exit = true
+		case <-ms.stop:
 		}
 	}
 
-	ms.Cleanup()
-	return nil
+	return ms.shutdown(httpN > 0)
 }
 
-// Stop stop the services
+// Stop stop the services, it can be called many times and from any goroutine
 func (ms *Microservice) Stop() {
-	if ms.exitChannel == nil {
-		return
-	}
-	ms.exitChannel <- true
+	ms.stopOnce.Do(func() {
+		close(ms.stop)
+	})
 }
 
 // Cleanup clean resources up from every registered services before exit
 func (ms *Microservice) Cleanup() error {
 	ms.Log("MS", "Start cleanup")
+	ms.depMutex.Lock()
+	defer ms.depMutex.Unlock()
+	// Producer is closed first, so the messages in queue are flushed before exit
+	if ms.prod != nil {
+		ms.prod.Close()
+	}
 	if ms.cacher != nil {
 		ms.cacher.Close()
 	}
-	if ms.prod != nil {
-		ms.prod.Close()
+	// Tracer is closed last, so the spans of the flushed messages are exported
+	err := ms.tracer.Close()
+	if err != nil {
+		ms.LogError("MS", err)
 	}
 	return nil
 }
 
-// Log log message to console
-func (ms *Microservice) Log(tag string, message string) {
-	_, fn, line, _ := runtime.Caller(1)
-	fns := strings.Split(fn, "/")
-	fmt.Println(tag+":", fns[len(fns)-1], line, message)
-}
-
 // newKafkaConsumer create new Kafka consumer
-func (ms *Microservice) newKafkaConsumer(servers string, groupID string) (*kafka.Consumer, error) {
+func (ms *Microservice) newKafkaConsumer(servers string, groupID string, opts *ConsumerOptions) (*kafka.Consumer, error) {
 	// Configurations
 	// https://github.com/edenhill/librdkafka/blob/master/CONFIGURATION.md
 	config := &kafka.ConfigMap{
@@ -179,7 +291,8 @@ func (ms *Microservice) newKafkaConsumer(servers string, groupID string) (*kafka
 		// Automatically and periodically commit offsets in the background.
 		// Note: setting this to false does not prevent the consumer from fetching previously committed start offsets.
 		// To circumvent this behaviour set specific start offsets per partition in the call to assign().
-		"enable.auto.commit": true,
+		// In Transactional mode, offsets are committed in the producer transaction (SendOffsetsToTransaction)
+		"enable.auto.commit": !opts.Transactional,
 
 		// The frequency in milliseconds that the consumer offsets are committed (written) to offset storage. (0 = disable).
 		// default = 5000ms (5s)
@@ -189,7 +302,10 @@ func (ms *Microservice) newKafkaConsumer(servers string, groupID string) (*kafka
 		// Automatically store offset of last message provided to application.
 		// The offset store is an in-memory store of the next offset to (auto-)commit for each partition
 		// and cs.Commit() <- offset-less commit
-		"enable.auto.offset.store": true,
+		// In AtLeastOnce mode, we store offset manually (c.StoreOffsets) after the handler has succeeded,
+		// so auto commit will commit only the offset of the message that has been processed
+		// In Concurrency mode, we store the offset that every messages before it have completed
+		"enable.auto.offset.store": !opts.AtLeastOnce && opts.Concurrency <= 1,
 
 		// Enable TCP keep-alives (SO_KEEPALIVE) on broker sockets
 		"socket.keepalive.enable": true,
@@ -8,54 +8,83 @@ import (
 	"time"
 )
 
-// startAsyncTaskConsumer read async task message from message queue and execute with handler
+// asyncTaskMessage is the message sent from AsyncTask endpoint to AsyncTask consumer
+type asyncTaskMessage struct {
+	Ref   string `json:"ref"`
+	Input string `json:"input"`
+}
+
+// startAsyncTaskConsumer read async task message from message queue and execute with handler,
+// the topic is created after every dependencies have responded, before the consumer start
 func (ms *Microservice) startAsyncTaskConsumer(path string, cacheServer string, mqServers string, h ServiceHandleFunc) {
 	topic := escapeName(path)
-	mq := NewMQ(mqServers, ms)
-	err := mq.CreateTopicR(topic, 5, 1, time.Hour*24*30) // retain message for 30 days
-	if err != nil {
-		ms.Log("ATASK", err.Error())
-	}
+	ms.metrics.watchQueue("asynctask", topic)
+	ms.OnStartup(func() error {
+		mq := NewMQ(mqServers, ms)
+		return mq.CreateTopicR(topic, 5, 1, time.Hour*24*30) // retain message for 30 days
+	})
 
 	ms.Consume(mqServers, topic, "atask", -1, func(ctx IContext) error {
-		message := map[string]interface{}{}
-		err := json.Unmarshal([]byte(ctx.ReadInput()), &message)
+		message := &asyncTaskMessage{}
+		err := ctx.BindInput(message)
 		if err != nil {
 			return err
 		}
-		ref, _ := message["ref"].(string)
-		input, _ := message["input"].(string)
-		return h(NewAsyncTaskContext(ms, cacheServer, ref, input))
+		taskCtx := NewAsyncTaskContext(ms, ctx.Context(), cacheServer, message.Ref, message.Input)
+		err = h(taskCtx)
+		taskCtx.Span().End(err)
+		return err
 	})
 }
 
 // handleAsyncTaskRequest accept async task request and send it to message queue
 func (ms *Microservice) handleAsyncTaskRequest(path string, cacheServer string, mqServers string, ctx IContext) error {
-	topic := escapeName(path)
-
-	// 1. Read Input
-	input := ctx.ReadInput()
+	return ms.handleAsyncTaskInput(path, cacheServer, mqServers, ctx.ReadInput(), ctx)
+}
 
-	// 2. Generate REF
-	ref := fmt.Sprintf("atask-%s", randString())
+// handleAsyncTaskInput accept input that has been read from async task request and send it to message queue
+func (ms *Microservice) handleAsyncTaskInput(path string, cacheServer string, mqServers string, input string, ctx IContext) error {
+	topic := escapeName(path)
 
-	// 3. Set Status in Cache
+	// 1. Generate REF and set Status in Cache, the REF that is used by the other task is generated again
 	cacher := ctx.Cacher(cacheServer)
 	status := map[string]interface{}{
 		"status": "processing",
 	}
 	expire := time.Minute * 30
-	cacher.Set(ref, status, expire)
+	ref := ""
+	for ok := false; !ok; {
+		ref = fmt.Sprintf("atask-%s", randString())
+		var err error
+		ok, err = cacher.SetNX(ref, status, expire)
+		if err != nil {
+			ms.LogError("ATASK", err)
+			return err
+		}
+	}
 
-	// 4. Send Message to MQ
+	// 2. Send Message to MQ
 	prod := ctx.Producer(mqServers)
-	message := map[string]interface{}{
-		"ref":   ref,
-		"input": input,
+	message := &asyncTaskMessage{
+		Ref:   ref,
+		Input: input,
+	}
+	err := prod.SendMessage(topic, "", message)
+	if err != nil {
+		// The task will never run, so the status is not left processing
+		ms.LogError("ATASK", err)
+		failed := map[string]interface{}{
+			"status": "failed",
+			"error":  err.Error(),
+		}
+		setErr := cacher.Set(ref, failed, expire)
+		if setErr != nil {
+			ms.LogError("ATASK", setErr)
+		}
+		return err
 	}
-	prod.SendMessage(topic, "", message)
 
-	// 5. Response REF
+	// 3. Response REF
 	res := map[string]string{
 		"ref": ref,
 	}
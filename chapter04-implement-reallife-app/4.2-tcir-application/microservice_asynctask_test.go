@@ -0,0 +1,50 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAsyncTaskSendFailed(t *testing.T) {
+	cacher, mr := newTestCacher(t)
+	defer mr.Close()
+	defer cacher.Close()
+
+	// The producer has closed, so the message of task cannot be sent
+	ms := cacher.ms
+	ms.cacher = cacher
+	ms.prod = NewProducer("localhost:9092", ms)
+	ms.prod.Close()
+	ms.POST("/task", func(ctx IContext) error {
+		return ms.handleAsyncTaskRequest("/task", mr.Addr(), "localhost:9092", ctx)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/task", strings.NewReader(`{"citizen_id":"1"}`))
+	rec := httptest.NewRecorder()
+	ms.echo.ServeHTTP(rec, req)
+
+	if rec.Code == http.StatusOK {
+		t.Errorf("status code = %d, want error", rec.Code)
+	}
+	// The status of REF is failed, so it is not left processing
+	keys := mr.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("keys = %v, want one REF", keys)
+	}
+	statusJS, err := mr.Get(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := map[string]interface{}{}
+	err = json.Unmarshal([]byte(statusJS), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status["status"] != "failed" || status["error"] != ErrProducerClosed.Error() {
+		t.Errorf("status = %v, want failed with ErrProducerClosed", status)
+	}
+}
@@ -2,9 +2,8 @@
 package main
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
@@ -12,109 +11,130 @@ import (
 
 func (ms *Microservice) consumeBatch(
 	servers string,
-	topic string,
+	topics []string,
 	groupID string,
 	readTimeout time.Duration,
 	batchSize int,
 	batchTimeout time.Duration,
-	h ServiceHandleFunc) error {
+	h ServiceHandleFunc,
+	opts *ConsumerOptions) error {
+
+	c, err := ms.newKafkaConsumer(servers, groupID, opts)
+	if err != nil {
+		return err
+	}
+
+	// This will close kafka consumer (and commit the stored offsets) after the last batch has executed
+	defer c.Close()
+
+	// Number of messages that have read but the batch has not executed
+	var inFlight int32
 
 	// Batch Filler
 	fill := func(b *Batch, payload interface{}) error {
-		p := payload.(string)
+		p := payload.(*kafka.Message)
 		b.Add(p)
 		return nil
 	}
 
 	// Batch Executer
 	exec := func(b *Batch) error {
-		messages := make([]string, 0)
+		msgs := make([]*kafka.Message, 0)
+		messages := make([]*Message, 0)
 		for {
 			item := b.Read()
 			if item == nil {
 				break
 			}
-			message := item.(string)
-			messages = append(messages, message)
+			msg := item.(*kafka.Message)
+			msgs = append(msgs, msg)
+			messages = append(messages, NewMessage(msg))
 		}
 
 		if len(messages) == 0 {
 			return nil
 		}
+		defer atomic.AddInt32(&inFlight, int32(-len(messages)))
 
 		// Execute Handler
-		h(NewBatchConsumerContext(ms, messages))
-		return nil
+		err := h(NewBatchConsumerContext(ms, messages))
+		if !opts.AtLeastOnce {
+			return err
+		}
+
+		// Execute the same batch again until it succeeded, the offsets of the batch are not stored yet
+		// so if the service has stopped during retry, the whole batch will be redelivered
+		for err != nil {
+			ms.LogError("BatchConsumer", err)
+			if ms.isStopping() {
+				// Give up when the service is shutting down, the batch will be redelivered to the next consumer
+				return err
+			}
+			time.Sleep(opts.RetryBackoff)
+			err = h(NewBatchConsumerContext(ms, messages))
+		}
+
+		// Store offsets only after the whole batch succeeded, auto commit will commit the stored offsets
+		return ms.storeOffsets(c, msgs)
 	}
 
 	// Payloads loader
 	payload := make(chan interface{})
-	quit := make(chan bool, 1)
 
+	// Error listener
+	errc := make(chan error)
+	defer close(errc)
 	go func() {
-
-		c, err := ms.newKafkaConsumer(servers, groupID)
-		if err != nil {
-			quit <- true
-			return
+		for err := range errc {
+			if err != nil {
+				ms.LogError("BatchConsumer", err)
+			}
 		}
+	}()
 
-		// This will close kafka consumer before exit function
-		defer c.Close()
+	be := NewBatchEvent(batchSize, batchTimeout, fill, exec, payload, errc)
+	be.Observe(ms.observeBatch(groupID))
 
-		c.Subscribe(topic, nil)
+	go func() {
+		// Payload is closed only by this goroutine when it has stopped reading,
+		// then BatchEvent will execute the last partial batch and exit
+		defer close(payload)
 
-		for {
+		// The pending batch may contain messages of revoked partitions, execute it and commit its offsets
+		// before the partitions are assigned to other consumer, so the batch will not be consumed twice
+		c.SubscribeTopics(topics, ms.rebalanceCallback(groupID, func(c *kafka.Consumer, tps []kafka.TopicPartition) {
+			be.Flush()
+			ms.commitOffsets(c)
+		}))
 
-			if readTimeout <= 0 {
-				// readtimeout -1 indicates no timeout
-				readTimeout = -1
+		flow := newConsumerFlow(ms, c, groupID, topics, opts)
+		defer flow.close()
+
+		for {
+			// Stop reading new message when the service is shutting down
+			if ms.isStopping() {
+				return
 			}
 
-			msg, err := c.ReadMessage(readTimeout)
+			// Read with bounded timeout, so the partitions can be paused and resumed even there is no message
+			msg, err := c.ReadMessage(consumerPollTimeout)
+			flow.check(int(atomic.LoadInt32(&inFlight)))
 			if err != nil {
 				kafkaErr, ok := err.(kafka.Error)
-				if ok {
-					if kafkaErr.Code() == kafka.ErrTimedOut {
-						if readTimeout == -1 {
-							// No timeout just continue to read message again
-							continue
-						}
-					}
+				if ok && kafkaErr.Code() == kafka.ErrTimedOut && !flow.timedOut(readTimeout) {
+					// No timeout (or not timeout yet) just continue to read message again
+					continue
 				}
+				ms.LogError("BatchConsumer", err)
 				return
 			}
+			flow.read()
 
-			message := string(msg.Value)
-			payload <- message
+			atomic.AddInt32(&inFlight, 1)
+			payload <- msg
 		}
 	}()
 
-	go func() {
-		// Gracefull shutdown routine
-		osQuit := make(chan os.Signal, 1)
-		signal.Notify(osQuit, syscall.SIGTERM, syscall.SIGINT)
-
-		select {
-		case <-quit:
-			close(payload)
-		case <-osQuit:
-			close(payload)
-		}
-	}()
-
-	// Error listener
-	errc := make(chan error)
-	defer close(errc)
-	go func() {
-		for err := range errc {
-			if err != nil {
-				ms.Log("BatchConsumer", err.Error())
-			}
-		}
-	}()
-
-	be := NewBatchEvent(batchSize, batchTimeout, fill, exec, payload, errc)
 	be.Start()
 
 	return nil
@@ -128,8 +148,37 @@ func (ms *Microservice) ConsumeBatch(
 	readTimeout time.Duration,
 	batchSize int,
 	batchTimeout time.Duration,
-	h ServiceHandleFunc) error {
+	h ServiceHandleFunc,
+	opts ...ConsumerOption) error {
 
-	go ms.consumeBatch(servers, topic, groupID, readTimeout, batchSize, batchTimeout, h)
+	return ms.ConsumeBatchTopics(servers, []string{topic}, groupID, readTimeout, batchSize, batchTimeout, h, opts...)
+}
+
+// ConsumeBatchTopics register service endpoint for Batch Consumer service that subscribe to many topics,
+// topic that start with ^ is regex pattern (such as ^ptask-.*)
+// The batch can contain messages from many topics, the topic of each message can be read from ctx.ReadMessages()
+func (ms *Microservice) ConsumeBatchTopics(
+	servers string,
+	topics []string,
+	groupID string,
+	readTimeout time.Duration,
+	batchSize int,
+	batchTimeout time.Duration,
+	h ServiceHandleFunc,
+	opts ...ConsumerOption) error {
+
+	options := newConsumerOptions(opts)
+	h = ms.consumerHandler(groupID, ms.withMiddlewares(h, options.Middlewares))
+	err := checkTopics(topics, options)
+	if err != nil {
+		return err
+	}
+	if options.Backpressure != nil && options.Backpressure.MaxInFlight > 0 && options.Backpressure.MaxInFlight < batchSize {
+		// The batch will never be full, if the consumer has paused before the batch is filled
+		return fmt.Errorf("Backpressure MaxInFlight (%d) must not be less than batchSize (%d)", options.Backpressure.MaxInFlight, batchSize)
+	}
+	ms.startWorker(func() {
+		ms.consumeBatch(servers, topics, groupID, readTimeout, batchSize, batchTimeout, h, options)
+	})
 	return nil
 }
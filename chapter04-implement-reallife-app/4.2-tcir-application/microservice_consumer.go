@@ -2,50 +2,206 @@
 package main
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
-func (ms *Microservice) consumeSingle(servers string, topic string, groupID string, readTimeout time.Duration, h ServiceHandleFunc) {
-	c, err := ms.newKafkaConsumer(servers, groupID)
+func (ms *Microservice) consumeSingle(servers string, topics []string, groupID string, readTimeout time.Duration, h ServiceHandleFunc, opts *ConsumerOptions) {
+	c, err := ms.newKafkaConsumer(servers, groupID, opts)
 	if err != nil {
 		return
 	}
 
 	defer c.Close()
 
-	c.Subscribe(topic, nil)
+	var retry *consumerRetry
+	if opts.RetryPolicy != nil {
+		retry = newConsumerRetry(ms, servers, topics[0], opts.RetryPolicy)
+	}
+
+	// Message is handled in this goroutine, so there is no pending message when partitions are revoked,
+	// just commit the stored offsets before the partitions are assigned to other consumer
+	c.SubscribeTopics(topics, ms.rebalanceCallback(groupID, func(c *kafka.Consumer, tps []kafka.TopicPartition) {
+		ms.commitOffsets(c)
+	}))
+
+	flow := newConsumerFlow(ms, c, groupID, topics, opts)
+	defer flow.close()
 
 	for {
-		if readTimeout <= 0 {
-			// readtimeout -1 indicates no timeout
-			readTimeout = -1
+		// Stop reading new message when the service is shutting down,
+		// the stored offsets are committed when the consumer is closed
+		if ms.isStopping() {
+			return
 		}
 
-		msg, err := c.ReadMessage(readTimeout)
+		// Read with bounded timeout, so the partitions can be paused and resumed even there is no message
+		msg, err := c.ReadMessage(consumerPollTimeout)
+		// Message is handled before the next read, so there is no in-flight message
+		flow.check(0)
 		if err != nil {
 			kafkaErr, ok := err.(kafka.Error)
-			if ok {
-				if kafkaErr.Code() == kafka.ErrTimedOut {
-					if readTimeout == -1 {
-						// No timeout just continue to read message again
-						continue
-					}
-				}
+			if ok && kafkaErr.Code() == kafka.ErrTimedOut && !flow.timedOut(readTimeout) {
+				// No timeout (or not timeout yet) just continue to read message again
+				continue
 			}
-			ms.Log("Consumer", err.Error())
+			ms.LogError("Consumer", err)
 			ms.Stop()
 			return
 		}
+		flow.read()
 
 		// Execute Handler
-		h(NewConsumerContext(ms, string(msg.Value)))
+		err = h(NewConsumerContext(ms, NewMessage(msg)))
+		if err != nil {
+			ms.LogError("Consumer", err)
+			// Failed message is handed over to retry topic, the offset can be stored if republish succeeded
+			err = ms.handoverFailed(retry, ms.getProducer(servers), msg, err)
+		}
+		ms.afterHandle(c, msg, err, opts)
+	}
+}
+
+// afterHandle store the offset of succeeded message, or rewind to the failed message so it will be
+// redelivered after backoff (AtLeastOnce only)
+func (ms *Microservice) afterHandle(c *kafka.Consumer, msg *kafka.Message, err error, opts *ConsumerOptions) {
+	if !opts.AtLeastOnce {
+		return
+	}
+
+	if err != nil {
+		ms.rewind(c, msg, opts)
+		return
 	}
+
+	// Store offset only after handler succeeded, auto commit will commit the stored offset
+	err = ms.storeOffsets(c, []*kafka.Message{msg})
+	if err != nil {
+		ms.LogError("Consumer", err)
+	}
+}
+
+// rewind seek back to the failed message, it will be read again after backoff
+func (ms *Microservice) rewind(c *kafka.Consumer, msg *kafka.Message, opts *ConsumerOptions) {
+	err := c.Seek(msg.TopicPartition, 0)
+	if err != nil {
+		ms.LogError("Consumer", err)
+	}
+	time.Sleep(opts.RetryBackoff)
+}
+
+// storeOffsets store the next offset of each partition in messages into the offset store,
+// the stored offsets will be committed by auto commit (and when the consumer is closed)
+func (ms *Microservice) storeOffsets(c *kafka.Consumer, messages []*kafka.Message) error {
+	tps := nextOffsets(messages)
+	if len(tps) == 0 {
+		return nil
+	}
+	_, err := c.StoreOffsets(tps)
+	return err
+}
+
+// nextOffsets return the offset of the next message to consume for each partition in messages
+func nextOffsets(messages []*kafka.Message) []kafka.TopicPartition {
+	offsets := map[string]kafka.TopicPartition{}
+	for _, msg := range messages {
+		tp := msg.TopicPartition
+		if tp.Topic == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", *tp.Topic, tp.Partition)
+		current, ok := offsets[key]
+		if ok && current.Offset > tp.Offset {
+			continue
+		}
+		offsets[key] = kafka.TopicPartition{
+			Topic:     tp.Topic,
+			Partition: tp.Partition,
+			Offset:    tp.Offset + 1,
+		}
+	}
+
+	tps := make([]kafka.TopicPartition, 0, len(offsets))
+	for _, tp := range offsets {
+		tps = append(tps, tp)
+	}
+	return tps
+}
+
+// isTopicPattern return true if topic is regex pattern such as ^ptask-.*
+func isTopicPattern(topic string) bool {
+	return strings.HasPrefix(topic, "^")
+}
+
+// checkTopics return error if topics cannot be subscribed with opts
+func checkTopics(topics []string, opts *ConsumerOptions) error {
+	if len(topics) == 0 {
+		return fmt.Errorf("Consumer need at least one topic")
+	}
+	for _, topic := range topics {
+		if !isTopicPattern(topic) {
+			continue
+		}
+		_, err := regexp.Compile(topic)
+		if err != nil {
+			return fmt.Errorf("Topic pattern %s is invalid: %s", topic, err.Error())
+		}
+	}
+	// Retry topics are created from the consumed topic, so it must be known when Consume is registered
+	if opts.RetryPolicy != nil && (len(topics) > 1 || isTopicPattern(topics[0])) {
+		return fmt.Errorf("RetryPolicy can be used with one topic only, but got %s", strings.Join(topics, ","))
+	}
+	return nil
 }
 
 // Consume register service endpoint for Consumer service
-func (ms *Microservice) Consume(servers string, topic string, groupID string, readTimeout time.Duration, h ServiceHandleFunc) error {
-	go ms.consumeSingle(servers, topic, groupID, readTimeout, h)
+func (ms *Microservice) Consume(servers string, topic string, groupID string, readTimeout time.Duration, h ServiceHandleFunc, opts ...ConsumerOption) error {
+	return ms.ConsumeTopics(servers, []string{topic}, groupID, readTimeout, h, opts...)
+}
+
+// ConsumeTopics register service endpoint for Consumer service that subscribe to many topics,
+// topic that start with ^ is regex pattern (such as ^ptask-.*), it will match the topics that are created later as well
+// The topic of each message can be read from ctx.ReadMessage().Topic
+func (ms *Microservice) ConsumeTopics(servers string, topics []string, groupID string, readTimeout time.Duration, h ServiceHandleFunc, opts ...ConsumerOption) error {
+	options := newConsumerOptions(opts)
+	h = ms.consumerHandler(groupID, ms.withMiddlewares(h, options.Middlewares))
+	err := checkTopics(topics, options)
+	if err != nil {
+		return err
+	}
+	if options.Transactional && options.Concurrency > 1 {
+		return fmt.Errorf("Concurrency cannot be used with transaction, offsets are committed in order of transactions")
+	}
+	if options.Backpressure != nil && options.Backpressure.MaxInFlight > 0 && options.Concurrency <= 1 {
+		return fmt.Errorf("Backpressure MaxInFlight requires Concurrency, the consumer without Concurrency handle one message at a time")
+	}
+	if options.Transactional {
+		options.TransactionalID, err = instanceTransactionalID(options, groupID)
+		if err != nil {
+			return err
+		}
+	}
+	if options.RetryPolicy != nil {
+		ms.startRetryConsumers(servers, groupID, newConsumerRetry(ms, servers, topics[0], options.RetryPolicy), h, options)
+	}
+	if options.Transactional {
+		ms.startWorker(func() {
+			ms.consumeTransactional(servers, topics, groupID, readTimeout, h, options)
+		})
+		return nil
+	}
+	if options.Concurrency > 1 {
+		ms.startWorker(func() {
+			ms.consumeConcurrent(servers, topics, groupID, readTimeout, h, options)
+		})
+		return nil
+	}
+	ms.startWorker(func() {
+		ms.consumeSingle(servers, topics, groupID, readTimeout, h, options)
+	})
 	return nil
 }
@@ -0,0 +1,318 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// concurrentPollTimeout is the max time to wait for message, so the completed offsets are stored on time
+const concurrentPollTimeout = 100 * time.Millisecond
+
+// offsetTracker track the in-flight offsets of one partition, the offset can be stored
+// only when every messages before it have completed
+type offsetTracker struct {
+	inflight  []int64
+	completed map[int64]bool
+	failed    int
+	next      int64
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		inflight:  []int64{},
+		completed: map[int64]bool{},
+		next:      -1,
+	}
+}
+
+// add add offset of dispatched message, offsets in partition are always added in order
+func (t *offsetTracker) add(offset int64) {
+	t.inflight = append(t.inflight, offset)
+}
+
+// complete mark offset as completed, and return true if the lowest in-flight offsets have completed,
+// so the next offset to commit has moved forward
+func (t *offsetTracker) complete(offset int64) bool {
+	t.completed[offset] = true
+	moved := false
+	for len(t.inflight) > 0 && t.completed[t.inflight[0]] {
+		delete(t.completed, t.inflight[0])
+		t.next = t.inflight[0] + 1
+		t.inflight = t.inflight[1:]
+		moved = true
+	}
+	return moved
+}
+
+// fail mark offset as failed, the offset is never completed, so the next offset to commit
+// will not move pass it and the message will be redelivered
+func (t *offsetTracker) fail(offset int64) {
+	t.failed++
+}
+
+// pending return number of in-flight messages that have not completed or failed
+func (t *offsetTracker) pending() int {
+	return len(t.inflight) - len(t.completed) - t.failed
+}
+
+// partitionWorkers handle messages of one partition, messages with the same key are sent to the same worker
+type partitionWorkers struct {
+	tp      kafka.TopicPartition
+	workers []chan *kafka.Message
+	tracker *offsetTracker
+	next    int
+}
+
+// worker return the worker of message, message without key is sent to workers in round robin
+func (pw *partitionWorkers) worker(msg *kafka.Message) chan *kafka.Message {
+	if len(msg.Key) == 0 {
+		pw.next = (pw.next + 1) % len(pw.workers)
+		return pw.workers[pw.next]
+	}
+	hash := fnv.New32a()
+	hash.Write(msg.Key)
+	return pw.workers[hash.Sum32()%uint32(len(pw.workers))]
+}
+
+// completion is sent from worker when message has handled, ok is false if the message has not succeeded
+// and it must be redelivered (AtLeastOnce only)
+type completion struct {
+	msg *kafka.Message
+	ok  bool
+}
+
+// concurrentConsumer dispatch messages to partition workers, only the poll goroutine can use the consumer,
+// workers send the completed message back to it through done channel
+type concurrentConsumer struct {
+	ms         *Microservice
+	c          *kafka.Consumer
+	servers    string
+	h          ServiceHandleFunc
+	opts       *ConsumerOptions
+	retry      *consumerRetry
+	partitions map[string]*partitionWorkers
+	done       chan completion
+	wg         sync.WaitGroup
+}
+
+func partitionKey(tp kafka.TopicPartition) string {
+	topic := ""
+	if tp.Topic != nil {
+		topic = *tp.Topic
+	}
+	return fmt.Sprintf("%s:%d", topic, tp.Partition)
+}
+
+// dispatch send message to its worker, it handle the completed messages while the worker is busy
+func (cc *concurrentConsumer) dispatch(msg *kafka.Message) {
+	key := partitionKey(msg.TopicPartition)
+	pw, ok := cc.partitions[key]
+	if !ok {
+		pw = cc.startWorkers(msg.TopicPartition)
+		cc.partitions[key] = pw
+	}
+	pw.tracker.add(int64(msg.TopicPartition.Offset))
+
+	worker := pw.worker(msg)
+	for {
+		select {
+		case worker <- msg:
+			return
+		case completed := <-cc.done:
+			cc.complete(completed)
+		}
+	}
+}
+
+func (cc *concurrentConsumer) startWorkers(tp kafka.TopicPartition) *partitionWorkers {
+	pw := &partitionWorkers{
+		tp:      tp,
+		workers: make([]chan *kafka.Message, cc.opts.Concurrency),
+		tracker: newOffsetTracker(),
+	}
+	for i := range pw.workers {
+		// Buffer 1 message, so the worker can start the next message immediately
+		pw.workers[i] = make(chan *kafka.Message, 1)
+		cc.wg.Add(1)
+		go cc.work(pw.workers[i])
+	}
+	return pw
+}
+
+// work execute handler for each message in order, and send it to done channel when completed
+func (cc *concurrentConsumer) work(messages chan *kafka.Message) {
+	defer cc.wg.Done()
+	for msg := range messages {
+		err := cc.handle(msg)
+		// In AtLeastOnce mode, the message is retried by this worker, so the next messages of the same key
+		// are still handled in order, the retry is given up when the service is shutting down
+		for err != nil && cc.opts.AtLeastOnce && !cc.ms.isStopping() {
+			time.Sleep(cc.opts.RetryBackoff)
+			err = cc.handle(msg)
+		}
+		cc.done <- completion{msg: msg, ok: err == nil || !cc.opts.AtLeastOnce}
+	}
+}
+
+func (cc *concurrentConsumer) handle(msg *kafka.Message) error {
+	err := cc.h(NewConsumerContext(cc.ms, NewMessage(msg)))
+	if err != nil {
+		cc.ms.LogError("Consumer", err)
+		err = cc.ms.handoverFailed(cc.retry, cc.ms.getProducer(cc.servers), msg, err)
+	}
+	return err
+}
+
+// complete store the next offset of partition if every messages before it have completed
+func (cc *concurrentConsumer) complete(completed completion) {
+	msg := completed.msg
+	pw, ok := cc.partitions[partitionKey(msg.TopicPartition)]
+	if !ok {
+		return
+	}
+	if !completed.ok {
+		pw.tracker.fail(int64(msg.TopicPartition.Offset))
+		return
+	}
+	if !pw.tracker.complete(int64(msg.TopicPartition.Offset)) {
+		return
+	}
+	_, err := cc.c.StoreOffsets([]kafka.TopicPartition{{
+		Topic:     pw.tp.Topic,
+		Partition: pw.tp.Partition,
+		Offset:    kafka.Offset(pw.tracker.next),
+	}})
+	if err != nil {
+		cc.ms.LogError("Consumer", err)
+	}
+}
+
+// completeReady handle the completed messages without waiting
+func (cc *concurrentConsumer) completeReady() {
+	for {
+		select {
+		case completed := <-cc.done:
+			cc.complete(completed)
+		default:
+			return
+		}
+	}
+}
+
+// stopPartitions wait for in-flight messages of partitions to complete, then stop their workers
+func (cc *concurrentConsumer) stopPartitions(keys []string) {
+	for {
+		pending := 0
+		for _, key := range keys {
+			pw, ok := cc.partitions[key]
+			if ok {
+				pending += pw.tracker.pending()
+			}
+		}
+		if pending == 0 {
+			break
+		}
+		cc.complete(<-cc.done)
+	}
+	for _, key := range keys {
+		pw, ok := cc.partitions[key]
+		if !ok {
+			continue
+		}
+		for _, worker := range pw.workers {
+			close(worker)
+		}
+		delete(cc.partitions, key)
+	}
+}
+
+// inFlight return number of messages that have dispatched but not completed
+func (cc *concurrentConsumer) inFlight() int {
+	n := 0
+	for _, pw := range cc.partitions {
+		n += pw.tracker.pending()
+	}
+	return n
+}
+
+// stopAll wait for every in-flight messages to complete and stop all workers
+func (cc *concurrentConsumer) stopAll() {
+	keys := make([]string, 0, len(cc.partitions))
+	for key := range cc.partitions {
+		keys = append(keys, key)
+	}
+	cc.stopPartitions(keys)
+	cc.wg.Wait()
+}
+
+// consumeConcurrent consume messages and handle them with opts.Concurrency workers per partition
+func (ms *Microservice) consumeConcurrent(servers string, topics []string, groupID string, readTimeout time.Duration, h ServiceHandleFunc, opts *ConsumerOptions) {
+	c, err := ms.newKafkaConsumer(servers, groupID, opts)
+	if err != nil {
+		return
+	}
+
+	defer c.Close()
+
+	cc := &concurrentConsumer{
+		ms:         ms,
+		c:          c,
+		servers:    servers,
+		h:          h,
+		opts:       opts,
+		partitions: map[string]*partitionWorkers{},
+		done:       make(chan completion),
+	}
+	if opts.RetryPolicy != nil {
+		cc.retry = newConsumerRetry(ms, servers, topics[0], opts.RetryPolicy)
+	}
+
+	// Wait for in-flight messages of revoked partitions and commit their offsets
+	// before the partitions are assigned to other consumer
+	c.SubscribeTopics(topics, ms.rebalanceCallback(groupID, func(c *kafka.Consumer, tps []kafka.TopicPartition) {
+		keys := make([]string, 0, len(tps))
+		for _, tp := range tps {
+			keys = append(keys, partitionKey(tp))
+		}
+		cc.stopPartitions(keys)
+		ms.commitOffsets(c)
+	}))
+
+	// This will wait for in-flight messages before the consumer is closed
+	defer cc.stopAll()
+
+	flow := newConsumerFlow(ms, c, groupID, topics, opts)
+	defer flow.close()
+
+	for {
+		// Stop reading new message when the service is shutting down,
+		// in-flight messages are completed before the consumer is closed
+		if ms.isStopping() {
+			return
+		}
+
+		cc.completeReady()
+
+		// Read with short timeout, so the completed offsets are stored even there is no new message
+		msg, err := c.ReadMessage(concurrentPollTimeout)
+		flow.check(cc.inFlight())
+		if err != nil {
+			kafkaErr, ok := err.(kafka.Error)
+			if ok && kafkaErr.Code() == kafka.ErrTimedOut && !flow.timedOut(readTimeout) {
+				// No timeout (or not timeout yet) just continue to read message again
+				continue
+			}
+			ms.LogError("Consumer", err)
+			ms.Stop()
+			return
+		}
+
+		flow.read()
+		cc.dispatch(msg)
+	}
+}
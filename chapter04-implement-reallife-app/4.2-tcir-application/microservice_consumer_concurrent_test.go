@@ -0,0 +1,128 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// trackerStep is add, complete or fail of offset, and the expected tracker after that
+type trackerStep struct {
+	op          string
+	offset      int64
+	wantMoved   bool
+	wantNext    int64
+	wantPending int
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []trackerStep
+	}{
+		{
+			name: "complete in order",
+			steps: []trackerStep{
+				{"add", 10, false, -1, 1},
+				{"add", 11, false, -1, 2},
+				{"complete", 10, true, 11, 1},
+				{"complete", 11, true, 12, 0},
+			},
+		},
+		{
+			name: "complete out of order wait for the lowest offset",
+			steps: []trackerStep{
+				{"add", 10, false, -1, 1},
+				{"add", 11, false, -1, 2},
+				{"add", 12, false, -1, 3},
+				{"complete", 12, false, -1, 2},
+				{"complete", 11, false, -1, 1},
+				{"complete", 10, true, 13, 0},
+			},
+		},
+		{
+			name: "failed offset is never passed",
+			steps: []trackerStep{
+				{"add", 10, false, -1, 1},
+				{"add", 11, false, -1, 2},
+				{"add", 12, false, -1, 3},
+				{"complete", 10, true, 11, 2},
+				{"fail", 11, false, 11, 1},
+				{"complete", 12, false, 11, 0},
+			},
+		},
+		{
+			name: "offsets with gap (compacted topic or transaction markers)",
+			steps: []trackerStep{
+				{"add", 10, false, -1, 1},
+				{"add", 15, false, -1, 2},
+				{"complete", 15, false, -1, 1},
+				{"complete", 10, true, 16, 0},
+			},
+		},
+		{
+			name: "add after complete",
+			steps: []trackerStep{
+				{"add", 10, false, -1, 1},
+				{"complete", 10, true, 11, 0},
+				{"add", 11, false, 11, 1},
+				{"complete", 11, true, 12, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for i, step := range tt.steps {
+				moved := false
+				switch step.op {
+				case "add":
+					tracker.add(step.offset)
+				case "complete":
+					moved = tracker.complete(step.offset)
+				case "fail":
+					tracker.fail(step.offset)
+				}
+				if moved != step.wantMoved {
+					t.Errorf("step %d %s(%d) moved = %v, want %v", i, step.op, step.offset, moved, step.wantMoved)
+				}
+				if tracker.next != step.wantNext {
+					t.Errorf("step %d %s(%d) next = %d, want %d", i, step.op, step.offset, tracker.next, step.wantNext)
+				}
+				if tracker.pending() != step.wantPending {
+					t.Errorf("step %d %s(%d) pending = %d, want %d", i, step.op, step.offset, tracker.pending(), step.wantPending)
+				}
+			}
+		})
+	}
+}
+
+func TestPartitionWorkersWorker(t *testing.T) {
+	pw := &partitionWorkers{
+		workers: []chan *kafka.Message{make(chan *kafka.Message), make(chan *kafka.Message), make(chan *kafka.Message)},
+	}
+	keyed := func(key string) *kafka.Message {
+		return &kafka.Message{Key: []byte(key)}
+	}
+
+	// Messages with the same key are always handled by the same worker (in order)
+	for _, key := range []string{"citizen-1", "citizen-2", "citizen-3"} {
+		first := pw.worker(keyed(key))
+		for i := 0; i < 5; i++ {
+			if pw.worker(keyed(key)) != first {
+				t.Errorf("worker() of key %s has changed", key)
+			}
+		}
+	}
+
+	// Messages without key are sent to every workers in round robin
+	used := map[chan *kafka.Message]bool{}
+	for i := 0; i < len(pw.workers); i++ {
+		used[pw.worker(&kafka.Message{})] = true
+	}
+	if len(used) != len(pw.workers) {
+		t.Errorf("worker() without key used %d workers, want %d", len(used), len(pw.workers))
+	}
+}
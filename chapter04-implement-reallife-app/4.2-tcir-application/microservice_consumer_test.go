@@ -0,0 +1,140 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func testMessage(topic string, partition int32, offset kafka.Offset) *kafka.Message {
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: offset},
+	}
+}
+
+// offsetStrings return "topic:partition@offset" of tps in order, so the results can be compared
+func offsetStrings(tps []kafka.TopicPartition) []string {
+	strs := []string{}
+	for _, tp := range tps {
+		strs = append(strs, fmt.Sprintf("%s:%d@%d", *tp.Topic, tp.Partition, tp.Offset))
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+func TestNextOffsets(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []*kafka.Message
+		want     []string
+	}{
+		{
+			name:     "empty",
+			messages: nil,
+			want:     []string{},
+		},
+		{
+			name:     "one message",
+			messages: []*kafka.Message{testMessage("citizen", 0, 10)},
+			want:     []string{"citizen:0@11"},
+		},
+		{
+			name: "the highest offset of each partition",
+			messages: []*kafka.Message{
+				testMessage("citizen", 0, 10),
+				testMessage("citizen", 0, 12),
+				testMessage("citizen", 1, 3),
+				testMessage("citizen", 0, 11),
+			},
+			want: []string{"citizen:0@13", "citizen:1@4"},
+		},
+		{
+			name: "the same partition of different topics",
+			messages: []*kafka.Message{
+				testMessage("citizen", 0, 5),
+				testMessage("mail", 0, 7),
+			},
+			want: []string{"citizen:0@6", "mail:0@8"},
+		},
+		{
+			name: "message without topic is skipped",
+			messages: []*kafka.Message{
+				{TopicPartition: kafka.TopicPartition{Partition: 0, Offset: 1}},
+				testMessage("citizen", 2, 0),
+			},
+			want: []string{"citizen:2@1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := offsetStrings(nextOffsets(tt.messages))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("nextOffsets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTopics(t *testing.T) {
+	tests := []struct {
+		name    string
+		topics  []string
+		opts    *ConsumerOptions
+		wantErr bool
+	}{
+		{"one topic", []string{"citizen"}, &ConsumerOptions{}, false},
+		{"no topic", []string{}, &ConsumerOptions{}, true},
+		{"topic pattern", []string{"^ptask-.*"}, &ConsumerOptions{}, false},
+		{"invalid topic pattern", []string{"^ptask-("}, &ConsumerOptions{}, true},
+		{"retry with one topic", []string{"citizen"}, &ConsumerOptions{RetryPolicy: &RetryPolicy{}}, false},
+		{"retry with many topics", []string{"citizen", "mail"}, &ConsumerOptions{RetryPolicy: &RetryPolicy{}}, true},
+		{"retry with topic pattern", []string{"^ptask-.*"}, &ConsumerOptions{RetryPolicy: &RetryPolicy{}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTopics(tt.topics, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkTopics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryConsumerOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *ConsumerOptions
+	}{
+		{"default", &ConsumerOptions{}},
+		{"at least once", &ConsumerOptions{AtLeastOnce: true}},
+		{"transactional", &ConsumerOptions{Transactional: true, TransactionalID: "mail-0"}},
+		{"concurrency", &ConsumerOptions{Concurrency: 4}},
+		{"at least once with concurrency", &ConsumerOptions{AtLeastOnce: true, Concurrency: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := *tt.opts
+			got := retryConsumerOptions(tt.opts)
+			// The offset of retry topic is stored manually, so the message that is waiting for the delay is not committed
+			if !got.AtLeastOnce {
+				t.Errorf("AtLeastOnce = false, want true")
+			}
+			// Retry consumer handle one message at a time, the offset is stored by afterHandle
+			if got.Concurrency != 0 {
+				t.Errorf("Concurrency = %d, want 0", got.Concurrency)
+			}
+			if got.Transactional != opts.Transactional || got.TransactionalID != opts.TransactionalID {
+				t.Errorf("transaction = %v %s, want %v %s", got.Transactional, got.TransactionalID, opts.Transactional, opts.TransactionalID)
+			}
+			if tt.opts.AtLeastOnce != opts.AtLeastOnce || tt.opts.Concurrency != opts.Concurrency {
+				t.Errorf("options of main consumer has changed to %v %d", tt.opts.AtLeastOnce, tt.opts.Concurrency)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// statefulSetPodName match pod name of StatefulSet (<statefulset name>-<ordinal>)
+var statefulSetPodName = regexp.MustCompile(`^.+-[0-9]+$`)
+
+// instanceTransactionalID return transactional.id of the consumer instance, it must be the same after the instance
+// has restarted, so Kafka can fence the transactions of the old instance (zombie) and abort its open transaction
+// If not set in options, it is created from group id and the StatefulSet pod name (such as mail-consumer-0),
+// the pod name of Deployment is changed on every restart, so it cannot be used
+func instanceTransactionalID(opts *ConsumerOptions, groupID string) (string, error) {
+	if len(opts.TransactionalID) > 0 {
+		return opts.TransactionalID, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	if !statefulSetPodName.MatchString(hostname) {
+		return "", fmt.Errorf("Transactional ID is required, hostname %s is not the pod name of StatefulSet", hostname)
+	}
+	return escapeName(groupID, hostname), nil
+}
+
+// transactionalID return transactional.id of the producer that handle topics in the consumer instance
+func transactionalID(opts *ConsumerOptions, topics ...string) string {
+	return escapeName(append([]string{opts.TransactionalID}, topics...)...)
+}
+
+// newTransactionalProducer create transactional producer and init transactions
+func (ms *Microservice) newTransactionalProducer(servers string, transactionalID string) (*Producer, error) {
+	prod := NewTransactionalProducer(servers, transactionalID, ms)
+	err := prod.initTransactions()
+	if err != nil {
+		prod.Close()
+		return nil, err
+	}
+	return prod, nil
+}
+
+// handleTransaction execute handler inside producer transaction, the messages sent from handler
+// and the offset of msg are committed in the same transaction
+// If handler has failed, its messages are discarded, and the message is republished to retry topic
+// in the new transaction (if retry is not nil, the invalid input is skipped if retry is nil)
+func (ms *Microservice) handleTransaction(c *kafka.Consumer, prod *Producer, msg *kafka.Message, h ServiceHandleFunc, retry *consumerRetry) error {
+	err := prod.beginTransaction()
+	if err != nil {
+		ms.LogError("Consumer", err)
+		return err
+	}
+
+	// Execute Handler
+	err = h(NewTransactionalConsumerContext(ms, NewMessage(msg), prod))
+	if err != nil {
+		ms.LogError("Consumer", err)
+
+		// Discard every messages that handler has sent
+		abortErr := prod.abortTransaction()
+		if abortErr != nil {
+			ms.LogError("Consumer", abortErr)
+			return abortErr
+		}
+		if retry == nil && !isInvalidInput(err) {
+			return err
+		}
+
+		// Handover the failed message to retry topic in the new transaction
+		beginErr := prod.beginTransaction()
+		if beginErr != nil {
+			ms.LogError("Consumer", beginErr)
+			return beginErr
+		}
+		err = ms.handoverFailed(retry, prod, msg, err)
+		if err != nil {
+			ms.LogError("Consumer", err)
+			prod.abortTransaction()
+			return err
+		}
+	}
+
+	// Commit offset of this message together with the messages in transaction
+	err = prod.commitTransaction(c, nextOffsets([]*kafka.Message{msg}))
+	if err != nil {
+		ms.LogError("Consumer", err)
+		prod.abortTransaction()
+		return err
+	}
+	return nil
+}
+
+// consumeTransactional consume message and execute handler inside producer transaction
+func (ms *Microservice) consumeTransactional(servers string, topics []string, groupID string, readTimeout time.Duration, h ServiceHandleFunc, opts *ConsumerOptions) {
+	c, err := ms.newKafkaConsumer(servers, groupID, opts)
+	if err != nil {
+		return
+	}
+
+	defer c.Close()
+
+	prod, err := ms.newTransactionalProducer(servers, transactionalID(opts, topics...))
+	if err != nil {
+		ms.LogError("Consumer", err)
+		ms.Stop()
+		return
+	}
+
+	defer prod.Close()
+
+	var retry *consumerRetry
+	if opts.RetryPolicy != nil {
+		retry = newConsumerRetry(ms, servers, topics[0], opts.RetryPolicy)
+	}
+
+	// Offsets are committed in transaction with each message, there is nothing to commit when partitions are revoked
+	c.SubscribeTopics(topics, ms.rebalanceCallback(groupID, nil))
+
+	flow := newConsumerFlow(ms, c, groupID, topics, opts)
+	defer flow.close()
+
+	for {
+		// Stop reading new message when the service is shutting down,
+		// the offsets have committed with the transactions
+		if ms.isStopping() {
+			return
+		}
+
+		// Read with bounded timeout, so the partitions can be paused and resumed even there is no message
+		msg, err := c.ReadMessage(consumerPollTimeout)
+		// Message is handled before the next read, so there is no in-flight message
+		flow.check(0)
+		if err != nil {
+			kafkaErr, ok := err.(kafka.Error)
+			if ok && kafkaErr.Code() == kafka.ErrTimedOut && !flow.timedOut(readTimeout) {
+				// No timeout (or not timeout yet) just continue to read message again
+				continue
+			}
+			ms.LogError("Consumer", err)
+			ms.Stop()
+			return
+		}
+		flow.read()
+
+		err = ms.handleTransaction(c, prod, msg, h, retry)
+		if err != nil {
+			kafkaErr, ok := err.(kafka.Error)
+			if ok && kafkaErr.IsFatal() {
+				// Producer has been fenced or in fatal state, it cannot be used anymore
+				ms.Stop()
+				return
+			}
+			// Offset is not committed, so the message and its output will be processed again
+			ms.rewind(c, msg, opts)
+		}
+	}
+}
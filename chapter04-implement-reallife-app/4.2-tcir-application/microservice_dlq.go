@@ -0,0 +1,39 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// RegisterDLQReplayEndpoint register admin endpoint to replay dead letter queue back to its topic,
+// POST path?topic=citizen-registered (&group_id=) respond the number of replayed messages after the replay has done
+// The replay is stopped when the client has disconnected, the messages that have been replayed are not replayed again
+func (ms *Microservice) RegisterDLQReplayEndpoint(path string, mqServers string) {
+	ms.echo.POST(path, func(c echo.Context) error {
+		topic := c.QueryParam("topic")
+		if len(topic) == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "topic in query param is required"})
+		}
+		groupID := c.QueryParam("group_id")
+		if len(groupID) == 0 {
+			groupID = escapeName(topic, "dlq-replay")
+		}
+
+		mq := NewMQ(mqServers, ms).WithContext(c.Request().Context())
+		count, err := mq.ReplayDLQ(topic, groupID)
+		if err != nil {
+			ms.LogError("MQ", err)
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+				"error":    err.Error(),
+				"replayed": count,
+			})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"topic":    topic,
+			"dlq":      dlqTopicName(topic),
+			"replayed": count,
+		})
+	})
+}
@@ -0,0 +1,238 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// defaultHealthCheckTimeout is less than timeoutSeconds of k8s readiness probe (3s),
+// every checks run in parallel, so the probe is responded before k8s give up
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// healthCheckCacheTTL is the time that the result of health check is reused, so the probes
+// from k8s (and people) will not flood the dependencies
+const healthCheckCacheTTL = 5 * time.Second
+
+const (
+	healthStatusOK     = "ok"
+	healthStatusFailed = "failed"
+)
+
+// HealthCheckFunc check health of a dependency, it must return when ctx is done
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheckResult is the latest result of health check
+type HealthCheckResult struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// healthChecker execute check with timeout and cache its result,
+// the concurrent probes wait for the running check instead of checking again
+type healthChecker struct {
+	name    string
+	timeout time.Duration
+	check   HealthCheckFunc
+	result  *HealthCheckResult
+	mutex   sync.Mutex
+}
+
+func (hc *healthChecker) run(parent context.Context) HealthCheckResult {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	if hc.result != nil && time.Since(hc.result.CheckedAt) < healthCheckCacheTTL {
+		return *hc.result
+	}
+
+	start := time.Now()
+	err := checkWithTimeout(parent, hc.timeout, hc.check)
+	result := &HealthCheckResult{
+		Status:     healthStatusOK,
+		DurationMs: int64(time.Since(start) / time.Millisecond),
+		CheckedAt:  time.Now(),
+	}
+	if err != nil {
+		result.Status = healthStatusFailed
+		result.Error = err.Error()
+	}
+	hc.result = result
+	return *result
+}
+
+// checkWithTimeout execute check and return error if it does not return within timeout
+func checkWithTimeout(parent context.Context, timeout time.Duration, check HealthCheckFunc) error {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	// The check run in its own goroutine, so the check that does not respect ctx cannot block the probe
+	// The channel is buffered, so the goroutine can exit after the probe has given up
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("Timeout after %s", timeout)
+	}
+}
+
+// RegisterHealthCheck register check of a dependency for readiness probe,
+// the check is failed if it does not return within timeout (timeout <= 0 is default 2 seconds)
+func (ms *Microservice) RegisterHealthCheck(name string, timeout time.Duration, check HealthCheckFunc) {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ms.healthMutex.Lock()
+	defer ms.healthMutex.Unlock()
+	ms.healthCheckers = append(ms.healthCheckers, &healthChecker{
+		name:    name,
+		timeout: timeout,
+		check:   check,
+	})
+}
+
+// HealthChecks execute every registered checks in parallel and return their results by name,
+// the results that have checked within 5 seconds are reused
+func (ms *Microservice) HealthChecks() map[string]HealthCheckResult {
+	ms.healthMutex.Lock()
+	checkers := append([]*healthChecker{}, ms.healthCheckers...)
+	ms.healthMutex.Unlock()
+
+	results := map[string]HealthCheckResult{}
+	resultMutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, checker := range checkers {
+		wg.Add(1)
+		go func(checker *healthChecker) {
+			defer wg.Done()
+			result := checker.run(ms.ctx)
+			resultMutex.Lock()
+			results[checker.name] = result
+			resultMutex.Unlock()
+		}(checker)
+	}
+	wg.Wait()
+	return results
+}
+
+// RegisterReadinessProbeEndpoint register endpoint for readiness probe, it response status of every checks in JSON
+// with status 200 if every checks are ok, or status 503 if any check has failed or the service is starting / shutting down
+func (ms *Microservice) RegisterReadinessProbeEndpoint(path string) {
+	ms.echo.GET(path, func(c echo.Context) error {
+		checks := ms.HealthChecks()
+
+		status := healthStatusOK
+		for _, result := range checks {
+			if result.Status != healthStatusOK {
+				status = healthStatusFailed
+			}
+		}
+		// Remove this pod from service endpoints before the HTTP server stop accepting requests
+		if ms.isStopping() {
+			status = "stopping"
+		} else if !ms.isStarted() {
+			status = "starting"
+		}
+
+		code := http.StatusOK
+		if status != healthStatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		return c.JSON(code, map[string]interface{}{
+			"status": status,
+			"checks": checks,
+		})
+	})
+}
+
+// CacherHealthCheck return check that ping the Redis server
+func (ms *Microservice) CacherHealthCheck(cacheServer string) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return ms.getCacher(cacheServer).WithContext(ctx).Healthcheck()
+	}
+}
+
+// ProducerHealthCheck return check that fetch metadata from Kafka brokers with the producer of this service
+func (ms *Microservice) ProducerHealthCheck(mqServers string) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		prod, ok := ms.getProducer(mqServers).(*Producer)
+		if !ok {
+			return fmt.Errorf("Producer does not support health check")
+		}
+		return prod.ping(ctx)
+	}
+}
+
+// ConsumerGroupHealthCheck return check that is failed until a consumer of groupID has joined the group
+// (partitions have been assigned), it is failed again while every consumers of groupID are rebalancing
+func (ms *Microservice) ConsumerGroupHealthCheck(groupID string) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		if !ms.isGroupMember(groupID) {
+			return fmt.Errorf("Consumer has not joined group %s", groupID)
+		}
+		return nil
+	}
+}
+
+// HTTPHealthCheck return check that send GET request to url, the dependency is healthy if it response
+// with status lower than 500 (the endpoint that accept only POST will response 405 but it is still reachable)
+func HTTPHealthCheck(url string) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s response status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// newGroupMember return id of consumer instance, each consumer of the same group has its own membership
+func (ms *Microservice) newGroupMember() int {
+	ms.rebalanceMutex.Lock()
+	defer ms.rebalanceMutex.Unlock()
+	ms.memberCount++
+	return ms.memberCount
+}
+
+// setGroupMember mark that the consumer instance (member) of groupID has partitions assigned (or revoked)
+func (ms *Microservice) setGroupMember(groupID string, member int, joined bool) {
+	ms.rebalanceMutex.Lock()
+	defer ms.rebalanceMutex.Unlock()
+	if ms.members == nil {
+		ms.members = map[string]map[int]bool{}
+	}
+	if ms.members[groupID] == nil {
+		ms.members[groupID] = map[int]bool{}
+	}
+	if joined {
+		ms.members[groupID][member] = true
+	} else {
+		delete(ms.members[groupID], member)
+	}
+}
+
+// isGroupMember return true if any consumer instance of groupID has partitions assigned
+func (ms *Microservice) isGroupMember(groupID string) bool {
+	ms.rebalanceMutex.Lock()
+	defer ms.rebalanceMutex.Unlock()
+	return len(ms.members[groupID]) > 0
+}
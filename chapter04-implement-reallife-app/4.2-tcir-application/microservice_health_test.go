@@ -0,0 +1,80 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// memberStep is assigned (joined) or revoked of the consumer instance, and the expected membership of group
+type memberStep struct {
+	groupID    string
+	member     int
+	joined     bool
+	wantJoined map[string]bool
+}
+
+func TestGroupMembership(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []memberStep
+	}{
+		{
+			name: "one consumer",
+			steps: []memberStep{
+				{"mail", 1, true, map[string]bool{"mail": true}},
+				{"mail", 1, false, map[string]bool{"mail": false}},
+			},
+		},
+		{
+			name: "revoke of one consumer does not leave the group while the other is assigned",
+			steps: []memberStep{
+				{"mail", 1, true, map[string]bool{"mail": true}},
+				{"mail", 2, true, map[string]bool{"mail": true}},
+				{"mail", 1, false, map[string]bool{"mail": true}},
+				{"mail", 2, false, map[string]bool{"mail": false}},
+			},
+		},
+		{
+			name: "revoke twice does not remove the other consumer",
+			steps: []memberStep{
+				{"mail", 1, true, map[string]bool{"mail": true}},
+				{"mail", 2, false, map[string]bool{"mail": true}},
+				{"mail", 2, false, map[string]bool{"mail": true}},
+			},
+		},
+		{
+			name: "groups are separated",
+			steps: []memberStep{
+				{"mail", 1, true, map[string]bool{"mail": true, "sms": false}},
+				{"sms", 2, true, map[string]bool{"mail": true, "sms": true}},
+				{"mail", 1, false, map[string]bool{"mail": false, "sms": true}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := NewMicroservice()
+			for i, step := range tt.steps {
+				ms.setGroupMember(step.groupID, step.member, step.joined)
+				for groupID, want := range step.wantJoined {
+					if got := ms.isGroupMember(groupID); got != want {
+						t.Errorf("step %d isGroupMember(%s) = %v, want %v", i, groupID, got, want)
+					}
+					err := ms.ConsumerGroupHealthCheck(groupID)(context.Background())
+					if (err == nil) != want {
+						t.Errorf("step %d ConsumerGroupHealthCheck(%s) error = %v, want joined %v", i, groupID, err, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewGroupMember(t *testing.T) {
+	ms := NewMicroservice()
+	if first, second := ms.newGroupMember(), ms.newGroupMember(); first == second {
+		t.Errorf("newGroupMember() = %d for both consumers", first)
+	}
+}
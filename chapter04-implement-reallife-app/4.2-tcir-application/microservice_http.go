@@ -3,58 +3,58 @@ package main
 
 import (
 	"context"
-	"time"
+	"net/http"
 
 	"github.com/labstack/echo"
 )
 
 // GET register service endpoint for HTTP GET
-func (ms *Microservice) GET(path string, h ServiceHandleFunc) {
-	ms.echo.GET(path, func(c echo.Context) error {
-		return h(NewHTTPContext(ms, c))
-	})
+func (ms *Microservice) GET(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc) {
+	ms.route(http.MethodGet, path, h, middlewares)
 }
 
 // POST register service endpoint for HTTP POST
-func (ms *Microservice) POST(path string, h ServiceHandleFunc) {
-	ms.echo.POST(path, func(c echo.Context) error {
-		return h(NewHTTPContext(ms, c))
-	})
+func (ms *Microservice) POST(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc) {
+	ms.route(http.MethodPost, path, h, middlewares)
 }
 
 // PUT register service endpoint for HTTP PUT
-func (ms *Microservice) PUT(path string, h ServiceHandleFunc) {
-	ms.echo.PUT(path, func(c echo.Context) error {
-		return h(NewHTTPContext(ms, c))
-	})
+func (ms *Microservice) PUT(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc) {
+	ms.route(http.MethodPut, path, h, middlewares)
 }
 
 // PATCH register service endpoint for HTTP PATCH
-func (ms *Microservice) PATCH(path string, h ServiceHandleFunc) {
-	ms.echo.PATCH(path, func(c echo.Context) error {
-		return h(NewHTTPContext(ms, c))
-	})
+func (ms *Microservice) PATCH(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc) {
+	ms.route(http.MethodPatch, path, h, middlewares)
 }
 
 // DELETE register service endpoint for HTTP DELETE
-func (ms *Microservice) DELETE(path string, h ServiceHandleFunc) {
-	ms.echo.DELETE(path, func(c echo.Context) error {
-		return h(NewHTTPContext(ms, c))
-	})
-}
-
-// startHTTP will start HTTP service, this function will block thread
-func (ms *Microservice) startHTTP(exitChannel chan bool) error {
-	// Caller can exit by sending value to exitChannel
-	go func() {
-		<-exitChannel
-		ms.stopHTTP()
-	}()
+func (ms *Microservice) DELETE(path string, h ServiceHandleFunc, middlewares ...MiddlewareFunc) {
+	ms.route(http.MethodDelete, path, h, middlewares)
+}
+
+// route register handler with the global middlewares (Use) and the route middlewares,
+// OPTIONS of path is also registered, so the middlewares (such as CORS) can respond preflight request
+func (ms *Microservice) route(method string, path string, h ServiceHandleFunc, middlewares []MiddlewareFunc) {
+	ms.echo.Add(method, path, ms.httpHandler(path, ms.withMiddlewares(h, middlewares)))
+	if len(ms.middlewares) == 0 && len(middlewares) == 0 {
+		return
+	}
+	// The last registered route of path is used for preflight
+	ms.echo.Add(http.MethodOptions, path, ms.httpHandler(path, ms.withMiddlewares(func(ctx IContext) error {
+		return echo.ErrMethodNotAllowed
+	}, middlewares)))
+}
+
+// startHTTP will start HTTP service, this function will block thread until stopHTTP is called
+func (ms *Microservice) startHTTP() error {
 	return ms.echo.Start(":8080")
 }
 
-func (ms *Microservice) stopHTTP() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	ms.echo.Shutdown(ctx)
+// stopHTTP stop accepting new request and wait for in-flight requests until ctx is done
+func (ms *Microservice) stopHTTP(ctx context.Context) {
+	err := ms.echo.Shutdown(ctx)
+	if err != nil {
+		ms.LogError("HTTP", err)
+	}
 }
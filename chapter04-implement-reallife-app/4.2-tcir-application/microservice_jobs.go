@@ -0,0 +1,158 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// defaultJobRunsLimit is the number of runs that are listed if limit is not set
+	defaultJobRunsLimit = 20
+	// jobPreviewRuns is the number of next run times in job list
+	jobPreviewRuns = 5
+)
+
+// jobInfo is the job in the list of job admin endpoint
+type jobInfo struct {
+	Name     string      `json:"name"`
+	Spec     string      `json:"spec"`
+	Timezone string      `json:"timezone"`
+	Paused   bool        `json:"paused"`
+	NextRuns []time.Time `json:"next_runs"`
+	LastRun  *JobRun     `json:"last_run,omitempty"`
+}
+
+// SetJobStore set the store of scheduler runs and paused schedules, it must be shared by every instances
+// (such as RedisJobStore) to pause the schedule on every instances, by default the runs are kept in memory
+func (ms *Microservice) SetJobStore(store IJobStore) {
+	ms.jobStore = store
+}
+
+// saveJobRun save run to job store, the run is not failed if it cannot be saved
+func (ms *Microservice) saveJobRun(run *JobRun) {
+	err := ms.jobStore.SaveRun(run)
+	if err != nil {
+		ms.LogError("Scheduler", err)
+	}
+}
+
+// getScheduleJob return the registered schedule by name, or nil
+func (ms *Microservice) getScheduleJob(name string) *scheduleJob {
+	ms.scheduleMutex.Lock()
+	defer ms.scheduleMutex.Unlock()
+	return ms.schedules[name]
+}
+
+// sortJobNames return names of the registered schedules in order
+func (ms *Microservice) sortJobNames() []string {
+	ms.scheduleMutex.Lock()
+	defer ms.scheduleMutex.Unlock()
+	names := make([]string, 0, len(ms.schedules))
+	for name := range ms.schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterJobAdminEndpoints register admin endpoints of schedules under prefix (such as /admin/jobs)
+// GET prefix list schedules with the next run times and the last run
+// GET prefix/:name/runs?limit=20 list the latest runs of schedule
+// POST prefix/:name/trigger run schedule immediately, the manual run is run even if the schedule has paused
+// POST prefix/:name/pause and prefix/:name/resume pause and resume the scheduled runs (on every instances)
+func (ms *Microservice) RegisterJobAdminEndpoints(prefix string) {
+	ms.echo.GET(prefix, func(c echo.Context) error {
+		jobs := []*jobInfo{}
+		for _, name := range ms.sortJobNames() {
+			job := ms.getScheduleJob(name)
+			info := &jobInfo{
+				Name:     name,
+				Spec:     job.spec,
+				Timezone: job.location.String(),
+			}
+			paused, err := ms.jobStore.IsPaused(name)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			info.Paused = paused
+			info.NextRuns, _ = ms.NextScheduleRuns(name, jobPreviewRuns)
+			runs, err := ms.jobStore.ListRuns(name, 1)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			if len(runs) > 0 {
+				info.LastRun = runs[0]
+			}
+			jobs = append(jobs, info)
+		}
+		return c.JSON(http.StatusOK, jobs)
+	})
+
+	ms.echo.GET(prefix+"/:name/runs", func(c echo.Context) error {
+		name := c.Param("name")
+		if ms.getScheduleJob(name) == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Schedule " + name + " is not found"})
+		}
+		limit := defaultJobRunsLimit
+		if s := c.QueryParam("limit"); len(s) > 0 {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 || n > maxJobRuns {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be 1 to " + strconv.Itoa(maxJobRuns)})
+			}
+			limit = n
+		}
+		runs, err := ms.jobStore.ListRuns(name, limit)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, runs)
+	})
+
+	ms.echo.POST(prefix+"/:name/trigger", func(c echo.Context) error {
+		name := c.Param("name")
+		job := ms.getScheduleJob(name)
+		if job == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Schedule " + name + " is not found"})
+		}
+		if ms.isStopping() {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Service is shutting down"})
+		}
+		// The run is not bound to the request, so it is not cancelled when the client has disconnected
+		scheduled := time.Now().In(job.location)
+		ms.startWorker(func() {
+			ms.runSchedule(job, scheduled, JobTriggerManual)
+		})
+		ms.logger.With(LogFields{"tag": "Scheduler", "schedule": name}).Warn("Schedule has been triggered manually")
+		return c.JSON(http.StatusAccepted, map[string]interface{}{
+			"schedule":       name,
+			"trigger":        JobTriggerManual,
+			"scheduled_time": scheduled,
+		})
+	})
+
+	setPaused := func(paused bool) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			name := c.Param("name")
+			if ms.getScheduleJob(name) == nil {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Schedule " + name + " is not found"})
+			}
+			err := ms.jobStore.SetPaused(name, paused)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			message := "Schedule has resumed"
+			if paused {
+				message = "Schedule has paused"
+			}
+			ms.logger.With(LogFields{"tag": "Scheduler", "schedule": name}).Warn(message)
+			return c.JSON(http.StatusOK, map[string]interface{}{"schedule": name, "paused": paused})
+		}
+	}
+	ms.echo.POST(prefix+"/:name/pause", setPaused(true))
+	ms.echo.POST(prefix+"/:name/resume", setPaused(false))
+}
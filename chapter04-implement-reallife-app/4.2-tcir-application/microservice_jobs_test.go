@@ -0,0 +1,125 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testJobAdmin return microservice with job admin endpoints and the registered job, the count is the number of runs
+func testJobAdmin(t *testing.T, count *int) (*Microservice, *scheduleJob) {
+	ms := NewMicroservice()
+	ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+	job := &scheduleJob{
+		name:     "job",
+		schedule: &intervalSchedule{period: time.Minute},
+		location: time.UTC,
+		options:  &ScheduleOptions{},
+	}
+	err := ms.registerSchedule(job, func(ctx IContext) error {
+		*count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.RegisterJobAdminEndpoints("/admin/jobs")
+	return ms, job
+}
+
+// serveJobAdmin send request to job admin endpoint and return the recorded response
+func serveJobAdmin(ms *Microservice, method string, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	rec := httptest.NewRecorder()
+	ms.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestJobAdminEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+		wantRuns int
+	}{
+		{"list", http.MethodGet, "/admin/jobs", http.StatusOK, -1},
+		{"runs of unknown job", http.MethodGet, "/admin/jobs/unknown/runs", http.StatusNotFound, -1},
+		{"trigger unknown job", http.MethodPost, "/admin/jobs/unknown/trigger", http.StatusNotFound, -1},
+		{"pause unknown job", http.MethodPost, "/admin/jobs/unknown/pause", http.StatusNotFound, -1},
+		{"resume unknown job", http.MethodPost, "/admin/jobs/unknown/resume", http.StatusNotFound, -1},
+		{"default limit", http.MethodGet, "/admin/jobs/job/runs", http.StatusOK, defaultJobRunsLimit},
+		{"limit 1", http.MethodGet, "/admin/jobs/job/runs?limit=1", http.StatusOK, 1},
+		{"limit 100", http.MethodGet, "/admin/jobs/job/runs?limit=100", http.StatusOK, 30},
+		{"limit 0", http.MethodGet, "/admin/jobs/job/runs?limit=0", http.StatusBadRequest, -1},
+		{"limit -1", http.MethodGet, "/admin/jobs/job/runs?limit=-1", http.StatusBadRequest, -1},
+		{"limit 101", http.MethodGet, "/admin/jobs/job/runs?limit=101", http.StatusBadRequest, -1},
+		{"limit is not number", http.MethodGet, "/admin/jobs/job/runs?limit=abc", http.StatusBadRequest, -1},
+	}
+
+	count := 0
+	ms, _ := testJobAdmin(t, &count)
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		ms.saveJobRun(testJobRun(i, start))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJobAdmin(ms, tt.method, tt.path)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantRuns < 0 {
+				return
+			}
+			runs := []*JobRun{}
+			err := json.Unmarshal(rec.Body.Bytes(), &runs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != tt.wantRuns || runs[0].ID != "run-29" {
+				t.Errorf("runs = %d, want %d runs from run-29", len(runs), tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestJobAdminPauseResume(t *testing.T) {
+	count := 0
+	ms, job := testJobAdmin(t, &count)
+
+	steps := []struct {
+		path      string
+		wantPause bool
+		wantCount int
+	}{
+		{"/admin/jobs/job/pause", true, 0},
+		{"/admin/jobs/job/resume", false, 1},
+		{"/admin/jobs/job/pause", true, 1},
+	}
+	for _, step := range steps {
+		rec := serveJobAdmin(ms, http.MethodPost, step.path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s status code = %d, want 200", step.path, rec.Code)
+		}
+
+		// The paused flag is listed, and the scheduled run follow it
+		rec = serveJobAdmin(ms, http.MethodGet, "/admin/jobs")
+		jobs := []*jobInfo{}
+		err := json.Unmarshal(rec.Body.Bytes(), &jobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 || jobs[0].Paused != step.wantPause {
+			t.Errorf("after POST %s jobs = %+v, want paused %v", step.path, jobs, step.wantPause)
+		}
+		ms.runSchedule(job, time.Now(), JobTriggerSchedule)
+		if count != step.wantCount {
+			t.Errorf("after POST %s runs = %d, want %d", step.path, count, step.wantCount)
+		}
+	}
+}
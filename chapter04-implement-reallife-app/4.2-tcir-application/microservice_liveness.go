@@ -7,47 +7,16 @@ import (
 	"github.com/labstack/echo"
 )
 
-func (ms *Microservice) isCacherAlive() bool {
-	if ms.cacher == nil {
-		return true
-	}
-
-	ms.Log("MS", "Perform healthcheck on Cacher")
-	err := ms.cacher.Healthcheck()
-	if err != nil {
-		return false
-	}
-	return true
-}
-
-func (ms *Microservice) isAlive() (bool, string) {
-	isAlive := ms.isCacherAlive()
-	if !isAlive {
-		return false, "Cacher healthcheck failed"
-	}
-
-	return true, ""
-}
-
 func (ms *Microservice) responseProbeOK(resp *echo.Response) {
 	resp.WriteHeader(http.StatusOK)
 	resp.Write([]byte("ok"))
 }
 
-func (ms *Microservice) responseProbeFailed(resp *echo.Response, reason string) {
-	errMsg := "Healthcheck failed because of " + reason
-	resp.WriteHeader(http.StatusInternalServerError)
-	resp.Write([]byte(errMsg))
-}
-
-// RegisterLivenessProbeEndpoint register endpoint for liveness probe
+// RegisterLivenessProbeEndpoint register endpoint for liveness probe, it check only the process itself
+// (the HTTP server can response), the dependencies are checked by readiness probe,
+// so the pod is not restarted when Redis or Kafka is down
 func (ms *Microservice) RegisterLivenessProbeEndpoint(path string) {
 	ms.echo.GET(path, func(c echo.Context) error {
-		ok, reason := ms.isAlive()
-		if !ok {
-			ms.responseProbeFailed(c.Response(), reason)
-			return nil
-		}
 		ms.responseProbeOK(c.Response())
 		return nil
 	})
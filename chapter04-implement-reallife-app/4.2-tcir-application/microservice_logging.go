@@ -0,0 +1,74 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo"
+)
+
+// logLevelRequest is the body of log level endpoint
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// SetLogger set logger of service and every contexts, it must be called before services are registered
+// By default, the entries at info level and above are written to stdout in JSON
+func (ms *Microservice) SetLogger(logger ILogger) {
+	ms.logger = logger
+}
+
+// Logger return logger of this service
+func (ms *Microservice) Logger() ILogger {
+	return ms.logger
+}
+
+// Log log message at info level, tag is written in tag field
+func (ms *Microservice) Log(tag string, message string) {
+	ms.logger.With(LogFields{"tag": tag}).WithCallerSkip(1).Info(message)
+}
+
+// LogError log err at error level, tag is written in tag field
+func (ms *Microservice) LogError(tag string, err error) {
+	ms.logger.With(LogFields{"tag": tag}).WithCallerSkip(1).Error(err.Error())
+}
+
+// RegisterLogLevelEndpoint register admin endpoint to read (GET) and change (PUT {"level": "debug"}) the log level
+// without restarting the service, the new level apply to every contexts immediately
+func (ms *Microservice) RegisterLogLevelEndpoint(path string) {
+	ms.echo.GET(path, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, logLevelRequest{Level: ms.logger.Level().String()})
+	})
+	ms.echo.PUT(path, func(c echo.Context) error {
+		req := logLevelRequest{}
+		err := c.Bind(&req)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		level, err := ParseLogLevel(req.Level)
+		if err != nil || len(req.Level) == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "level must be debug, info, warn or error"})
+		}
+
+		prev := ms.logger.Level()
+		ms.logger.SetLevel(level)
+		ms.logger.With(LogFields{"tag": "MS", "prev_level": prev.String()}).Warn("Log level has changed to " + level.String())
+		return c.JSON(http.StatusOK, logLevelRequest{Level: level.String()})
+	})
+}
+
+// newDefaultLogger return logger that write JSON to stdout at info level
+func newDefaultLogger() ILogger {
+	return NewLogger(NewJSONLogSink(os.Stdout), LogLevelInfo)
+}
+
+// contextLogger return logger of context with fields of the span (trace_id and span_id)
+func (ms *Microservice) contextLogger(span *Span, fields LogFields) ILogger {
+	sc := span.SpanContext()
+	if sc.IsValid() {
+		fields["trace_id"] = sc.TraceID
+		fields["span_id"] = sc.SpanID
+	}
+	return ms.logger.With(fields)
+}
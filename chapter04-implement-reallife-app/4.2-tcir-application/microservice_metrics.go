@@ -0,0 +1,140 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// RegisterMetricsEndpoint register endpoint that expose built-in and business metrics in Prometheus format
+func (ms *Microservice) RegisterMetricsEndpoint(path string) {
+	ms.echo.GET(path, echo.WrapHandler(promhttp.HandlerFor(ms.metrics.registry, promhttp.HandlerOpts{})))
+}
+
+// Metrics return business metrics of this service
+func (ms *Microservice) Metrics() IMetrics {
+	return ms.metrics
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// httpHandler return echo handler that execute h, observe its latency by route (not the actual URL) and end its span
+func (ms *Microservice) httpHandler(path string, h ServiceHandleFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		ctx := NewHTTPContext(ms, c)
+		err := h(ctx)
+
+		status := c.Response().Status
+		if err != nil && !c.Response().Committed {
+			// The error is responded by echo after this handler has returned
+			status = http.StatusInternalServerError
+			httpErr, ok := err.(*echo.HTTPError)
+			if ok {
+				status = httpErr.Code
+			}
+		}
+		ms.metrics.httpDuration.WithLabelValues(c.Request().Method, path, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+
+		ctx.Span().SetAttribute("http.status_code", status)
+		spanErr := err
+		if spanErr == nil && status >= http.StatusInternalServerError {
+			spanErr = errors.New(http.StatusText(status))
+		}
+		ctx.Span().End(spanErr)
+		return err
+	}
+}
+
+// consumerHandler return handler that execute h, count the handled messages by topic and end the consumer span
+func (ms *Microservice) consumerHandler(groupID string, h ServiceHandleFunc) ServiceHandleFunc {
+	return func(ctx IContext) error {
+		start := time.Now()
+		err := h(ctx)
+		ctx.Span().SetAttribute("messaging.consumer_group", groupID)
+		ctx.Span().End(err)
+
+		messages := ctx.ReadMessages()
+		if len(messages) == 0 && ctx.ReadMessage() != nil {
+			messages = []*Message{ctx.ReadMessage()}
+		}
+		counts := map[string]int{}
+		for _, message := range messages {
+			counts[message.Topic]++
+		}
+		for topic, count := range counts {
+			ms.metrics.consumerDuration.WithLabelValues(groupID, topic).Observe(time.Since(start).Seconds())
+			ms.metrics.consumerMessages.WithLabelValues(groupID, topic, resultLabel(err)).Add(float64(count))
+		}
+		return err
+	}
+}
+
+// observeBatch observe size and reason of executed batch
+func (ms *Microservice) observeBatch(name string) BatchObserveFunc {
+	return func(size int, reason string) {
+		ms.metrics.batchSize.WithLabelValues(name).Observe(float64(size))
+		ms.metrics.batchFlushes.WithLabelValues(name, reason).Inc()
+	}
+}
+
+// observeSchedule observe duration of scheduler run, schedule is the name of schedule
+func (ms *Microservice) observeSchedule(schedule string, start time.Time, err error) {
+	ms.metrics.schedulerDuration.WithLabelValues(schedule, resultLabel(err)).Observe(time.Since(start).Seconds())
+}
+
+// observeRequest observe latency of outbound HTTP request by host (not the full URL)
+func (ms *Microservice) observeRequest(method string, rawURL string, start time.Time, res *http.Response, err error) {
+	host := ""
+	u, parseErr := url.Parse(rawURL)
+	if parseErr == nil {
+		host = u.Host
+	}
+	status := "error"
+	if err == nil && res != nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	ms.metrics.requesterDuration.WithLabelValues(method, host, status).Observe(time.Since(start).Seconds())
+}
+
+// instrumentRedis observe latency of every commands of client, the clients from WithContext share the same hooks
+func (ms *Microservice) instrumentRedis(client *redis.Client) {
+	client.WrapProcess(func(process func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			result := err
+			if err == redis.Nil {
+				// Key does not exist is not an error of Redis
+				result = nil
+			}
+			ms.metrics.cacherDuration.WithLabelValues(cmd.Name(), resultLabel(result)).Observe(time.Since(start).Seconds())
+			return err
+		}
+	})
+	client.WrapProcessPipeline(func(process func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			start := time.Now()
+			err := process(cmds)
+			result := err
+			if err == redis.Nil {
+				result = nil
+			}
+			ms.metrics.cacherDuration.WithLabelValues("pipeline", resultLabel(result)).Observe(time.Since(start).Seconds())
+			return err
+		}
+	})
+}
@@ -0,0 +1,17 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+// Use add middlewares to every services that are registered after it (HTTP, consumer, batch consumer, scheduler,
+// AsyncTask and PTask), the first middleware is the outermost
+// The probes, metrics and admin endpoints are not wrapped
+func (ms *Microservice) Use(middlewares ...MiddlewareFunc) {
+	ms.middlewares = append(ms.middlewares, middlewares...)
+}
+
+// withMiddlewares return h that is wrapped with the global middlewares then middlewares
+func (ms *Microservice) withMiddlewares(h ServiceHandleFunc, middlewares []MiddlewareFunc) ServiceHandleFunc {
+	all := make([]MiddlewareFunc, 0, len(ms.middlewares)+len(middlewares))
+	all = append(all, ms.middlewares...)
+	all = append(all, middlewares...)
+	return chainMiddlewares(h, all)
+}
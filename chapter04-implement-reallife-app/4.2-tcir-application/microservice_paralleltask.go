@@ -9,33 +9,117 @@ import (
 	"time"
 )
 
+// ptaskMessage is the message sent from ParallelTask endpoint to each worker
+type ptaskMessage struct {
+	TaskID   string `json:"task_id"`
+	WorkerID string `json:"worker_id"`
+	Input    string `json:"input"`
+}
+
+// The status of task is kept in hash, so each workers update only their own field
+const (
+	// ptaskStatusField is "running" or "complete"
+	ptaskStatusField = "status"
+	// ptaskRunningField is the number of workers that are running
+	ptaskRunningField = "running"
+	// ptaskWorkersField is the worker ids in order
+	ptaskWorkersField = "workers"
+	ptaskExpire       = 30 * time.Minute
+)
+
+// ptaskWorkerField return the field of worker status
+func ptaskWorkerField(workerID string) string {
+	return "worker:" + workerID
+}
+
+// completePTaskWorkerScript set worker status, and set task status to complete if it is the last running worker
+// It return the number of running workers, or -1 if the worker is not found (such as the task has expired)
+// The worker that has completed is not counted again (such as the message has been redelivered)
+// KEYS[1] = task id, ARGV[1] = worker field, ARGV[2] = worker status, ARGV[3] = complete task status
+const completePTaskWorkerScript = `
+local current = redis.call("HGET", KEYS[1], ARGV[1])
+if not current then
+	return -1
+end
+if cjson.decode(current)["status"] ~= "running" then
+	return tonumber(redis.call("HGET", KEYS[1], "running"))
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+local running = redis.call("HINCRBY", KEYS[1], "running", -1)
+if running <= 0 then
+	redis.call("HSET", KEYS[1], "status", ARGV[3])
+end
+return running
+`
+
+// readPTaskStatus return status of task with the workers in order, it is empty if the task does not exist
+func readPTaskStatus(cacher ICacher, taskID string) (map[string]interface{}, error) {
+	fields, err := cacher.HGetAll(taskID)
+	if err != nil {
+		return nil, err
+	}
+	status := map[string]interface{}{}
+	if len(fields) == 0 {
+		return status, nil
+	}
+
+	taskStatus := ""
+	err = json.Unmarshal([]byte(fields[ptaskStatusField]), &taskStatus)
+	if err != nil {
+		return nil, err
+	}
+	workerIDs := []string{}
+	err = json.Unmarshal([]byte(fields[ptaskWorkersField]), &workerIDs)
+	if err != nil {
+		return nil, err
+	}
+	workers := []interface{}{}
+	for _, workerID := range workerIDs {
+		worker := map[string]interface{}{}
+		err = json.Unmarshal([]byte(fields[ptaskWorkerField(workerID)]), &worker)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, worker)
+	}
+	status["status"] = taskStatus
+	status["workers"] = workers
+	return status, nil
+}
+
 // ptaskWorker register worker node for ParallelTask
 func (ms *Microservice) ptaskWorkerNode(path string, cacheServer string, mqServers string, h ServiceHandleFunc) {
 	topic := escapeName("ptask", path)
+	ms.metrics.watchQueue("ptask", topic)
 	mq := NewMQ(mqServers, ms)
 	err := mq.CreateTopicR(topic, 5, 1, time.Hour*24*30)
 	if err != nil {
-		ms.Log("PTASK", err.Error())
+		ms.LogError("PTASK", err)
 		return
 	}
 
 	ms.Consume(mqServers, topic, "ptask", -1, func(ctx IContext) error {
-		message := map[string]interface{}{}
-		err := json.Unmarshal([]byte(ctx.ReadInput()), &message)
+		message := &ptaskMessage{}
+		err := ctx.BindInput(message)
 		if err != nil {
-			ms.Log("PTASK", err.Error())
+			ms.LogError("PTASK", err)
 			return err
 		}
-		taskID, _ := message["task_id"].(string)
-		workerID, _ := message["worker_id"].(string)
-		input, _ := message["input"].(string)
-		return h(NewPTaskContext(ms, cacheServer, taskID, workerID, input))
+		taskCtx := NewPTaskContext(ms, ctx.Context(), cacheServer, message.TaskID, message.WorkerID, message.Input)
+		err = h(taskCtx)
+		taskCtx.Span().End(err)
+		return err
 	})
 }
 
-// PTaskWorkerNode register worker node for ParallelTask
+// PTaskWorkerNode register worker node for ParallelTask, the topic is created after startup has completed
 func (ms *Microservice) PTaskWorkerNode(path string, cacheServer string, mqServers string, h ServiceHandleFunc) {
-	go ms.ptaskWorkerNode(path, cacheServer, mqServers, h)
+	go func() {
+		if !ms.waitStarted() {
+			return
+		}
+		ms.ptaskWorkerNode(path, cacheServer, mqServers, h)
+	}()
 }
 
 func (ms *Microservice) handlePTaskPOST(path string, cacheServer string, mqServers string, ctx IContext) error {
@@ -53,21 +137,32 @@ func (ms *Microservice) handlePTaskPOST(path string, cacheServer string, mqServe
 	// 2. Get status of current task
 	// - If it is running, then return
 	// - If it is not running, then start task
+	// The status is read and set under the lock, so only one request start the task
 	taskID := "ptask-" + taskIDParam
 	cacher := ctx.Cacher(cacheServer)
-	statusStr, err := cacher.Get(taskID)
+	lock, err := cacher.TryLock(taskID, 30*time.Second)
+	if err == ErrLockNotAcquired {
+		// The task is starting by the other request
+		return nil
+	}
 	if err != nil {
-		ms.Log("PTASK", err.Error())
+		ms.LogError("PTASK", err)
+		return err
+	}
+	defer lock.Release()
+
+	statusStr, err := cacher.HGet(taskID, ptaskStatusField)
+	if err != nil {
+		ms.LogError("PTASK", err)
 		return err
 	}
-	status := map[string]interface{}{}
 	if len(statusStr) != 0 {
-		err = json.Unmarshal([]byte(statusStr), &status)
+		taskStatus := ""
+		err = json.Unmarshal([]byte(statusStr), &taskStatus)
 		if err != nil {
-			ms.Log("PTASK", err.Error())
+			ms.LogError("PTASK", err)
 			return err
 		}
-		taskStatus, _ := status["status"].(string)
 		if taskStatus == "running" {
 			return nil
 		}
@@ -78,38 +173,44 @@ func (ms *Microservice) handlePTaskPOST(path string, cacheServer string, mqServe
 	if err != nil {
 		workerCount = 3 // default workers size
 	}
-	workers := []map[string]interface{}{}
-	messages := []map[string]interface{}{}
+	workerIDs := []string{}
+	status := map[string]interface{}{}
+	messages := []*ProducerMessage{}
 	for i := 0; i < workerCount; i++ {
 		workerID := taskID + "-" + randString()
-		message := map[string]interface{}{
-			"task_id":   taskID,
-			"worker_id": workerID,
-			"input":     input,
+		message := &ptaskMessage{
+			TaskID:   taskID,
+			WorkerID: workerID,
+			Input:    input,
 		}
-		messages = append(messages, message)
+		messages = append(messages, &ProducerMessage{Topic: topic, Message: message})
 
-		workers = append(workers, map[string]interface{}{
+		workerIDs = append(workerIDs, workerID)
+		status[ptaskWorkerField(workerID)] = map[string]interface{}{
 			"status":    "running",
 			"worker_id": workerID,
 			"code":      "",
 			"response":  "",
 			"error":     "",
-		})
-	}
-	status = map[string]interface{}{
-		"status":  "running",
-		"workers": workers,
+		}
 	}
+	status[ptaskStatusField] = "running"
+	status[ptaskRunningField] = workerCount
+	status[ptaskWorkersField] = workerIDs
 
-	// 4. Set Status in Cache
-	expire := time.Minute * 30
-	cacher.Set(taskID, status, expire)
+	// 4. Set Status in Cache, the worker fields of the previous run are deleted
+	err = cacher.HReplace(taskID, status, ptaskExpire)
+	if err != nil {
+		ms.LogError("PTASK", err)
+		return err
+	}
 
-	// 5. Send message to start ptask
+	// 5. Send message to start ptask (send all workers together, and wait for every delivery reports)
 	prod := ctx.Producer(mqServers)
-	for _, message := range messages {
-		prod.SendMessage(topic, "", message)
+	err = prod.SendMessages(messages)
+	if err != nil {
+		ms.LogError("PTASK", err)
+		return err
 	}
 
 	// 6. Response task_id
@@ -133,20 +234,11 @@ func (ms *Microservice) handlePTaskGET(path string, cacheServer string, mqServer
 	// - If it is running, then return
 	// - If it is not running, then start task
 	taskID := "ptask-" + taskIDParam
-	cacher := ctx.Cacher(cacheServer)
-	statusStr, err := cacher.Get(taskID)
+	status, err := readPTaskStatus(ctx.Cacher(cacheServer), taskID)
 	if err != nil {
-		ms.Log("PTASK", err.Error())
+		ms.LogError("PTASK", err)
 		return err
 	}
-	status := map[string]interface{}{}
-	if len(statusStr) > 0 {
-		err = json.Unmarshal([]byte(statusStr), &status)
-		if err != nil {
-			ms.Log("PTASK", err.Error())
-			return err
-		}
-	}
 
 	ctx.Response(http.StatusOK, status)
 	return nil
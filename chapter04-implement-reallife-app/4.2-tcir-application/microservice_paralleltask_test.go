@@ -0,0 +1,126 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// testPTaskStatus return status of task that is started with the workers, as it is set by PTask endpoint
+func testPTaskStatus(workerIDs []string) map[string]interface{} {
+	status := map[string]interface{}{}
+	for _, workerID := range workerIDs {
+		status[ptaskWorkerField(workerID)] = map[string]interface{}{
+			"status":    "running",
+			"worker_id": workerID,
+			"code":      "",
+			"response":  "",
+			"error":     "",
+		}
+	}
+	status[ptaskStatusField] = "running"
+	status[ptaskRunningField] = len(workerIDs)
+	status[ptaskWorkersField] = workerIDs
+	return status
+}
+
+func TestPTaskConcurrentCompletion(t *testing.T) {
+	tests := []struct {
+		name        string
+		workers     []string
+		completions []string
+		wantRunning string
+		wantStatus  string
+	}{
+		{"two workers complete at the same time", []string{"w1", "w2"}, []string{"w1", "w2"}, "0", "complete"},
+		{"redelivered worker is not counted again", []string{"w1", "w2"}, []string{"w1", "w1", "w2", "w2"}, "0", "complete"},
+		{"one worker is running", []string{"w1", "w2", "w3"}, []string{"w1", "w3", "w3"}, "1", "running"},
+		{"unknown worker is ignored", []string{"w1", "w2"}, []string{"w1", "w9"}, "1", "running"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacher, mr := newTestCacher(t)
+			defer mr.Close()
+			defer cacher.Close()
+			err := cacher.HReplace("ptask-1", testPTaskStatus(tt.workers), ptaskExpire)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Each workers complete in their own goroutine, as they are run by the consumers in the other nodes
+			var wg sync.WaitGroup
+			for _, workerID := range tt.completions {
+				wg.Add(1)
+				go func(workerID string) {
+					defer wg.Done()
+					ctx := NewPTaskContext(cacher.ms, context.Background(), mr.Addr(), "ptask-1", workerID, "")
+					ctx.Response(http.StatusOK, map[string]string{"worker": workerID})
+				}(workerID)
+			}
+			wg.Wait()
+
+			if running := mr.HGet("ptask-1", ptaskRunningField); running != tt.wantRunning {
+				t.Errorf("running = %s, want %s", running, tt.wantRunning)
+			}
+			status, err := readPTaskStatus(cacher, "ptask-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status["status"] != tt.wantStatus {
+				t.Errorf("status = %v, want %s", status["status"], tt.wantStatus)
+			}
+			completed := map[string]bool{}
+			for _, workerID := range tt.completions {
+				completed[workerID] = true
+			}
+			for _, worker := range status["workers"].([]interface{}) {
+				w := worker.(map[string]interface{})
+				want := "running"
+				if completed[w["worker_id"].(string)] {
+					want = "complete"
+				}
+				if w["status"] != want {
+					t.Errorf("worker %s status = %v, want %s", w["worker_id"], w["status"], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPTaskRestartReplacePreviousRun(t *testing.T) {
+	cacher, mr := newTestCacher(t)
+	defer mr.Close()
+	defer cacher.Close()
+
+	// The previous run has 3 workers, and has completed
+	err := cacher.HReplace("ptask-1", testPTaskStatus([]string{"w1", "w2", "w3"}), ptaskExpire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.HSet("ptask-1", ptaskRunningField, "0")
+	mr.HSet("ptask-1", ptaskStatusField, `"complete"`)
+
+	// The task is restarted with 2 workers
+	err = cacher.HReplace("ptask-1", testPTaskStatus([]string{"w4", "w5"}), ptaskExpire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := mr.HKeys("ptask-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprint([]string{ptaskRunningField, ptaskStatusField, ptaskWorkerField("w4"), ptaskWorkerField("w5"), ptaskWorkersField})
+	if got := fmt.Sprint(fields); got != want {
+		t.Errorf("fields = %s, want %s", got, want)
+	}
+	if running := mr.HGet("ptask-1", ptaskRunningField); running != "2" {
+		t.Errorf("running = %s, want 2", running)
+	}
+	if ttl := mr.TTL("ptask-1"); ttl != ptaskExpire {
+		t.Errorf("TTL() = %s, want %s", ttl, ptaskExpire)
+	}
+}
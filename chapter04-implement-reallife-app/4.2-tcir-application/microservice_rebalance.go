@@ -0,0 +1,104 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Partition is the topic partition that has assigned to or revoked from the consumer
+type Partition struct {
+	Topic     string
+	Partition int32
+}
+
+// RebalanceHandleFunc is the handler when partitions of consumer group have changed,
+// it can be used to setup (assigned) and cleanup (revoked) per partition state
+type RebalanceHandleFunc func(groupID string, partitions []Partition) error
+
+// OnPartitionsAssigned register handler that is called when partitions are assigned to any consumer,
+// it is called before the first message of assigned partitions is delivered
+func (ms *Microservice) OnPartitionsAssigned(h RebalanceHandleFunc) {
+	ms.rebalanceMutex.Lock()
+	defer ms.rebalanceMutex.Unlock()
+	ms.onAssigned = append(ms.onAssigned, h)
+}
+
+// OnPartitionsRevoked register handler that is called when partitions are revoked from any consumer,
+// it is called after the pending messages of revoked partitions have been handled and their offsets have been committed
+func (ms *Microservice) OnPartitionsRevoked(h RebalanceHandleFunc) {
+	ms.rebalanceMutex.Lock()
+	defer ms.rebalanceMutex.Unlock()
+	ms.onRevoked = append(ms.onRevoked, h)
+}
+
+// rebalanceCallback return kafka rebalance callback that execute registered hooks of groupID,
+// onRevoke (if not nil) is executed before hooks to finish the pending works of revoked partitions
+// The callback is called inside ReadMessage, so it run in the same goroutine that read message
+func (ms *Microservice) rebalanceCallback(groupID string, onRevoke func(c *kafka.Consumer, tps []kafka.TopicPartition)) kafka.RebalanceCb {
+	member := ms.newGroupMember()
+	return func(c *kafka.Consumer, ev kafka.Event) error {
+		switch e := ev.(type) {
+		case kafka.AssignedPartitions:
+			ms.Log("Consumer", fmt.Sprintf("Partitions assigned to %s: %v", groupID, e.Partitions))
+			ms.setGroupMember(groupID, member, true)
+			ms.executeRebalanceHooks(groupID, e.Partitions, ms.rebalanceHooks(true))
+		case kafka.RevokedPartitions:
+			ms.Log("Consumer", fmt.Sprintf("Partitions revoked from %s: %v", groupID, e.Partitions))
+			ms.setGroupMember(groupID, member, false)
+			if onRevoke != nil {
+				onRevoke(c, e.Partitions)
+			}
+			ms.executeRebalanceHooks(groupID, e.Partitions, ms.rebalanceHooks(false))
+		}
+		// Assign / Unassign is done by kafka client after this callback has returned
+		return nil
+	}
+}
+
+func (ms *Microservice) rebalanceHooks(assigned bool) []RebalanceHandleFunc {
+	ms.rebalanceMutex.Lock()
+	defer ms.rebalanceMutex.Unlock()
+	if assigned {
+		return append([]RebalanceHandleFunc{}, ms.onAssigned...)
+	}
+	return append([]RebalanceHandleFunc{}, ms.onRevoked...)
+}
+
+func (ms *Microservice) executeRebalanceHooks(groupID string, tps []kafka.TopicPartition, hooks []RebalanceHandleFunc) {
+	if len(hooks) == 0 {
+		return
+	}
+	partitions := make([]Partition, 0, len(tps))
+	for _, tp := range tps {
+		topic := ""
+		if tp.Topic != nil {
+			topic = *tp.Topic
+		}
+		partitions = append(partitions, Partition{
+			Topic:     topic,
+			Partition: tp.Partition,
+		})
+	}
+	for _, h := range hooks {
+		err := h(groupID, partitions)
+		if err != nil {
+			ms.LogError("Consumer", err)
+		}
+	}
+}
+
+// commitOffsets commit the stored offsets immediately, it is used before partitions are revoked
+// so the new owner of the partitions will not consume the handled messages again
+func (ms *Microservice) commitOffsets(c *kafka.Consumer) {
+	_, err := c.Commit()
+	if err != nil {
+		kafkaErr, ok := err.(kafka.Error)
+		if ok && kafkaErr.Code() == kafka.ErrNoOffset {
+			// No new offset has stored since the last commit
+			return
+		}
+		ms.LogError("Consumer", err)
+	}
+}
@@ -2,57 +2,353 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// scheduleJob is the registered schedule
+type scheduleJob struct {
+	name     string
+	spec     string
+	schedule ISchedule
+	location *time.Location
+	options  *ScheduleOptions
+	h        ServiceHandleFunc
+
+	// next is the time of the next run, it is set when the scheduler has started
+	next  time.Time
+	mutex sync.Mutex
+}
+
+func (job *scheduleJob) setNext(next time.Time) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.next = next
+}
+
+func (job *scheduleJob) getNext() time.Time {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.next
+}
+
 // Schedule will run handler at timer period
-func (ms *Microservice) Schedule(timer time.Duration, h ServiceHandleFunc) chan bool /*exit channel*/ {
+// The run that is later than 10s (such as the previous run is still running) is skipped, it can be changed by WithMisfirePolicy
+// The timer must be more than 0, otherwise the error is logged and the job is not started
+func (ms *Microservice) Schedule(timer time.Duration, h ServiceHandleFunc, opts ...ScheduleOption) chan bool /*exit channel*/ {
+	if timer <= 0 {
+		// The next run would be now (or before), so the handler would run again without pause
+		ms.LogError("Scheduler", fmt.Errorf("Schedule timer must be more than 0, but got %s", timer))
+		return make(chan bool, 1)
+	}
+	options, location, err := newScheduleOptions(opts)
+	if err != nil {
+		// Interval does not depend on timezone, only ctx.Now() is in UTC
+		ms.LogError("Scheduler", err)
+	}
+	// Singleton compare the scheduled time between instances, so the times must be the same
+	job := &scheduleJob{
+		name:     options.Name,
+		spec:     "@every " + timer.String(),
+		schedule: &intervalSchedule{period: timer, aligned: len(options.SingletonCacheServer) > 0},
+		location: location,
+		options:  options,
+	}
+	if len(job.name) == 0 {
+		job.name = ms.uniqueScheduleName(timer.String())
+	}
+	err = ms.registerSchedule(job, h)
+	if err != nil {
+		ms.LogError("Scheduler", err)
+	}
+	return ms.startSchedule(job)
+}
+
+// ScheduleCron will run handler at the times of cron expression, such as "0 0 * * *" (every midnight)
+// or "*/30 * * * * *" (every 30 seconds), ctx.Now() return the scheduled time in timezone of the schedule
+func (ms *Microservice) ScheduleCron(spec string, h ServiceHandleFunc, opts ...ScheduleOption) (chan bool /*exit channel*/, error) {
+	options, location, err := newScheduleOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := ParseCron(spec, location)
+	if err != nil {
+		return nil, err
+	}
+	job := &scheduleJob{
+		name:     options.Name,
+		spec:     spec,
+		schedule: schedule,
+		location: location,
+		options:  options,
+	}
+	if len(job.name) == 0 {
+		job.name = ms.uniqueScheduleName(spec)
+	}
+	err = ms.registerSchedule(job, h)
+	if err != nil {
+		return nil, err
+	}
+	return ms.startSchedule(job), nil
+}
+
+// NextScheduleRuns return the next n run times of schedule by name, in timezone of the schedule
+func (ms *Microservice) NextScheduleRuns(name string, n int) ([]time.Time, error) {
+	ms.scheduleMutex.Lock()
+	job, ok := ms.schedules[name]
+	ms.scheduleMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Schedule %s is not found", name)
+	}
+	if n <= 0 {
+		return []time.Time{}, nil
+	}
 
+	next := job.getNext()
+	if next.IsZero() {
+		// The scheduler has not started yet
+		return nextRuns(job.schedule, time.Now().In(job.location), n), nil
+	}
+	runs := append([]time.Time{next.In(job.location)}, nextRuns(job.schedule, next, n-1)...)
+	for i := range runs {
+		runs[i] = runs[i].In(job.location)
+	}
+	return runs, nil
+}
+
+// uniqueScheduleName return name, or name with number if it has been used (such as 2 schedules of 1h0m0s)
+func (ms *Microservice) uniqueScheduleName(name string) string {
+	ms.scheduleMutex.Lock()
+	defer ms.scheduleMutex.Unlock()
+	unique := name
+	for i := 2; ms.schedules[unique] != nil; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	return unique
+}
+
+// registerSchedule wrap h with middlewares and add job by name
+func (ms *Microservice) registerSchedule(job *scheduleJob, h ServiceHandleFunc) error {
+	job.h = ms.withMiddlewares(h, job.options.Middlewares)
+
+	ms.scheduleMutex.Lock()
+	defer ms.scheduleMutex.Unlock()
+	if ms.schedules[job.name] != nil {
+		return fmt.Errorf("Schedule %s has already registered", job.name)
+	}
+	ms.schedules[job.name] = job
+	return nil
+}
+
+// startSchedule run job at its schedule until exit channel or the service is shutting down
+func (ms *Microservice) startSchedule(job *scheduleJob) chan bool {
 	// exitChan must be call exitChan <- true from caller to exit scheduler
 	exitChan := make(chan bool, 1)
-	go func() {
-		t := time.NewTicker(timer)
-		done := make(chan bool, 1)
-		isExit := false
-		isExitMutex := sync.Mutex{}
-
-		go func() {
-			<-exitChan
-			isExitMutex.Lock()
-			isExit = true
-			isExitMutex.Unlock()
-			// Stop Tick() and send done message to exit for loop below
-			// Ref: From the documentation http://golang.org/pkg/time/#Ticker.Stop
-			// Stop turns off a ticker. After Stop, no more ticks will be sent.
-			// Stop does not close the channel, to prevent a read from the channel succeeding incorrectly.
-			t.Stop()
-			done <- true
-		}()
+	// The graceful shutdown will wait for the running handler
+	ms.startWorker(func() {
+		// Each instances must have different jitter, so the random source is seeded per job
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		job.setNext(job.schedule.Next(time.Now()))
 
 		for {
-			select {
-			case execTime := <-t.C:
-				isExitMutex.Lock()
-				if isExit {
-					isExitMutex.Unlock()
-					// Done in the next round
-					continue
+			scheduled := job.getNext()
+			if scheduled.IsZero() {
+				// The cron expression has no more runs
+				select {
+				case <-exitChan:
+				case <-ms.stop:
 				}
-				isExitMutex.Unlock()
+				return
+			}
 
-				now := time.Now()
-				// The schedule that older than 10s, will be skip, because t.C is buffer at size 1
-				diff := now.Sub(execTime).Seconds()
-				if diff > 10 {
-					continue
-				}
-				h(NewSchedulerContext(ms))
-			case <-done:
+			jitter := time.Duration(0)
+			if job.options.Jitter > 0 {
+				jitter = time.Duration(rnd.Int63n(int64(job.options.Jitter)))
+			}
+			timer := time.NewTimer(time.Until(scheduled) + jitter)
+			select {
+			case <-timer.C:
+			case <-exitChan:
+				timer.Stop()
 				return
+			case <-ms.stop:
+				timer.Stop()
+				return
+			}
+
+			// due is every runs that have passed, it is more than one when the previous run has taken
+			// longer than the period or the process has paused
+			now := time.Now()
+			due := []time.Time{scheduled}
+			for next := job.schedule.Next(scheduled); !next.IsZero() && !next.After(now) && len(due) < maxCatchUpRuns; next = job.schedule.Next(next) {
+				due = append(due, next)
 			}
+			job.setNext(job.schedule.Next(due[len(due)-1]))
+
+			late := now.Sub(due[len(due)-1]) - jitter
+			ms.fireSchedule(job, due, late)
 		}
-	}()
+	})
 
 	return exitChan
 }
+
+// fireSchedule run the due runs by misfire policy, late is how late the latest run is
+func (ms *Microservice) fireSchedule(job *scheduleJob, due []time.Time, late time.Duration) {
+	options := job.options
+	latest := due[len(due)-1]
+	switch {
+	case options.MisfirePolicy == MisfireCatchUp:
+		for _, scheduled := range due {
+			if ms.isStopping() {
+				return
+			}
+			ms.runSchedule(job, scheduled, JobTriggerSchedule)
+		}
+	case late <= options.MisfireThreshold:
+		ms.runSchedule(job, latest, JobTriggerSchedule)
+	case options.MisfirePolicy == MisfireFireOnce:
+		ms.runSchedule(job, latest, JobTriggerSchedule)
+	default:
+		ms.logger.With(LogFields{
+			"tag":      "Scheduler",
+			"schedule": job.name,
+			"missed":   len(due),
+			"late":     late.String(),
+		}).Warn("Skip the missed run of " + job.name)
+		ms.saveJobRun(&JobRun{
+			ID:            newHexID(16),
+			Schedule:      job.name,
+			ScheduledTime: latest.In(job.location),
+			Start:         time.Now(),
+			Status:        JobRunMissed,
+			Error:         fmt.Sprintf("%d runs are late %s", len(due), late),
+			Trigger:       JobTriggerSchedule,
+			Instance:      hostname(),
+		})
+	}
+}
+
+// runSchedule run handler of job for the scheduled time, the scheduled run is skipped if the job has paused
+func (ms *Microservice) runSchedule(job *scheduleJob, scheduled time.Time, trigger string) error {
+	if trigger == JobTriggerSchedule {
+		paused, err := ms.jobStore.IsPaused(job.name)
+		if err != nil {
+			// The job is run, the store should not stop every schedules
+			ms.LogError("Scheduler", err)
+		}
+		if paused {
+			ms.logger.With(LogFields{"tag": "Scheduler", "schedule": job.name}).Debug("Skip the run of paused schedule")
+			return nil
+		}
+	}
+	if len(job.options.SingletonCacheServer) > 0 {
+		return ms.runSingletonSchedule(job, scheduled, trigger)
+	}
+	return ms.execSchedule(job, NewSchedulerContext(ms, job.name, scheduled.In(job.location)), trigger)
+}
+
+// runSingletonSchedule run the scheduled time only if this instance has acquired the lock of job,
+// and the other instances have not run the same scheduled time
+func (ms *Microservice) runSingletonSchedule(job *scheduleJob, scheduled time.Time, trigger string) error {
+	options := job.options
+	logger := ms.logger.With(LogFields{"tag": "Scheduler", "schedule": job.name})
+	cacher := ms.getCacher(options.SingletonCacheServer).WithContext(ms.ctx)
+	lockKey := "schedule:" + job.name
+
+	// 1. Acquire lock, the instance that has not acquired skip this run
+	lock, err := cacher.TryLock(lockKey, options.SingletonLease)
+	if err == ErrLockNotAcquired {
+		if trigger == JobTriggerManual {
+			logger.Warn("Skip the manual run, the schedule is running on the other instance")
+			return err
+		}
+		logger.Debug("Skip the run that is running on the other instance")
+		return nil
+	}
+	if err != nil {
+		ms.LogError("Scheduler", err)
+		return err
+	}
+	defer func() {
+		err := lock.Release()
+		if err != nil {
+			logger.Warn("Release lock failed: " + err.Error())
+		}
+	}()
+
+	// 2. The lock is released after each runs, so the instance that is late (jitter or clock skew)
+	//    can acquire it again, the last scheduled time is checked to not run the same time twice
+	//    (the manual run is not in the schedule, so it does not change the last scheduled time)
+	if trigger == JobTriggerSchedule {
+		lastKey := lockKey + ":last"
+		last, err := cacher.Get(lastKey)
+		if err != nil {
+			ms.LogError("Scheduler", err)
+			return err
+		}
+		lastScheduled, _ := strconv.ParseInt(last, 10, 64)
+		if lastScheduled >= scheduled.UnixNano() {
+			logger.Debug("Skip the run that has run on the other instance")
+			return nil
+		}
+		err = cacher.SetS(lastKey, strconv.FormatInt(scheduled.UnixNano(), 10), 0)
+		if err != nil {
+			ms.LogError("Scheduler", err)
+			return err
+		}
+	}
+
+	// 3. Run handler while the lease is refreshed, the run is cancelled if the lock has lost
+	//    (such as Redis has been unreachable longer than the lease)
+	ctx := NewSchedulerContext(ms, job.name, scheduled.In(job.location))
+	ctx.span.SetAttribute("schedule.fencing_token", lock.Token())
+	ctx.logger = ctx.logger.With(LogFields{"fencing_token": lock.Token()})
+	runCtx, cancel := context.WithCancel(contextWithLock(ctx.Context(), lock))
+	defer cancel()
+	ctx.setContext(runCtx)
+	go KeepAlive(runCtx, lock, options.SingletonLease, func(err error) {
+		ctx.logger.Warn("Lock of schedule has lost, the run is cancelled")
+		cancel()
+	})
+	return ms.execSchedule(job, ctx, trigger)
+}
+
+// execSchedule execute handler of job with ctx, the run is saved in job store when it has started and ended
+func (ms *Microservice) execSchedule(job *scheduleJob, ctx *SchedulerContext, trigger string) error {
+	run := &JobRun{
+		ID:            newHexID(16),
+		Schedule:      job.name,
+		ScheduledTime: ctx.scheduled,
+		Start:         time.Now(),
+		Status:        JobRunRunning,
+		Trigger:       trigger,
+		Instance:      hostname(),
+		TraceID:       ctx.span.SpanContext().TraceID,
+	}
+	capture := &runLogCapture{}
+	ctx.logger = newCaptureLogger(ctx.logger.With(LogFields{"run_id": run.ID}), capture)
+	ctx.span.SetAttribute("schedule.run_id", run.ID)
+	ctx.span.SetAttribute("schedule.trigger", trigger)
+	ms.saveJobRun(run)
+
+	err := job.h(ctx)
+	ctx.Span().End(err)
+	ms.observeSchedule(job.name, run.Start, err)
+
+	run.End = time.Now()
+	run.DurationMs = run.End.Sub(run.Start).Milliseconds()
+	run.Status = JobRunSuccess
+	if err != nil {
+		run.Status = JobRunFailed
+		run.Error = err.Error()
+		ctx.logger.Error("Schedule has failed: " + err.Error())
+	}
+	run.Logs = capture.excerpt()
+	ms.saveJobRun(run)
+	return err
+}
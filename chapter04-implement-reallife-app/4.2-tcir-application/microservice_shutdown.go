@@ -0,0 +1,90 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// defaultShutdownTimeout is less than terminationGracePeriodSeconds of k8s (30s),
+// so the producer and cacher can be closed before the pod is killed
+const defaultShutdownTimeout = 25 * time.Second
+
+// shutdownCancelGrace is the time to wait for the handlers that have been cancelled at the deadline,
+// so they can return before their producer and cacher are closed
+const shutdownCancelGrace = 2 * time.Second
+
+// SetShutdownTimeout set the deadline of graceful shutdown
+func (ms *Microservice) SetShutdownTimeout(timeout time.Duration) {
+	ms.shutdownTimeout = timeout
+}
+
+// startWorker run f in new goroutine after startup has completed, the graceful shutdown will wait until f has returned
+// f must return when ms.isStopping() is true
+func (ms *Microservice) startWorker(f func()) {
+	ms.workers.Add(1)
+	go func() {
+		defer ms.workers.Done()
+		if !ms.waitStarted() {
+			return
+		}
+		f()
+	}()
+}
+
+// isStopping return true if the service is shutting down, the workers must stop taking new work
+func (ms *Microservice) isStopping() bool {
+	select {
+	case <-ms.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown stop every services in order, so nothing is lost during rolling update
+// 1. Stop intake, HTTP stop accepting new request and consumers, schedulers stop reading new work
+// 2. Wait for in-flight handlers, consumers flush partial batches and commit offsets before they return
+// 3. Close Producer (flush pending messages) and Cacher
+// If the deadline has passed, the context of every handlers is cancelled (so their outbound calls are cancelled),
+// they have shutdownCancelGrace to return, then the remaining workers are abandoned and their uncommitted messages
+// will be redelivered (their sends after Producer has closed return ErrProducerClosed)
+func (ms *Microservice) shutdown(hasHTTP bool) error {
+	ms.Log("MS", "Start graceful shutdown")
+	ms.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ms.shutdownTimeout)
+	defer cancel()
+
+	if hasHTTP {
+		// This will wait for in-flight requests
+		ms.stopHTTP(ctx)
+	}
+
+	done := make(chan bool)
+	go func() {
+		ms.workers.Wait()
+		close(done)
+	}()
+
+	finished := false
+	select {
+	case <-done:
+		ms.Log("MS", "Every workers have finished")
+		finished = true
+	case <-ctx.Done():
+		ms.Log("MS", "Shutdown deadline has exceeded, some workers have not finished")
+	}
+
+	// Cancel the outbound calls of handlers that are still running
+	ms.cancel()
+	if !finished {
+		select {
+		case <-done:
+			ms.Log("MS", "Every workers have finished after cancel")
+		case <-time.After(shutdownCancelGrace):
+			ms.Log("MS", "Abandon the workers that have not returned after cancel")
+		}
+	}
+	return ms.Cleanup()
+}
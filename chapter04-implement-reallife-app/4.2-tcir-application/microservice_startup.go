@@ -0,0 +1,196 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// defaultStartupTimeout is the max time to wait for dependencies, it should be equal to
+// periodSeconds * failureThreshold of k8s startup probe (10s * 30)
+const defaultStartupTimeout = 5 * time.Minute
+
+const (
+	startupBackoffInitial = 500 * time.Millisecond
+	startupBackoffMax     = 15 * time.Second
+)
+
+// DependencyStatus is the status of dependency during startup
+type DependencyStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts"`
+}
+
+// startupDependency is the dependency that must respond before consumers and schedulers start
+type startupDependency struct {
+	name   string
+	check  HealthCheckFunc
+	status DependencyStatus
+}
+
+// SetStartupTimeout set the max time to wait for dependencies, Start return error if it has exceeded
+func (ms *Microservice) SetStartupTimeout(timeout time.Duration) {
+	ms.startupTimeout = timeout
+}
+
+// WaitFor register dependency that is checked (with exponential backoff) during startup,
+// consumers and schedulers are not started until every dependencies have responded
+func (ms *Microservice) WaitFor(name string, check HealthCheckFunc) {
+	ms.startupMutex.Lock()
+	defer ms.startupMutex.Unlock()
+	ms.dependencies = append(ms.dependencies, &startupDependency{
+		name:   name,
+		check:  check,
+		status: DependencyStatus{Status: "waiting"},
+	})
+}
+
+// OnStartup register function that is executed after every dependencies have responded
+// and before consumers and schedulers start, such as create topics, Start return error if it has failed
+func (ms *Microservice) OnStartup(h func() error) {
+	ms.startupMutex.Lock()
+	defer ms.startupMutex.Unlock()
+	ms.startupHooks = append(ms.startupHooks, h)
+}
+
+// isStarted return true if startup has completed
+func (ms *Microservice) isStarted() bool {
+	select {
+	case <-ms.started:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitStarted block until startup has completed, it return false if the service is shutting down before that
+func (ms *Microservice) waitStarted() bool {
+	select {
+	case <-ms.started:
+		return !ms.isStopping()
+	case <-ms.stop:
+		return false
+	}
+}
+
+// startup wait for every dependencies in parallel, then execute startup hooks and release the workers
+func (ms *Microservice) startup() error {
+	ms.startupMutex.Lock()
+	dependencies := append([]*startupDependency{}, ms.dependencies...)
+	hooks := append([]func() error{}, ms.startupHooks...)
+	ms.startupMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ms.ctx, ms.startupTimeout)
+	defer cancel()
+	// Give up waiting when the service is stopped during startup
+	go func() {
+		select {
+		case <-ms.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	errs := make(chan error, len(dependencies))
+	wg := sync.WaitGroup{}
+	for _, dep := range dependencies {
+		wg.Add(1)
+		go func(dep *startupDependency) {
+			defer wg.Done()
+			errs <- ms.waitDependency(ctx, dep)
+		}(dep)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, h := range hooks {
+		err := h()
+		if err != nil {
+			return err
+		}
+	}
+
+	if ms.isStopping() {
+		return fmt.Errorf("Service has stopped during startup")
+	}
+	close(ms.started)
+	ms.Log("MS", "Startup has completed")
+	return nil
+}
+
+// waitDependency check dependency until it has responded, the interval is doubled after every failures
+// (0.5s, 1s, 2s, ... max 15s), it return error when ctx is done
+func (ms *Microservice) waitDependency(ctx context.Context, dep *startupDependency) error {
+	backoff := startupBackoffInitial
+	for {
+		err := checkWithTimeout(ctx, defaultHealthCheckTimeout, dep.check)
+
+		ms.startupMutex.Lock()
+		dep.status.Attempts++
+		if err == nil {
+			dep.status.Status = healthStatusOK
+			dep.status.Error = ""
+		} else {
+			dep.status.Error = err.Error()
+		}
+		attempts := dep.status.Attempts
+		ms.startupMutex.Unlock()
+
+		if err == nil {
+			ms.Log("MS", fmt.Sprintf("Dependency %s is ready after %d attempts", dep.name, attempts))
+			return nil
+		}
+		ms.logger.With(LogFields{"tag": "MS", "dependency": dep.name, "attempt": attempts, "error": err.Error()}).
+			Warn(fmt.Sprintf("Dependency %s is not ready, retry in %s", dep.name, backoff))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Dependency %s is not ready: %s", dep.name, err.Error())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > startupBackoffMax {
+			backoff = startupBackoffMax
+		}
+	}
+}
+
+// DependencyStatuses return status of every dependencies that are registered by WaitFor
+func (ms *Microservice) DependencyStatuses() map[string]DependencyStatus {
+	ms.startupMutex.Lock()
+	defer ms.startupMutex.Unlock()
+	statuses := map[string]DependencyStatus{}
+	for _, dep := range ms.dependencies {
+		statuses[dep.name] = dep.status
+	}
+	return statuses
+}
+
+// RegisterStartupProbeEndpoint register endpoint for startup probe, it response status 200 when startup has completed,
+// or status 503 with status of every dependencies while they are waited
+func (ms *Microservice) RegisterStartupProbeEndpoint(path string) {
+	ms.echo.GET(path, func(c echo.Context) error {
+		status := "started"
+		code := http.StatusOK
+		if !ms.isStarted() {
+			status = "starting"
+			code = http.StatusServiceUnavailable
+		}
+		return c.JSON(code, map[string]interface{}{
+			"status":       status,
+			"dependencies": ms.DependencyStatuses(),
+		})
+	})
+}
@@ -0,0 +1,43 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopicsAreCreatedOnStartup(t *testing.T) {
+	h := func(ctx IContext) error { return nil }
+	tests := []struct {
+		name      string
+		register  func(ms *Microservice) error
+		wantHooks int
+	}{
+		{"consumer", func(ms *Microservice) error {
+			return ms.Consume("localhost:9092", "citizen", "mail", time.Second, h)
+		}, 0},
+		{"consumer with retry policy", func(ms *Microservice) error {
+			return ms.Consume("localhost:9092", "citizen", "mail", time.Second, h,
+				WithRetryPolicy(&RetryPolicy{Delays: []time.Duration{time.Minute}}))
+		}, 1},
+		{"async task", func(ms *Microservice) error {
+			ms.AsyncPOST("/api/citizen", "localhost:6379", "localhost:9092", h)
+			return nil
+		}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := NewMicroservice()
+			ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+			err := tt.register(ms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Topics are not created at registration, Kafka may not be reachable before startup
+			if got := len(ms.startupHooks); got != tt.wantHooks {
+				t.Errorf("startup hooks = %d, want %d", got, tt.wantHooks)
+			}
+		})
+	}
+}
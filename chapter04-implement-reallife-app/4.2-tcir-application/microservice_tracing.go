@@ -0,0 +1,95 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+	"github.com/labstack/echo"
+)
+
+// SetTracer set tracer that create spans of every service types, it must be called before services are registered
+// By default, trace context is propagated but spans are not exported
+func (ms *Microservice) SetTracer(tracer *Tracer) {
+	ms.tracer = tracer
+}
+
+// Tracer return tracer of this service, it can be used to start custom spans
+func (ms *Microservice) Tracer() *Tracer {
+	return ms.tracer
+}
+
+// startHTTPSpan start server span that is the child of traceparent in request header
+func (ms *Microservice) startHTTPSpan(c echo.Context) *Span {
+	req := c.Request()
+	span := ms.tracer.startRemoteSpan(req.Header.Get(headerTraceParent), "HTTP "+req.Method+" "+c.Path(), SpanKindServer)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.route", c.Path())
+	span.SetAttribute("http.target", req.URL.RequestURI())
+	return span
+}
+
+// startMessageSpan start consumer span that is the child of producer span in message header
+func (ms *Microservice) startMessageSpan(message *Message) *Span {
+	span := ms.tracer.startRemoteSpan(message.Header(headerTraceParent), "receive "+message.Topic, SpanKindConsumer)
+	span.SetAttribute("messaging.system", "kafka")
+	span.SetAttribute("messaging.destination", message.Topic)
+	span.SetAttribute("messaging.kafka.partition", message.Partition)
+	span.SetAttribute("messaging.kafka.offset", message.Offset)
+	if len(message.Key) > 0 {
+		span.SetAttribute("messaging.kafka.message_key", message.Key)
+	}
+	return span
+}
+
+// startBatchSpan start consumer span of batch, the batch has many parents, so it start new trace
+// that link to the producer span of every messages
+func (ms *Microservice) startBatchSpan(messages []*Message) *Span {
+	span := ms.tracer.startSpan(SpanContext{}, "receive batch", SpanKindConsumer)
+	span.SetAttribute("messaging.system", "kafka")
+	span.SetAttribute("messaging.batch.message_count", len(messages))
+	for _, message := range messages {
+		parent, ok := ParseTraceParent(message.Header(headerTraceParent))
+		if ok {
+			span.AddLink(parent)
+		}
+	}
+	return span
+}
+
+// traceRedis create child span of the span in ctx for every commands of client,
+// client must be the clone from WithContext, so the hooks are not added to the shared client
+func (ms *Microservice) traceRedis(ctx context.Context, client *redis.Client) {
+	if SpanFromContext(ctx) == nil {
+		return
+	}
+	client.WrapProcess(func(process func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			span := ms.tracer.startChildSpan(ctx, "redis "+cmd.Name(), SpanKindClient)
+			span.SetAttribute("db.system", "redis")
+			span.SetAttribute("db.operation", cmd.Name())
+			err := process(cmd)
+			if err == redis.Nil {
+				// Key does not exist is not an error of Redis
+				span.End(nil)
+			} else {
+				span.End(err)
+			}
+			return err
+		}
+	})
+	client.WrapProcessPipeline(func(process func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			span := ms.tracer.startChildSpan(ctx, "redis pipeline", SpanKindClient)
+			span.SetAttribute("db.system", "redis")
+			span.SetAttribute("db.redis.pipeline_length", len(cmds))
+			err := process(cmds)
+			if err == redis.Nil {
+				span.End(nil)
+			} else {
+				span.End(err)
+			}
+			return err
+		}
+	})
+}
@@ -0,0 +1,292 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// inputValidator validate request struct by `validate` tags, field name in error is the json name
+var inputValidator = newInputValidator()
+
+func newInputValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if len(name) == 0 {
+			return f.Name
+		}
+		return name
+	})
+	return v
+}
+
+// InvalidInputError is the error when input cannot be decoded into request struct or it is not valid,
+// the same input will never succeed, so it is not retried (sent to dead letter queue directly)
+type InvalidInputError struct {
+	Err    error
+	Fields map[string]string
+}
+
+// Error return error message
+func (e *InvalidInputError) Error() string {
+	return "Invalid input: " + e.Err.Error()
+}
+
+// Response return the body of 400 response
+func (e *InvalidInputError) Response() map[string]interface{} {
+	return map[string]interface{}{
+		"status": "invalid_input",
+		"error":  e.Err.Error(),
+		"fields": e.Fields,
+	}
+}
+
+// isInvalidInput return true if err is (or wrap) InvalidInputError
+func isInvalidInput(err error) bool {
+	var invalidErr *InvalidInputError
+	return errors.As(err, &invalidErr)
+}
+
+// validateInput validate v by `validate` tags, and return InvalidInputError if invalid
+func validateInput(v interface{}) error {
+	err := inputValidator.Struct(v)
+	if err == nil {
+		return nil
+	}
+	fields := map[string]string{}
+	validationErrs, ok := err.(validator.ValidationErrors)
+	if ok {
+		for _, fieldErr := range validationErrs {
+			fields[fieldErr.Field()] = fieldErr.Tag()
+		}
+	}
+	return &InvalidInputError{Err: err, Fields: fields}
+}
+
+var (
+	contextType = reflect.TypeOf((*IContext)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// typedHandler call the handler function with request struct that decoded from input
+// The handler function must be one of
+// - func(ctx IContext, req *T) error
+// - func(ctx IContext, req *T) (response R, err error), response is sent with status 200 when err is nil
+// - func(ctx IContext, reqs []*T) error (batch only)
+type typedHandler struct {
+	fn          reflect.Value
+	reqType     reflect.Type
+	hasResponse bool
+}
+
+// newTypedHandler check the handler function signature, and return error if signature is invalid
+func newTypedHandler(h interface{}, isBatch bool) (*typedHandler, error) {
+	if h == nil {
+		return nil, fmt.Errorf("Typed handler must be func(ctx IContext, req) but got nil")
+	}
+	fn := reflect.ValueOf(h)
+	fnType := fn.Type()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 2 || fnType.In(0) != contextType {
+		return nil, fmt.Errorf("Typed handler must be func(ctx IContext, req) but got %s", fnType)
+	}
+
+	reqType := fnType.In(1)
+	if isBatch {
+		if reqType.Kind() != reflect.Slice || reqType.Elem().Kind() != reflect.Ptr || reqType.Elem().Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("Typed batch handler request must be []*struct but got %s", reqType)
+		}
+		reqType = reqType.Elem().Elem()
+	} else {
+		if reqType.Kind() != reflect.Ptr || reqType.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("Typed handler request must be *struct but got %s", reqType)
+		}
+		reqType = reqType.Elem()
+	}
+
+	hasResponse := false
+	switch {
+	case fnType.NumOut() == 1 && fnType.Out(0) == errorType:
+	case fnType.NumOut() == 2 && fnType.Out(1) == errorType && !isBatch:
+		hasResponse = true
+	default:
+		return nil, fmt.Errorf("Typed handler must return error or (response, error) but got %s", fnType)
+	}
+
+	return &typedHandler{
+		fn:          fn,
+		reqType:     reqType,
+		hasResponse: hasResponse,
+	}, nil
+}
+
+// mustTypedHandler return typed handler for the HTTP services that cannot return error,
+// it panic if signature is invalid because it is programming error that should be found when service is registered
+func mustTypedHandler(h interface{}) *typedHandler {
+	th, err := newTypedHandler(h, false)
+	if err != nil {
+		panic(err.Error())
+	}
+	return th
+}
+
+// decode decode input of ctx into new request struct and validate it
+func (th *typedHandler) decode(ctx IContext) (reflect.Value, error) {
+	req := reflect.New(th.reqType)
+	err := ctx.BindInput(req.Interface())
+	if err != nil {
+		return req, &InvalidInputError{Err: err, Fields: map[string]string{}}
+	}
+	err = validateInput(req.Interface())
+	if err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// call execute handler function, and send response (if any) with status 200
+func (th *typedHandler) call(ctx IContext, req reflect.Value) error {
+	out := th.fn.Call([]reflect.Value{reflect.ValueOf(ctx), req})
+	errOut := out[len(out)-1]
+	if !errOut.IsNil() {
+		return errOut.Interface().(error)
+	}
+	if th.hasResponse {
+		ctx.Response(http.StatusOK, out[0].Interface())
+	}
+	return nil
+}
+
+// handleResponse decode input and execute handler, invalid input is responded with status 400
+func (th *typedHandler) handleResponse(ctx IContext) error {
+	req, err := th.decode(ctx)
+	if err != nil {
+		var invalidErr *InvalidInputError
+		if errors.As(err, &invalidErr) {
+			ctx.Response(http.StatusBadRequest, invalidErr.Response())
+			return nil
+		}
+		return err
+	}
+	return th.call(ctx, req)
+}
+
+// handleMessage decode input and execute handler, invalid input return InvalidInputError
+// so the consumer send the message to dead letter queue
+func (th *typedHandler) handleMessage(ctx IContext) error {
+	req, err := th.decode(ctx)
+	if err != nil {
+		ctx.Logger().Error(err.Error())
+		return err
+	}
+	return th.call(ctx, req)
+}
+
+// handleBatch decode every messages in batch, invalid messages are logged and skipped
+func (th *typedHandler) handleBatch(ms *Microservice, ctx IContext) error {
+	reqs := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(th.reqType)), 0, len(ctx.ReadMessages()))
+	for _, message := range ctx.ReadMessages() {
+		req := reflect.New(th.reqType)
+		codec := ms.getCodec(message.Header(headerContentType))
+		err := codec.Unmarshal([]byte(message.Value), req.Interface())
+		if err == nil {
+			err = validateInput(req.Interface())
+		}
+		if err != nil {
+			ctx.Logger().Warn(fmt.Sprintf("Skip invalid message %s[%d]@%d: %s", message.Topic, message.Partition, message.Offset, err.Error()))
+			continue
+		}
+		reqs = reflect.Append(reqs, req)
+	}
+	if reqs.Len() == 0 {
+		return nil
+	}
+	return th.call(ctx, reqs)
+}
+
+// TypedGET register HTTP GET with typed handler, the request struct is bound from query params (`query` tags)
+// middlewares are executed for this route only (after the global middlewares)
+func (ms *Microservice) TypedGET(path string, h interface{}, middlewares ...MiddlewareFunc) {
+	th := mustTypedHandler(h)
+	ms.GET(path, th.handleResponse, middlewares...)
+}
+
+// TypedPOST register HTTP POST with typed handler, the request struct is decoded from request body
+// middlewares are executed for this route only (after the global middlewares)
+func (ms *Microservice) TypedPOST(path string, h interface{}, middlewares ...MiddlewareFunc) {
+	th := mustTypedHandler(h)
+	ms.POST(path, th.handleResponse, middlewares...)
+}
+
+// TypedConsume register Consumer with typed handler, the invalid message is sent to dead letter queue
+// (if WithRetryPolicy is set) or it is logged and skipped
+// It return error if the handler signature is invalid
+func (ms *Microservice) TypedConsume(servers string, topic string, groupID string, readTimeout time.Duration, h interface{}, opts ...ConsumerOption) error {
+	th, err := newTypedHandler(h, false)
+	if err != nil {
+		return err
+	}
+	return ms.Consume(servers, topic, groupID, readTimeout, th.handleMessage, opts...)
+}
+
+// TypedConsumeBatch register Batch Consumer with typed handler func(ctx IContext, reqs []*T) error,
+// the invalid messages are logged and skipped, it return error if the handler signature is invalid
+func (ms *Microservice) TypedConsumeBatch(
+	servers string,
+	topic string,
+	groupID string,
+	readTimeout time.Duration,
+	batchSize int,
+	batchTimeout time.Duration,
+	h interface{},
+	opts ...ConsumerOption) error {
+
+	th, err := newTypedHandler(h, true)
+	if err != nil {
+		return err
+	}
+	return ms.ConsumeBatch(servers, topic, groupID, readTimeout, batchSize, batchTimeout, func(ctx IContext) error {
+		return th.handleBatch(ms, ctx)
+	}, opts...)
+}
+
+// TypedAsyncPOST register AsyncTask with typed handler, the request is validated before it is accepted,
+// so the invalid request is responded with status 400 immediately
+func (ms *Microservice) TypedAsyncPOST(path string, cacheServer string, mqServers string, h interface{}) {
+	th := mustTypedHandler(h)
+	ms.startAsyncTaskConsumer(path, cacheServer, mqServers, th.handleResponse)
+	ms.GET(path, func(ctx IContext) error {
+		return ms.handleAsyncTaskResponse(path, cacheServer, ctx)
+	})
+	ms.POST(path, func(ctx IContext) error {
+		input := ctx.ReadInput()
+		req := reflect.New(th.reqType)
+		err := NewJSONCodec().Unmarshal([]byte(input), req.Interface())
+		if err != nil {
+			err = &InvalidInputError{Err: err, Fields: map[string]string{}}
+		} else {
+			err = validateInput(req.Interface())
+		}
+		if err != nil {
+			ctx.Response(http.StatusBadRequest, err.(*InvalidInputError).Response())
+			return nil
+		}
+		return ms.handleAsyncTaskInput(path, cacheServer, mqServers, input, ctx)
+	})
+}
+
+// TypedPTaskWorkerNode register ParallelTask worker with typed handler, the invalid input is responded
+// to the task status with code 400
+func (ms *Microservice) TypedPTaskWorkerNode(path string, cacheServer string, mqServers string, h interface{}) {
+	th := mustTypedHandler(h)
+	ms.PTaskWorkerNode(path, cacheServer, mqServers, th.handleResponse)
+}
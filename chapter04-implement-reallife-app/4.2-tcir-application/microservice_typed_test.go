@@ -0,0 +1,114 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testTypedRequest struct {
+	CitizenID string `json:"citizen_id" validate:"required"`
+	Email     string `json:"email" validate:"omitempty,email"`
+}
+
+func TestNewTypedHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		h               interface{}
+		isBatch         bool
+		wantErr         bool
+		wantHasResponse bool
+	}{
+		{"return error", func(ctx IContext, req *testTypedRequest) error { return nil }, false, false, false},
+		{"return response", func(ctx IContext, req *testTypedRequest) (map[string]string, error) { return nil, nil }, false, false, true},
+		{"batch", func(ctx IContext, reqs []*testTypedRequest) error { return nil }, true, false, false},
+		{"nil", nil, false, true, false},
+		{"not func", "handler", false, true, false},
+		{"no context", func(req *testTypedRequest) error { return nil }, false, true, false},
+		{"request is not pointer", func(ctx IContext, req testTypedRequest) error { return nil }, false, true, false},
+		{"request is not struct", func(ctx IContext, req *string) error { return nil }, false, true, false},
+		{"no error", func(ctx IContext, req *testTypedRequest) {}, false, true, false},
+		{"batch of single request", func(ctx IContext, req *testTypedRequest) error { return nil }, true, true, false},
+		{"batch with response", func(ctx IContext, reqs []*testTypedRequest) (int, error) { return 0, nil }, true, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, err := newTypedHandler(tt.h, tt.isBatch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTypedHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && th.hasResponse != tt.wantHasResponse {
+				t.Errorf("newTypedHandler() hasResponse = %v, want %v", th.hasResponse, tt.wantHasResponse)
+			}
+		})
+	}
+}
+
+func TestTypedConsumeInvalidHandler(t *testing.T) {
+	ms := NewMicroservice()
+	err := ms.TypedConsume("localhost:9092", "citizen", "mail", time.Second, func(ctx IContext, req string) error { return nil })
+	if err == nil {
+		t.Error("TypedConsume() error = nil, want error")
+	}
+	err = ms.TypedConsumeBatch("localhost:9092", "citizen", "mail", time.Second, 10, time.Second,
+		func(ctx IContext, req *testTypedRequest) error { return nil })
+	if err == nil {
+		t.Error("TypedConsumeBatch() error = nil, want error")
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        *testTypedRequest
+		wantFields map[string]string
+	}{
+		{"valid", &testTypedRequest{CitizenID: "1"}, nil},
+		{"required", &testTypedRequest{}, map[string]string{"citizen_id": "required"}},
+		{"invalid email", &testTypedRequest{CitizenID: "1", Email: "mail"}, map[string]string{"email": "email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInput(tt.req)
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Errorf("validateInput() error = %v, want nil", err)
+				}
+				return
+			}
+			invalidErr, ok := err.(*InvalidInputError)
+			if !ok {
+				t.Fatalf("validateInput() error = %v, want InvalidInputError", err)
+			}
+			if fmt.Sprint(invalidErr.Fields) != fmt.Sprint(tt.wantFields) {
+				t.Errorf("validateInput() fields = %v, want %v", invalidErr.Fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestIsInvalidInput(t *testing.T) {
+	invalidErr := &InvalidInputError{Err: errors.New("citizen_id is required")}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"other error", errors.New("timeout"), false},
+		{"invalid input", invalidErr, true},
+		{"wrapped invalid input", fmt.Errorf("handle citizen: %w", invalidErr), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isInvalidInput(tt.err); got != tt.want {
+				t.Errorf("isInvalidInput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	headerRequestID = "X-Request-ID"
+	// maxRequestIDLength is the max length of request id from client, the longer id is replaced
+	maxRequestIDLength = 128
+)
+
+// MiddlewareFunc wrap handler, it can run code before and after next, or return without calling next
+// The same middleware is used with HTTP, consumer and scheduler handlers, the HTTP only middlewares
+// call next directly in the other contexts
+type MiddlewareFunc func(next ServiceHandleFunc) ServiceHandleFunc
+
+// contextSetter is implemented by every contexts, so middleware can replace Context() (such as with deadline)
+type contextSetter interface {
+	setContext(c context.Context)
+}
+
+// chainMiddlewares return handler that run middlewares in order (the first middleware is the outermost) then h
+func chainMiddlewares(h ServiceHandleFunc, middlewares []MiddlewareFunc) ServiceHandleFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// httpContext return HTTPContext of ctx, or nil if ctx is not HTTP
+func httpContext(ctx IContext) *HTTPContext {
+	httpCtx, ok := ctx.(*HTTPContext)
+	if !ok {
+		return nil
+	}
+	return httpCtx
+}
+
+// RecoverMiddleware recover panic in handler and return it as error, so the request is responded with 500
+// and the message is handled as failed (retry, DLQ) instead of crashing the service
+func RecoverMiddleware() MiddlewareFunc {
+	return func(next ServiceHandleFunc) ServiceHandleFunc {
+		return func(ctx IContext) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				err = fmt.Errorf("Handler has panicked: %v", r)
+				ctx.Logger().With(LogFields{"stack": string(debug.Stack())}).Error(err.Error())
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+// RequestIDMiddleware read request id from X-Request-ID header (or generate new one), send it back in
+// response header and add it to log fields and span of the request (HTTP only)
+func RequestIDMiddleware() MiddlewareFunc {
+	return func(next ServiceHandleFunc) ServiceHandleFunc {
+		return func(ctx IContext) error {
+			httpCtx := httpContext(ctx)
+			if httpCtx == nil {
+				return next(ctx)
+			}
+			id := httpCtx.c.Request().Header.Get(headerRequestID)
+			if len(id) == 0 || len(id) > maxRequestIDLength {
+				id = newHexID(32)
+			}
+			httpCtx.c.Response().Header().Set(headerRequestID, id)
+			httpCtx.logger = httpCtx.logger.With(LogFields{"request_id": id})
+			httpCtx.span.SetAttribute("http.request_id", id)
+			return next(ctx)
+		}
+	}
+}
+
+// CORSConfig is the config of CORSMiddleware
+type CORSConfig struct {
+	// AllowOrigins is the list of allowed origins, "*" allow every origins (default)
+	AllowOrigins []string
+	// AllowMethods is the methods that are allowed in preflight response (default GET, POST, PUT, PATCH, DELETE)
+	AllowMethods []string
+	// AllowHeaders is the headers that are allowed in preflight response (default is the requested headers)
+	AllowHeaders []string
+	// AllowCredentials allow cookies and authorization header, the origin is sent instead of "*"
+	AllowCredentials bool
+	// MaxAge is the seconds that browser can cache preflight response
+	MaxAge int
+}
+
+// CORSMiddleware add CORS headers to response and respond preflight (OPTIONS) request (HTTP only)
+func CORSMiddleware(config CORSConfig) MiddlewareFunc {
+	if len(config.AllowOrigins) == 0 {
+		config.AllowOrigins = []string{"*"}
+	}
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	allowMethods := strings.Join(config.AllowMethods, ",")
+	allowHeaders := strings.Join(config.AllowHeaders, ",")
+
+	return func(next ServiceHandleFunc) ServiceHandleFunc {
+		return func(ctx IContext) error {
+			httpCtx := httpContext(ctx)
+			if httpCtx == nil {
+				return next(ctx)
+			}
+			c := httpCtx.c
+			req := c.Request()
+			header := c.Response().Header()
+			origin := req.Header.Get(echo.HeaderOrigin)
+			preflight := req.Method == http.MethodOptions && len(req.Header.Get(echo.HeaderAccessControlRequestMethod)) > 0
+
+			header.Add(echo.HeaderVary, echo.HeaderOrigin)
+			allowOrigin := ""
+			for _, o := range config.AllowOrigins {
+				if o == "*" && !config.AllowCredentials {
+					allowOrigin = "*"
+					break
+				}
+				if o == "*" || o == origin {
+					allowOrigin = origin
+					break
+				}
+			}
+			if len(origin) == 0 || len(allowOrigin) == 0 {
+				// Not CORS request or the origin is not allowed, the browser will block the response
+				if preflight {
+					return c.NoContent(http.StatusNoContent)
+				}
+				return next(ctx)
+			}
+
+			header.Set(echo.HeaderAccessControlAllowOrigin, allowOrigin)
+			if config.AllowCredentials {
+				header.Set(echo.HeaderAccessControlAllowCredentials, "true")
+			}
+			if !preflight {
+				return next(ctx)
+			}
+
+			header.Add(echo.HeaderVary, echo.HeaderAccessControlRequestMethod)
+			header.Add(echo.HeaderVary, echo.HeaderAccessControlRequestHeaders)
+			header.Set(echo.HeaderAccessControlAllowMethods, allowMethods)
+			if len(allowHeaders) > 0 {
+				header.Set(echo.HeaderAccessControlAllowHeaders, allowHeaders)
+			} else if requested := req.Header.Get(echo.HeaderAccessControlRequestHeaders); len(requested) > 0 {
+				header.Set(echo.HeaderAccessControlAllowHeaders, requested)
+			}
+			if config.MaxAge > 0 {
+				header.Set(echo.HeaderAccessControlMaxAge, strconv.Itoa(config.MaxAge))
+			}
+			return c.NoContent(http.StatusNoContent)
+		}
+	}
+}
+
+// gzipResponseWriter compress the body, the response without body (204, 304) is not compressed
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz            *gzip.Writer
+	headerWritten bool
+	compressed    bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.headerWritten {
+		return
+	}
+	w.headerWritten = true
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified {
+		w.Header().Del(echo.HeaderContentLength)
+		w.Header().Set(echo.HeaderContentEncoding, "gzip")
+		w.compressed = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.headerWritten {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.compressed {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// GzipMiddleware compress response body with gzip when client accept it (HTTP only)
+// The error that is responded by echo after the handler has returned is not compressed
+func GzipMiddleware(level int) MiddlewareFunc {
+	return func(next ServiceHandleFunc) ServiceHandleFunc {
+		return func(ctx IContext) error {
+			httpCtx := httpContext(ctx)
+			if httpCtx == nil || !strings.Contains(httpCtx.c.Request().Header.Get(echo.HeaderAcceptEncoding), "gzip") {
+				return next(ctx)
+			}
+			res := httpCtx.c.Response()
+			gz, err := gzip.NewWriterLevel(res.Writer, level)
+			if err != nil {
+				return err
+			}
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			original := res.Writer
+			w := &gzipResponseWriter{ResponseWriter: original, gz: gz}
+			res.Writer = w
+			defer func() {
+				if w.compressed {
+					gz.Close()
+				}
+				res.Writer = original
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+// limitedBody is request body that fail when it is read over the limit
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		b.exceeded = true
+		return 0, fmt.Errorf("Request body is over the limit")
+	}
+	if int64(len(p)) > b.remaining+1 {
+		// Read 1 byte over the limit, to know that the body is too large
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		b.exceeded = true
+		return n, fmt.Errorf("Request body is over the limit")
+	}
+	return n, err
+}
+
+// BodyLimitMiddleware respond 413 when request body is larger than limit bytes (HTTP only)
+func BodyLimitMiddleware(limit int64) MiddlewareFunc {
+	return func(next ServiceHandleFunc) ServiceHandleFunc {
+		return func(ctx IContext) error {
+			httpCtx := httpContext(ctx)
+			if httpCtx == nil {
+				return next(ctx)
+			}
+			req := httpCtx.c.Request()
+			if req.ContentLength > limit {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge)
+			}
+			// Content-Length can be missing (chunked), so the body is also limited while it is read
+			body := &limitedBody{ReadCloser: req.Body, remaining: limit}
+			req.Body = body
+			err := next(ctx)
+			if body.exceeded && !httpCtx.c.Response().Committed {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge)
+			}
+			return err
+		}
+	}
+}
+
+// TimeoutMiddleware set deadline to ctx.Context(), the dependencies that are bound to it are cancelled after timeout
+// The handler is not interrupted, it must return when ctx.Context() is done
+// The HTTP request that has timed out before response is responded with 503
+func TimeoutMiddleware(timeout time.Duration) MiddlewareFunc {
+	return func(next ServiceHandleFunc) ServiceHandleFunc {
+		return func(ctx IContext) error {
+			setter, ok := ctx.(contextSetter)
+			if !ok {
+				return next(ctx)
+			}
+			parent := ctx.Context()
+			c, cancel := context.WithTimeout(parent, timeout)
+			defer cancel()
+			setter.setContext(c)
+			defer setter.setContext(parent)
+
+			err := next(ctx)
+			httpCtx := httpContext(ctx)
+			if httpCtx != nil && c.Err() == context.DeadlineExceeded && !httpCtx.c.Response().Committed {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Request has timed out")
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTest register h with middlewares at /test, and serve req with the service
+func serveTest(middlewares []MiddlewareFunc, method string, h ServiceHandleFunc, req *http.Request) *httptest.ResponseRecorder {
+	ms := NewMicroservice()
+	ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+	ms.Use(middlewares...)
+	switch method {
+	case http.MethodPost:
+		ms.POST("/test", h)
+	default:
+		ms.GET("/test", h)
+	}
+	rec := httptest.NewRecorder()
+	ms.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func okHandler(ctx IContext) error {
+	ctx.Response(http.StatusOK, map[string]string{"status": "ok"})
+	return nil
+}
+
+func TestChainMiddlewares(t *testing.T) {
+	calls := []string{}
+	record := func(name string) MiddlewareFunc {
+		return func(next ServiceHandleFunc) ServiceHandleFunc {
+			return func(ctx IContext) error {
+				calls = append(calls, name+" before")
+				err := next(ctx)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	stop := func(next ServiceHandleFunc) ServiceHandleFunc {
+		return func(ctx IContext) error {
+			calls = append(calls, "stop")
+			return errors.New("stopped")
+		}
+	}
+	h := func(ctx IContext) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		middlewares []MiddlewareFunc
+		want        string
+		wantErr     bool
+	}{
+		{"no middleware", nil, "handler", false},
+		{"the first middleware is the outermost", []MiddlewareFunc{record("a"), record("b")},
+			"a before,b before,handler,b after,a after", false},
+		{"middleware return without next", []MiddlewareFunc{record("a"), stop, record("b")},
+			"a before,stop,a after", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = []string{}
+			err := chainMiddlewares(h, tt.middlewares)(nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handler error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := strings.Join(calls, ","); got != tt.want {
+				t.Errorf("calls = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		h          ServiceHandleFunc
+		wantStatus int
+	}{
+		{"no panic", okHandler, http.StatusOK},
+		{"panic", func(ctx IContext) error { panic("boom") }, http.StatusInternalServerError},
+		{"panic with error", func(ctx IContext) error { panic(errors.New("boom")) }, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTest([]MiddlewareFunc{RecoverMiddleware()}, http.MethodGet, tt.h, httptest.NewRequest(http.MethodGet, "/test", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	// The panic of non HTTP handler is returned as error
+	ms := NewMicroservice()
+	ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+	err := RecoverMiddleware()(func(ctx IContext) error { panic("boom") })(NewSchedulerContext(ms, "job", time.Now()))
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("handler error = %v, want panic error", err)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		wantSame  bool
+	}{
+		{"generate request id", "", false},
+		{"keep request id of client", "abc-123", true},
+		{"replace too long request id", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if len(tt.requestID) > 0 {
+				req.Header.Set(headerRequestID, tt.requestID)
+			}
+			rec := serveTest([]MiddlewareFunc{RequestIDMiddleware()}, http.MethodGet, okHandler, req)
+			got := rec.Header().Get(headerRequestID)
+			if len(got) == 0 {
+				t.Fatal("response has no request id")
+			}
+			if (got == tt.requestID) != tt.wantSame {
+				t.Errorf("request id = %s, want same as client %v", got, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          CORSConfig
+		method          string
+		origin          string
+		requestMethod   string
+		wantStatus      int
+		wantAllowOrigin string
+		wantCredentials string
+		wantMethods     string
+		wantHandler     bool
+	}{
+		{"not CORS request", CORSConfig{}, http.MethodPost, "", "", http.StatusOK, "", "", "", true},
+		{"every origins", CORSConfig{}, http.MethodPost, "https://a.com", "", http.StatusOK, "*", "", "", true},
+		{"allowed origin", CORSConfig{AllowOrigins: []string{"https://a.com"}}, http.MethodPost, "https://a.com", "",
+			http.StatusOK, "https://a.com", "", "", true},
+		{"not allowed origin", CORSConfig{AllowOrigins: []string{"https://a.com"}}, http.MethodPost, "https://b.com", "",
+			http.StatusOK, "", "", "", true},
+		{"credentials send origin instead of *", CORSConfig{AllowCredentials: true}, http.MethodPost, "https://a.com", "",
+			http.StatusOK, "https://a.com", "true", "", true},
+		{"preflight", CORSConfig{AllowMethods: []string{http.MethodPost}}, http.MethodOptions, "https://a.com", http.MethodPost,
+			http.StatusNoContent, "*", "", http.MethodPost, false},
+		{"preflight of not allowed origin", CORSConfig{AllowOrigins: []string{"https://a.com"}}, http.MethodOptions,
+			"https://b.com", http.MethodPost, http.StatusNoContent, "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := func(ctx IContext) error {
+				called = true
+				return okHandler(ctx)
+			}
+			req := httptest.NewRequest(tt.method, "/test", nil)
+			if len(tt.origin) > 0 {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if len(tt.requestMethod) > 0 {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			rec := serveTest([]MiddlewareFunc{CORSMiddleware(tt.config)}, http.MethodPost, h, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %s, want %s", got, tt.wantAllowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %s, want %s", got, tt.wantCredentials)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %s, want %s", got, tt.wantMethods)
+			}
+			if called != tt.wantHandler {
+				t.Errorf("handler called = %v, want %v", called, tt.wantHandler)
+			}
+		})
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	body := strings.Repeat("citizen ", 100)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		status         int
+		wantGzip       bool
+	}{
+		{"client accept gzip", "gzip, deflate", http.StatusOK, true},
+		{"client does not accept gzip", "", http.StatusOK, false},
+		{"response without body", "gzip", http.StatusNoContent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := func(ctx IContext) error {
+				c := httpContext(ctx).c
+				if tt.status == http.StatusNoContent {
+					return c.NoContent(tt.status)
+				}
+				return c.String(tt.status, body)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if len(tt.acceptEncoding) > 0 {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := serveTest([]MiddlewareFunc{GzipMiddleware(gzip.DefaultCompression)}, http.MethodGet, h, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			isGzip := rec.Header().Get("Content-Encoding") == "gzip"
+			if isGzip != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %s, want gzip %v", rec.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			if !isGzip {
+				return
+			}
+			gz, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body {
+				t.Errorf("body = %s, want %s", got, body)
+			}
+		})
+	}
+}
+
+// chunkedBody hide the length of body, so the request has no Content-Length
+type chunkedBody struct {
+	io.Reader
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool
+		wantStatus int
+		wantInput  string
+	}{
+		{"under the limit", "1234", false, http.StatusOK, "1234"},
+		{"equal the limit", "12345678", false, http.StatusOK, "12345678"},
+		{"over the limit by content length", "123456789", false, http.StatusRequestEntityTooLarge, ""},
+		{"chunked under the limit", "1234", true, http.StatusOK, "1234"},
+		{"chunked over the limit", "123456789", true, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := ""
+			h := func(ctx IContext) error {
+				input = ctx.ReadInput()
+				if input == tt.body {
+					ctx.Response(http.StatusOK, map[string]string{"status": "ok"})
+				}
+				return nil
+			}
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = chunkedBody{body}
+			}
+			req := httptest.NewRequest(http.MethodPost, "/test", body)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := serveTest([]MiddlewareFunc{BodyLimitMiddleware(8)}, http.MethodPost, h, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && input != tt.wantInput {
+				t.Errorf("input = %s, want %s", input, tt.wantInput)
+			}
+		})
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		h          ServiceHandleFunc
+		wantStatus int
+	}{
+		{"finish before timeout", okHandler, http.StatusOK},
+		{
+			name: "timed out before response",
+			h: func(ctx IContext) error {
+				<-ctx.Context().Done()
+				return ctx.Context().Err()
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "responded before timeout",
+			h: func(ctx IContext) error {
+				okHandler(ctx)
+				<-ctx.Context().Done()
+				return nil
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTest([]MiddlewareFunc{TimeoutMiddleware(20 * time.Millisecond)}, http.MethodGet, tt.h,
+				httptest.NewRequest(http.MethodGet, "/test", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	// The deadline is set to the context of non HTTP handler, and the parent context is restored after it
+	ms := NewMicroservice()
+	ctx := NewSchedulerContext(ms, "job", time.Now())
+	parent := ctx.Context()
+	err := TimeoutMiddleware(time.Minute)(func(ctx IContext) error {
+		if _, ok := ctx.Context().Deadline(); !ok {
+			return fmt.Errorf("context has no deadline")
+		}
+		return nil
+	})(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if ctx.Context() != parent {
+		t.Error("context has not been restored")
+	}
+}
@@ -3,5 +3,5 @@ package main
 
 // Citizen is model for citizen
 type Citizen struct {
-	CitizenID string `json:"citizen_id"`
+	CitizenID string `json:"citizen_id" validate:"required"`
 }
@@ -13,12 +13,16 @@ import (
 type IMQ interface {
 	CreateTopic(topic string, partitions int, replications int) error
 	CreateTopicR(topic string, partitions int, replications int, retentionPeriod time.Duration) error
+	ReplayDLQ(topic string, groupID string) (int, error)
+	// WithContext return MQ that stop the operations when ctx is done
+	WithContext(ctx context.Context) IMQ
 }
 
 // MQ is message queue
 type MQ struct {
 	ms      *Microservice
 	servers string
+	ctx     context.Context
 }
 
 // NewMQ return new MQ
@@ -26,6 +30,16 @@ func NewMQ(servers string, ms *Microservice) *MQ {
 	return &MQ{
 		ms:      ms,
 		servers: servers,
+		ctx:     context.Background(),
+	}
+}
+
+// WithContext return MQ that execute every operations with ctx
+func (q *MQ) WithContext(ctx context.Context) IMQ {
+	return &MQ{
+		ms:      q.ms,
+		servers: q.servers,
+		ctx:     ctx,
 	}
 }
 
@@ -65,7 +79,7 @@ func (q *MQ) createTopic(topic string, partitions int, replications int, retenti
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(q.ctx)
 	defer cancel()
 
 	retentionPeriodMillisec := fmt.Sprintf("%d", int64(retentionPeriod/time.Millisecond))
@@ -103,3 +117,178 @@ func (q *MQ) createTopic(topic string, partitions int, replications int, retenti
 
 	return nil
 }
+
+// ReplayDLQ send messages in dead letter queue of topic back to the topic, it return number of replayed messages
+// Only messages that are in dead letter queue when the replay started are replayed (the high watermark of each partitions
+// is read before the first message), retry headers are removed so the replayed message will get the full retry policy again
+// The replay continue from the offsets that groupID has committed, so only one replay of the same group should run at a time
+func (q *MQ) ReplayDLQ(topic string, groupID string) (int, error) {
+	dlq := dlqTopicName(topic)
+
+	c, err := q.ms.newKafkaConsumer(q.servers, groupID, &ConsumerOptions{AtLeastOnce: true})
+	if err != nil {
+		return 0, err
+	}
+
+	// Close will commit the offsets of replayed messages
+	defer c.Close()
+
+	// 1. Read the end of each partitions when replay started, message after this will not be replayed
+	ends, err := q.dlqEnds(c, dlq)
+	if err != nil {
+		return 0, err
+	}
+
+	// 2. Assign the partitions that have messages to replay from the committed offsets of groupID
+	tps := make([]kafka.TopicPartition, 0, len(ends))
+	for partition := range ends {
+		tps = append(tps, kafka.TopicPartition{Topic: &dlq, Partition: partition})
+	}
+	committed, err := c.Committed(tps, 5000)
+	if err != nil {
+		return 0, err
+	}
+	assigned := []kafka.TopicPartition{}
+	for _, tp := range committed {
+		start := int64(tp.Offset)
+		if start < 0 {
+			// The group has not committed, replay from the first message that is still in DLQ
+			start = ends[tp.Partition].low
+		}
+		if start >= ends[tp.Partition].high {
+			delete(ends, tp.Partition)
+			continue
+		}
+		assigned = append(assigned, kafka.TopicPartition{Topic: &dlq, Partition: tp.Partition, Offset: kafka.Offset(start)})
+	}
+	if len(assigned) == 0 {
+		q.ms.Log("MQ", fmt.Sprintf("No message to replay from %s", dlq))
+		return 0, nil
+	}
+	err = c.Assign(assigned)
+	if err != nil {
+		return 0, err
+	}
+
+	// 3. Replay until every partitions have reached their end
+	prod := q.ms.getProducer(q.servers).WithContext(q.ctx)
+	count := 0
+	done := func(partition int32) error {
+		delete(ends, partition)
+		return c.Pause([]kafka.TopicPartition{{Topic: &dlq, Partition: partition}})
+	}
+	for len(ends) > 0 {
+		// Stop replay when ctx is done, the replayed messages are committed when consumer is closed
+		err := q.ctx.Err()
+		if err != nil {
+			return count, err
+		}
+
+		msg, err := c.ReadMessage(time.Second)
+		if err != nil {
+			kafkaErr, ok := err.(kafka.Error)
+			if !ok || kafkaErr.Code() != kafka.ErrTimedOut {
+				return count, err
+			}
+			// The end can be the offset of transaction marker that is never read as message,
+			// so the position of consumer is checked as well
+			err = q.checkDLQPositions(c, dlq, ends, done)
+			if err != nil {
+				return count, err
+			}
+			continue
+		}
+
+		tp := msg.TopicPartition
+		end, ok := ends[tp.Partition]
+		if !ok || int64(tp.Offset) >= end.high {
+			// The partition has reached its end, the message is replayed in the next replay
+			if ok {
+				err = done(tp.Partition)
+				if err != nil {
+					return count, err
+				}
+			}
+			continue
+		}
+
+		headers := map[string]string{}
+		for key, value := range headersMap(msg.Headers) {
+			if isRetryHeader(key) {
+				continue
+			}
+			headers[key] = value
+		}
+
+		err = prod.SendMessageRaw(topic, string(msg.Key), msg.Value, headers)
+		if err != nil {
+			return count, err
+		}
+
+		err = q.ms.storeOffsets(c, []*kafka.Message{msg})
+		if err != nil {
+			return count, err
+		}
+		count++
+
+		if int64(tp.Offset)+1 >= end.high {
+			err = done(tp.Partition)
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+
+	q.ms.Log("MQ", fmt.Sprintf("Replayed %d messages from %s to %s", count, dlq, topic))
+	return count, nil
+}
+
+// watermark is the low and high offsets of partition
+type watermark struct {
+	low  int64
+	high int64
+}
+
+// dlqEnds return the watermarks of every partitions of dlq
+func (q *MQ) dlqEnds(c *kafka.Consumer, dlq string) (map[int32]watermark, error) {
+	metadata, err := c.GetMetadata(&dlq, false, 5000)
+	if err != nil {
+		return nil, err
+	}
+	partitions := metadata.Topics[dlq].Partitions
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("Topic %s has no partition", dlq)
+	}
+
+	ends := map[int32]watermark{}
+	for _, partition := range partitions {
+		low, high, err := c.QueryWatermarkOffsets(dlq, partition.ID, 5000)
+		if err != nil {
+			return nil, err
+		}
+		ends[partition.ID] = watermark{low: low, high: high}
+	}
+	return ends, nil
+}
+
+// checkDLQPositions call done for every partitions that the consumer position has reached the end
+func (q *MQ) checkDLQPositions(c *kafka.Consumer, dlq string, ends map[int32]watermark, done func(partition int32) error) error {
+	tps := make([]kafka.TopicPartition, 0, len(ends))
+	for partition := range ends {
+		tps = append(tps, kafka.TopicPartition{Topic: &dlq, Partition: partition})
+	}
+	positions, err := c.Position(tps)
+	if err != nil {
+		return err
+	}
+	for _, tp := range positions {
+		end, ok := ends[tp.Partition]
+		if ok && tp.Offset >= 0 && int64(tp.Offset) >= end.high {
+			err = done(tp.Partition)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -2,81 +2,622 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
+// ErrProducerClosed is returned when message is sent after the producer has closed
+var ErrProducerClosed = errors.New("Producer has closed")
+
 // IProducer is interface for producer
 type IProducer interface {
 	// SendMessage will send message to the partition
 	SendMessage(topic string, key string, message interface{}) error
+	// SendMessageWithHeaders will send message with headers to the partition
+	SendMessageWithHeaders(topic string, key string, message interface{}, headers map[string]string) error
+	// SendMessageRaw will send raw bytes with headers to the partition (message will not be encoded)
+	SendMessageRaw(topic string, key string, value []byte, headers map[string]string) error
+	// SendMessageToPartition will send raw bytes with headers to the specific partition
+	SendMessageToPartition(topic string, partition int32, key string, value []byte, headers map[string]string) error
+	// SendMessageAsync will send message without waiting, cb will be called when message has delivered or failed
+	SendMessageAsync(topic string, key string, message interface{}, cb DeliveryFunc) error
+	// SendMessages will send all messages together and wait until every messages has delivered or failed
+	SendMessages(messages []*ProducerMessage) error
+	// SetPartitioner set partitioner to select partition of the message sent to topic (that not specific partition)
+	SetPartitioner(topic string, partitioner Partitioner)
+	// SetCodec set codec to encode the message sent to topic (empty topic is the default codec, JSON if not set,
+	// or JSON with schema if schema registry is set)
+	SetCodec(topic string, codec ICodec)
+	// SetSchemaRegistry set registry to register and check compatibility of the message schema
+	SetSchemaRegistry(registry ISchemaRegistry)
+	// WithContext return producer that stop waiting for delivery report when ctx is done
+	WithContext(ctx context.Context) IProducer
 	// Close the producer
 	Close() error
 }
 
+// DeliveryFunc is the callback of the delivery report, err is not nil if message cannot be delivered
+// The callback is called from the producer events loop, so it should return quickly
+type DeliveryFunc func(partition int32, offset int64, err error)
+
+// ProducerMessage is the message to send with SendMessages
+type ProducerMessage struct {
+	Topic   string
+	Key     string
+	Message interface{}
+	Headers map[string]string
+}
+
+// Partitioner return partition (0 to partitionCount-1) for the message key
+type Partitioner func(key string, partitionCount int) int32
+
 // Producer implement IProducer, is the service to send message to Kafka
 type Producer struct {
-	ms      *Microservice
-	servers string
-	prod    *kafka.Producer
+	ms              *Microservice
+	servers         string
+	transactionalID string
+	prod            *kafka.Producer
+	mutex           sync.Mutex
+	partitioner     map[string]Partitioner
+	partitions      map[string]int
+	codecs          map[string]ICodec
+	registry        ISchemaRegistry
+	schemas         map[string]int
+
+	// closeMutex is read locked while the kafka producer is used, so Close wait for them before it close the producer
+	closeMutex sync.RWMutex
+	closed     bool
 }
 
 // NewProducer return new instance of Producer
 func NewProducer(servers string, ms *Microservice) *Producer {
 	return &Producer{
-		ms:      ms,
-		servers: servers,
+		ms:          ms,
+		servers:     servers,
+		partitioner: map[string]Partitioner{},
+		partitions:  map[string]int{},
+		codecs:      map[string]ICodec{},
+		schemas:     map[string]int{},
 	}
 }
 
-func (p *Producer) getProducer() *kafka.Producer {
+// NewTransactionalProducer return new instance of Producer with transactional.id,
+// every messages must be sent between beginTransaction and commitTransaction
+func NewTransactionalProducer(servers string, transactionalID string, ms *Microservice) *Producer {
+	p := NewProducer(servers, ms)
+	p.transactionalID = transactionalID
+	return p
+}
+
+// getProducer return kafka producer, it is created at the first call
+// It return ErrProducerClosed after Close, so the closed kafka producer is never used
+func (p *Producer) getProducer() (*kafka.Producer, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return nil, ErrProducerClosed
+	}
 	if p.prod == nil {
-		prod, _ := p.newKafkaProducer(p.servers)
+		prod, err := p.newKafkaProducer(p.servers)
+		if err != nil {
+			p.ms.LogError("PROD", err)
+			return nil, err
+		}
 		p.prod = prod
+		// Every delivery reports are handled by one events loop per producer
+		go p.handleEvents(prod)
+	}
+	return p.prod, nil
+}
+
+// useProducer call f with kafka producer, Close will wait until f has returned
+func (p *Producer) useProducer(f func(prod *kafka.Producer) error) error {
+	p.closeMutex.RLock()
+	defer p.closeMutex.RUnlock()
+	prod, err := p.getProducer()
+	if err != nil {
+		return err
+	}
+	return f(prod)
+}
+
+// handleEvents read delivery reports and errors of producer until the producer is closed
+func (p *Producer) handleEvents(prod *kafka.Producer) {
+	for e := range prod.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			cb, ok := ev.Opaque.(DeliveryFunc)
+			if !ok || cb == nil {
+				continue
+			}
+			tp := ev.TopicPartition
+			cb(tp.Partition, int64(tp.Offset), tp.Error)
+		case kafka.Error:
+			p.ms.LogError("PROD", ev)
+		}
 	}
-	return p.prod
 }
 
 // SendMessage send message to topic synchronously
 func (p *Producer) SendMessage(topic string, key string, message interface{}) error {
+	return p.SendMessageWithHeaders(topic, key, message, nil)
+}
+
+// SendMessageWithHeaders send message with headers to topic synchronously
+func (p *Producer) SendMessageWithHeaders(topic string, key string, message interface{}, headers map[string]string) error {
+	return p.sendMessage(context.Background(), topic, key, message, headers)
+}
+
+// SendMessageRaw send raw bytes with headers to topic synchronously
+func (p *Producer) SendMessageRaw(topic string, key string, value []byte, headers map[string]string) error {
+	return p.produce(context.Background(), topic, kafka.PartitionAny, key, value, headers)
+}
+
+// SendMessageToPartition send raw bytes with headers to the specific partition of topic synchronously
+func (p *Producer) SendMessageToPartition(topic string, partition int32, key string, value []byte, headers map[string]string) error {
+	return p.sendToPartition(context.Background(), topic, partition, key, value, headers)
+}
+
+func (p *Producer) sendMessage(ctx context.Context, topic string, key string, message interface{}, headers map[string]string) error {
+	value, headers, err := p.encode(topic, message, headers)
+	if err != nil {
+		return err
+	}
+	return p.produce(ctx, topic, kafka.PartitionAny, key, value, headers)
+}
+
+func (p *Producer) sendToPartition(ctx context.Context, topic string, partition int32, key string, value []byte, headers map[string]string) error {
+	if partition < 0 {
+		return fmt.Errorf("Invalid partition %d", partition)
+	}
+	return p.produce(ctx, topic, partition, key, value, headers)
+}
+
+// SendMessageAsync send message to topic asynchronously, cb (can be nil) will be called with the delivery report
+func (p *Producer) SendMessageAsync(topic string, key string, message interface{}, cb DeliveryFunc) error {
+	return p.sendMessageAsync(context.Background(), topic, key, message, cb)
+}
+
+// sendMessageAsync enqueue message with traceparent of ctx, the producer span is ended with the delivery report
+func (p *Producer) sendMessageAsync(ctx context.Context, topic string, key string, message interface{}, cb DeliveryFunc) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	value, headers, err := p.encode(topic, message, nil)
+	if err != nil {
+		return err
+	}
+	if cb == nil {
+		cb = func(partition int32, offset int64, err error) {
+			if err != nil {
+				p.ms.LogError("PROD", err)
+			}
+		}
+	}
 
-	messageJSON, err := json.Marshal(message)
+	span, headers := p.traceMessage(ctx, topic, headers)
+	err = p.produceAsync(topic, kafka.PartitionAny, key, value, headers, func(partition int32, offset int64, err error) {
+		span.End(err)
+		cb(partition, offset, err)
+	})
+	if err != nil {
+		span.End(err)
+	}
+	return err
+}
+
+// SendMessages send all messages asynchronously, and wait for every delivery reports
+// It return error if any message cannot be delivered
+func (p *Producer) SendMessages(messages []*ProducerMessage) error {
+	return p.sendMessages(context.Background(), messages)
+}
+
+func (p *Producer) sendMessages(ctx context.Context, messages []*ProducerMessage) error {
+	err := ctx.Err()
 	if err != nil {
 		return err
 	}
+	reports := make(chan error, len(messages))
+
+	var firstErr error
+	failed := 0
+	sent := 0
+	for _, message := range messages {
+		value, headers, err := p.encode(message.Topic, message.Message, message.Headers)
+		var span *Span
+		if err == nil {
+			span, headers = p.traceMessage(ctx, message.Topic, headers)
+			err = p.produceAsync(message.Topic, kafka.PartitionAny, message.Key, value, headers,
+				func(partition int32, offset int64, err error) {
+					span.End(err)
+					reports <- err
+				})
+		}
+		if err != nil {
+			span.End(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
+		sent++
+	}
+
+	for i := 0; i < sent; i++ {
+		var err error
+		select {
+		case err = <-reports:
+		case <-ctx.Done():
+			// Stop waiting, the remaining messages may still be delivered
+			return fmt.Errorf("%d of %d messages have not reported: %s", sent-i, len(messages), ctx.Err().Error())
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d messages cannot be sent: %s", failed, len(messages), firstErr.Error())
+	}
+	return nil
+}
+
+// SetPartitioner set partitioner for topic, the message without specific partition will be sent to
+// the partition that return from partitioner (default is librdkafka partitioner, hash by key)
+func (p *Producer) SetPartitioner(topic string, partitioner Partitioner) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.partitioner[topic] = partitioner
+}
+
+// SetCodec set codec for topic, empty topic set the default codec for every topics
+func (p *Producer) SetCodec(topic string, codec ICodec) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.codecs[topic] = codec
+}
+
+// SetSchemaRegistry set registry, the schema of message encoded by ISchemaCodec will be registered
+// as subject <topic>-value, and the message that is not compatible with the latest version will not be sent
+// When registry is set, the default codec is JSONSchemaCodec, so JSON messages are checked as well
+func (p *Producer) SetSchemaRegistry(registry ISchemaRegistry) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.registry = registry
+}
+
+// encode encode message with codec of topic, and return headers with content-type (and schema version)
+func (p *Producer) encode(topic string, message interface{}, headers map[string]string) ([]byte, map[string]string, error) {
+	p.mutex.Lock()
+	codec, ok := p.codecs[topic]
+	if !ok {
+		codec, ok = p.codecs[""]
+	}
+	registry := p.registry
+	p.mutex.Unlock()
+
+	if !ok || codec == nil {
+		if registry != nil {
+			codec = NewJSONSchemaCodec()
+		} else {
+			codec = NewJSONCodec()
+		}
+	}
+
+	value, err := codec.Marshal(message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Copy headers, so the caller map is not modified
+	encodedHeaders := map[string]string{}
+	for k, v := range headers {
+		encodedHeaders[k] = v
+	}
+	encodedHeaders[headerContentType] = codec.Name()
+
+	schemaCodec, ok := codec.(ISchemaCodec)
+	if !ok || registry == nil {
+		return value, encodedHeaders, nil
+	}
+
+	schema, err := schemaCodec.Schema(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	subject := topic + "-value"
+	version, err := p.registerSchema(registry, subject, schema, schemaCodec)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedHeaders["schema-subject"] = subject
+	encodedHeaders["schema-version"] = fmt.Sprintf("%d", version)
+	return value, encodedHeaders, nil
+}
+
+// registerSchema register schema once per subject and schema, the registered version is cached
+func (p *Producer) registerSchema(registry ISchemaRegistry, subject string, schema string, codec ISchemaCodec) (int, error) {
+	cacheKey := subject + "\n" + schema
+	p.mutex.Lock()
+	version, ok := p.schemas[cacheKey]
+	p.mutex.Unlock()
+	if ok {
+		return version, nil
+	}
+
+	version, err := registry.Register(subject, schema, codec)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mutex.Lock()
+	p.schemas[cacheKey] = version
+	p.mutex.Unlock()
+	return version, nil
+}
+
+// selectPartition return partition from partitioner of topic, or kafka.PartitionAny if no partitioner
+func (p *Producer) selectPartition(topic string, key string) (int32, error) {
+	p.mutex.Lock()
+	partitioner, ok := p.partitioner[topic]
+	partitionCount := p.partitions[topic]
+	p.mutex.Unlock()
+
+	if !ok || partitioner == nil {
+		return kafka.PartitionAny, nil
+	}
+
+	if partitionCount == 0 {
+		// Partition count is read from metadata only once per topic
+		var metadata *kafka.Metadata
+		err := p.useProducer(func(prod *kafka.Producer) error {
+			var err error
+			metadata, err = prod.GetMetadata(&topic, false, 5000)
+			return err
+		})
+		if err != nil {
+			return kafka.PartitionAny, err
+		}
+		partitionCount = len(metadata.Topics[topic].Partitions)
+		if partitionCount == 0 {
+			return kafka.PartitionAny, fmt.Errorf("Topic %s has no partition", topic)
+		}
+
+		p.mutex.Lock()
+		p.partitions[topic] = partitionCount
+		p.mutex.Unlock()
+	}
+
+	partition := partitioner(key, partitionCount)
+	if partition < 0 || int(partition) >= partitionCount {
+		return kafka.PartitionAny, fmt.Errorf("Partitioner return invalid partition %d of topic %s", partition, topic)
+	}
+	return partition, nil
+}
+
+// traceMessage start producer span if ctx is in trace, and return the copy of headers with traceparent of the span,
+// so the consumer continue the trace
+func (p *Producer) traceMessage(ctx context.Context, topic string, headers map[string]string) (*Span, map[string]string) {
+	span := p.ms.tracer.startChildSpan(ctx, "send "+topic, SpanKindProducer)
+	if span == nil {
+		return nil, headers
+	}
+	span.SetAttribute("messaging.system", "kafka")
+	span.SetAttribute("messaging.destination", topic)
+
+	traced := make(map[string]string, len(headers)+1)
+	for key, value := range headers {
+		traced[key] = value
+	}
+	traced[headerTraceParent] = span.TraceParent()
+	return span, traced
+}
+
+// produce send message to Kafka synchronously and wait for the delivery report until ctx is done
+func (p *Producer) produce(ctx context.Context, topic string, partition int32, key string, value []byte, headers map[string]string) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	span, headers := p.traceMessage(ctx, topic, headers)
+	delivered := make(chan error, 1)
+	err = p.produceAsync(topic, partition, key, value, headers, func(partition int32, offset int64, err error) {
+		delivered <- err
+	})
+	if err != nil {
+		span.End(err)
+		return err
+	}
+
+	// Delivery report must be checked, the message might not be delivered
+	// If ctx is done before the report, the message may still be delivered later
+	select {
+	case err = <-delivered:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	span.End(err)
+	return err
+}
+
+// produceAsync enqueue message into producer queue, cb will be called from events loop with the delivery report
+func (p *Producer) produceAsync(topic string, partition int32, key string, value []byte, headers map[string]string, cb DeliveryFunc) error {
+
+	var err error
+	if partition == kafka.PartitionAny {
+		partition, err = p.selectPartition(topic, key)
+		if err != nil {
+			return err
+		}
+	}
 
 	var keyBytes []byte
 	if len(key) > 0 {
 		keyBytes = []byte(key)
 	}
 
-	// Send Message Synchrounously
-	deliveryChan := make(chan kafka.Event)
+	return p.useProducer(func(prod *kafka.Producer) error {
+		return prod.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
+			Value:          value,
+			Key:            keyBytes,
+			Headers:        kafkaHeaders(headers),
+			Opaque:         cb,
+		}, nil)
+	})
+}
+
+// initTransactions must be called once before the first transaction (transactional producer only)
+func (p *Producer) initTransactions() error {
+	return p.useProducer(func(prod *kafka.Producer) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		return prod.InitTransactions(ctx)
+	})
+}
 
-	prod := p.getProducer()
-	err = prod.Produce(&kafka.Message{
-		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
-		Value:          []byte(messageJSON),
-		Key:            keyBytes,
-	}, deliveryChan)
-	if err != nil {
+// beginTransaction start new transaction, every messages sent after this are part of the transaction
+func (p *Producer) beginTransaction() error {
+	return p.useProducer(func(prod *kafka.Producer) error {
+		return prod.BeginTransaction()
+	})
+}
+
+// commitTransaction commit consumer offsets and every messages sent in the transaction atomically
+func (p *Producer) commitTransaction(c *kafka.Consumer, offsets []kafka.TopicPartition) error {
+	return p.useProducer(func(prod *kafka.Producer) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+
+		if len(offsets) > 0 {
+			metadata, err := c.GetConsumerGroupMetadata()
+			if err != nil {
+				return err
+			}
+			err = prod.SendOffsetsToTransaction(ctx, offsets, metadata)
+			if err != nil {
+				return err
+			}
+		}
+
+		retry := 3
+		for {
+			err := prod.CommitTransaction(ctx)
+			if err == nil {
+				return nil
+			}
+			// Retriable error can be retried with commit again, other errors need to abort the transaction
+			kafkaErr, ok := err.(kafka.Error)
+			if !ok || !kafkaErr.IsRetriable() || retry <= 0 {
+				return err
+			}
+			retry--
+		}
+	})
+}
+
+// abortTransaction discard every messages sent in the transaction
+func (p *Producer) abortTransaction() error {
+	return p.useProducer(func(prod *kafka.Producer) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		return prod.AbortTransaction(ctx)
+	})
+}
+
+// ping fetch metadata of the brokers, it return error if the brokers cannot be reached before ctx is done
+func (p *Producer) ping(ctx context.Context) error {
+	timeout := 5 * time.Second
+	deadline, ok := ctx.Deadline()
+	if ok {
+		timeout = time.Until(deadline)
+	}
+	if timeout <= 0 {
+		return context.DeadlineExceeded
+	}
+	return p.useProducer(func(prod *kafka.Producer) error {
+		_, err := prod.GetMetadata(nil, false, int(timeout/time.Millisecond))
 		return err
+	})
+}
+
+// WithContext return producer that share this producer, and wait for delivery reports with ctx
+func (p *Producer) WithContext(ctx context.Context) IProducer {
+	return &contextProducer{
+		Producer: p,
+		ctx:      ctx,
 	}
+}
+
+// contextProducer is Producer that the synchronous sends are bound to ctx
+type contextProducer struct {
+	*Producer
+	ctx context.Context
+}
+
+// SendMessage send message to topic synchronously with ctx
+func (p *contextProducer) SendMessage(topic string, key string, message interface{}) error {
+	return p.sendMessage(p.ctx, topic, key, message, nil)
+}
+
+// SendMessageWithHeaders send message with headers to topic synchronously with ctx
+func (p *contextProducer) SendMessageWithHeaders(topic string, key string, message interface{}, headers map[string]string) error {
+	return p.sendMessage(p.ctx, topic, key, message, headers)
+}
+
+// SendMessageRaw send raw bytes with headers to topic synchronously with ctx
+func (p *contextProducer) SendMessageRaw(topic string, key string, value []byte, headers map[string]string) error {
+	return p.produce(p.ctx, topic, kafka.PartitionAny, key, value, headers)
+}
+
+// SendMessageToPartition send raw bytes with headers to the specific partition of topic synchronously with ctx
+func (p *contextProducer) SendMessageToPartition(topic string, partition int32, key string, value []byte, headers map[string]string) error {
+	return p.sendToPartition(p.ctx, topic, partition, key, value, headers)
+}
 
-	<-deliveryChan
-	close(deliveryChan)
+// SendMessageAsync send message to topic asynchronously in the trace of ctx, it fail if ctx is already done
+// The delivery report is not bound to ctx, cb is called even after ctx is done
+func (p *contextProducer) SendMessageAsync(topic string, key string, message interface{}, cb DeliveryFunc) error {
+	return p.sendMessageAsync(p.ctx, topic, key, message, cb)
+}
+
+// SendMessages send all messages asynchronously, and wait for every delivery reports with ctx
+func (p *contextProducer) SendMessages(messages []*ProducerMessage) error {
+	return p.sendMessages(p.ctx, messages)
+}
 
+// Close do nothing, the shared producer is closed by its owner
+func (p *contextProducer) Close() error {
 	return nil
 }
 
 // Close the producer
+// The messages that have been sent are flushed, and the messages sent after Close return ErrProducerClosed
 func (p *Producer) Close() error {
-	if p.prod == nil {
+	// Wait for the sends that are using the producer, the next sends will see that producer has closed
+	p.closeMutex.Lock()
+	p.mutex.Lock()
+	prod := p.prod
+	wasClosed := p.closed
+	p.closed = true
+	p.mutex.Unlock()
+	p.closeMutex.Unlock()
+
+	if prod == nil || wasClosed {
 		return nil
 	}
 
-	prod := p.prod
 	prod.Flush(5000) // 5s for flush message in queue
 	prod.Close()
 
@@ -85,11 +626,32 @@ func (p *Producer) Close() error {
 	return nil
 }
 
+// kafkaHeaders convert headers map into kafka headers
+func kafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	kHeaders := make([]kafka.Header, 0, len(headers))
+	for key, value := range headers {
+		kHeaders = append(kHeaders, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return kHeaders
+}
+
+// headersMap convert kafka headers into headers map (the last value win for duplicate key)
+func headersMap(kHeaders []kafka.Header) map[string]string {
+	headers := map[string]string{}
+	for _, h := range kHeaders {
+		headers[h.Key] = string(h.Value)
+	}
+	return headers
+}
+
 func (p *Producer) newKafkaProducer(servers string) (*kafka.Producer, error) {
 
 	// Configurations
 	// https://github.com/edenhill/librdkafka/blob/master/CONFIGURATION.md
-	return kafka.NewProducer(&kafka.ConfigMap{
+	config := &kafka.ConfigMap{
 
 		// Alias for metadata.broker.list: Initial list of brokers as a CSV list of broker host or host:port.
 		// The application may also use rd_kafka_brokers_add() to add brokers during runtime.
@@ -209,5 +771,22 @@ func (p *Producer) newKafkaProducer(servers string) (*kafka.Producer, error) {
 		// retries=INT32_MAX (must be greater than 0),
 		// acks=all, queuing.strategy=fifo. Producer instantation will fail if user-supplied configuration is incompatible.
 		"enable.idempotence": true,
-	})
+	}
+
+	if len(p.transactionalID) > 0 {
+		// The TransactionalId to use for transactional delivery.
+		// This enables reliability semantics which span multiple producer sessions since it allows the client
+		// to guarantee that transactions using the same TransactionalId have been completed prior to starting any new transactions.
+		// The producer with the same transactional.id that started before will be fenced out.
+		config.SetKey("transactional.id", p.transactionalID)
+
+		// The maximum amount of time in milliseconds that the transaction coordinator will wait for a transaction status update
+		// from the producer before proactively aborting the ongoing transaction.
+		// message.timeout.ms must not be greater than transaction.timeout.ms
+		// 60000 = 60s (default)
+		config.SetKey("transaction.timeout.ms", 60000)
+		config.SetKey("message.timeout.ms", 60000)
+	}
+
+	return kafka.NewProducer(config)
 }
@@ -0,0 +1,127 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestProducerEncode(t *testing.T) {
+	type citizenIntID struct {
+		CitizenID int `json:"citizen_id"`
+	}
+
+	dir, err := ioutil.TempDir("", "schema-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := NewMicroservice()
+	withRegistry := NewProducer("", ms)
+	withRegistry.SetSchemaRegistry(NewFileSchemaRegistry(dir))
+	protobufTopic := NewProducer("", ms)
+	protobufTopic.SetCodec("citizen", NewProtobufCodec())
+
+	tests := []struct {
+		name        string
+		prod        *Producer
+		topic       string
+		message     interface{}
+		wantHeaders map[string]string
+		wantErr     bool
+	}{
+		{
+			name:        "json without registry",
+			prod:        NewProducer("", ms),
+			topic:       "citizen",
+			message:     testCitizen{CitizenID: "1"},
+			wantHeaders: map[string]string{"trace": "1", headerContentType: "application/json"},
+		},
+		{
+			name:    "json schema is registered",
+			prod:    withRegistry,
+			topic:   "citizen",
+			message: testCitizen{CitizenID: "1"},
+			wantHeaders: map[string]string{
+				"trace":           "1",
+				headerContentType: "application/json; schema=json-schema",
+				"schema-subject":  "citizen-value",
+				"schema-version":  "1",
+			},
+		},
+		{
+			name:    "incompatible json is not sent",
+			prod:    withRegistry,
+			topic:   "citizen",
+			message: citizenIntID{CitizenID: 1},
+			wantErr: true,
+		},
+		{
+			name:    "the other topic has its own subject",
+			prod:    withRegistry,
+			topic:   "mail",
+			message: citizenIntID{CitizenID: 1},
+			wantHeaders: map[string]string{
+				"trace":           "1",
+				headerContentType: "application/json; schema=json-schema",
+				"schema-subject":  "mail-value",
+				"schema-version":  "1",
+			},
+		},
+		{
+			name:    "codec of topic cannot encode message",
+			prod:    protobufTopic,
+			topic:   "citizen",
+			message: testCitizen{CitizenID: "1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"trace": "1"}
+			_, got, err := tt.prod.encode(tt.topic, tt.message, headers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(headers) != 1 {
+				t.Errorf("encode() has modified headers of caller %v", headers)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.wantHeaders) {
+				t.Errorf("encode() headers = %v, want %v", got, tt.wantHeaders)
+			}
+			for k, v := range tt.wantHeaders {
+				if got[k] != v {
+					t.Errorf("encode() headers[%s] = %s, want %s", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestProducerSendAfterClose(t *testing.T) {
+	prod := NewProducer("localhost:9092", NewMicroservice())
+	err := prod.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close can be called again, such as by defer and by Cleanup
+	err = prod.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = prod.SendMessage("citizen", "1", testCitizen{CitizenID: "1"})
+	if err != ErrProducerClosed {
+		t.Errorf("SendMessage() error = %v, want ErrProducerClosed", err)
+	}
+	err = prod.SendMessageAsync("citizen", "1", testCitizen{CitizenID: "1"}, nil)
+	if err != ErrProducerClosed {
+		t.Errorf("SendMessageAsync() error = %v, want ErrProducerClosed", err)
+	}
+}
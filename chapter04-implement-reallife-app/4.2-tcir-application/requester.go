@@ -2,7 +2,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -17,6 +21,8 @@ type IRequester interface {
 	Put(path string, params map[string]string) (string, error)
 	PutJSON(path string, body interface{}) (string, error)
 	Delete(path string, params map[string]string) (string, error)
+	// WithContext return requester that cancel the request when ctx is done
+	WithContext(ctx context.Context) IRequester
 }
 
 // Requester implement IRequester
@@ -25,6 +31,7 @@ type Requester struct {
 	baseURL string
 	req     *gorequest.SuperAgent
 	timeout time.Duration
+	ctx     context.Context
 }
 
 // NewRequester return new Requester
@@ -33,9 +40,17 @@ func NewRequester(baseURL string, timeout time.Duration, ms *Microservice) *Requ
 		baseURL: baseURL,
 		ms:      ms,
 		timeout: timeout,
+		ctx:     context.Background(),
 	}
 }
 
+// WithContext return requester that send every requests with ctx
+func (rqt *Requester) WithContext(ctx context.Context) IRequester {
+	r := *rqt
+	r.ctx = ctx
+	return &r
+}
+
 func (rqt *Requester) cloneR() *gorequest.SuperAgent {
 	r := rqt.req
 	if r == nil {
@@ -47,6 +62,51 @@ func (rqt *Requester) cloneR() *gorequest.SuperAgent {
 	return r.Clone()
 }
 
+// end send the request with ctx, the request is cancelled when ctx is done (such as HTTP client has disconnected)
+func (rqt *Requester) end(r *gorequest.SuperAgent) (*http.Response, string, error) {
+	if len(r.Errors) > 0 {
+		return nil, "", r.Errors[0]
+	}
+
+	req, err := r.MakeRequest()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Transport has the dial timeout that set by r.Timeout
+	r.Client.Transport = r.Transport
+
+	// The called service continue the trace from traceparent header
+	span := rqt.ms.tracer.startChildSpan(rqt.ctx, "HTTP "+req.Method, SpanKindClient)
+	if span != nil {
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.url", req.URL.String())
+		req.Header.Set(headerTraceParent, span.TraceParent())
+	}
+
+	start := time.Now()
+	res, err := r.Client.Do(req.WithContext(rqt.ctx))
+	if err != nil {
+		rqt.ms.observeRequest(req.Method, req.URL.String(), start, nil, err)
+		span.End(err)
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	rqt.ms.observeRequest(req.Method, req.URL.String(), start, res, err)
+	span.SetAttribute("http.status_code", res.StatusCode)
+	if err == nil && res.StatusCode >= 400 {
+		span.End(errors.New(res.Status))
+	} else {
+		span.End(err)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return res, string(body), nil
+}
+
 // Get request using HTTP GET
 func (rqt *Requester) Get(path string, params map[string]string) (string, error) {
 
@@ -61,9 +121,9 @@ func (rqt *Requester) Get(path string, params map[string]string) (string, error)
 		}
 	}
 
-	res, body, errs := r.End()
-	if len(errs) > 0 {
-		return "", errs[0]
+	res, body, err := rqt.end(r)
+	if err != nil {
+		return "", err
 	}
 
 	if res.StatusCode >= 400 {
@@ -86,9 +146,9 @@ func (rqt *Requester) Delete(path string, params map[string]string) (string, err
 		}
 	}
 
-	res, body, errs := r.End()
-	if len(errs) > 0 {
-		return "", errs[0]
+	res, body, err := rqt.end(r)
+	if err != nil {
+		return "", err
 	}
 
 	if res.StatusCode >= 400 {
@@ -117,9 +177,9 @@ func (rqt *Requester) Post(path string, params map[string]string) (string, error
 		r = r.Send(postDataStr)
 	}
 
-	res, body, errs := r.End()
-	if len(errs) > 0 {
-		return "", errs[0]
+	res, body, err := rqt.end(r)
+	if err != nil {
+		return "", err
 	}
 
 	if res.StatusCode >= 400 {
@@ -142,9 +202,9 @@ func (rqt *Requester) PostJSON(path string, jsonBody interface{}) (string, error
 		r = r.Send(jsonBody)
 	}
 
-	res, body, errs := r.End()
-	if len(errs) > 0 {
-		return "", errs[0]
+	res, body, err := rqt.end(r)
+	if err != nil {
+		return "", err
 	}
 
 	if res.StatusCode >= 400 {
@@ -172,9 +232,9 @@ func (rqt *Requester) Put(path string, params map[string]string) (string, error)
 		r = r.Send(postDataStr)
 	}
 
-	res, body, errs := r.End()
-	if len(errs) > 0 {
-		return "", errs[0]
+	res, body, err := rqt.end(r)
+	if err != nil {
+		return "", err
 	}
 
 	if res.StatusCode >= 400 {
@@ -197,9 +257,9 @@ func (rqt *Requester) PutJSON(path string, jsonBody interface{}) (string, error)
 		r = r.Send(jsonBody)
 	}
 
-	res, body, errs := r.End()
-	if len(errs) > 0 {
-		return "", errs[0]
+	res, body, err := rqt.end(r)
+	if err != nil {
+		return "", err
 	}
 
 	if res.StatusCode >= 400 {
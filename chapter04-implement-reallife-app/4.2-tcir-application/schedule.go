@@ -0,0 +1,223 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// defaultMisfireThreshold is how late the run can start before it is misfired
+	defaultMisfireThreshold = 10 * time.Second
+	// maxCatchUpRuns is the max number of missed runs that are run at once with MisfireCatchUp
+	maxCatchUpRuns = 100
+	// defaultSingletonLease is the lease of singleton lock
+	defaultSingletonLease = 30 * time.Second
+)
+
+// cronParser parse cron expression with optional seconds field (6 fields) and descriptors such as @daily
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// MisfirePolicy is what scheduler do with the runs that have missed their time,
+// because the handler has run longer than the period or the process has paused
+type MisfirePolicy int
+
+// Misfire policies
+const (
+	// MisfireSkip skip the missed runs, only the run that is late within the threshold is run (default)
+	MisfireSkip MisfirePolicy = iota
+	// MisfireFireOnce run once for every missed runs
+	MisfireFireOnce
+	// MisfireCatchUp run every missed runs in order
+	MisfireCatchUp
+)
+
+// String return name of policy
+func (p MisfirePolicy) String() string {
+	switch p {
+	case MisfireSkip:
+		return "skip"
+	case MisfireFireOnce:
+		return "fire-once"
+	case MisfireCatchUp:
+		return "catch-up"
+	}
+	return fmt.Sprintf("misfire(%d)", int(p))
+}
+
+// ISchedule is the time table of scheduler
+type ISchedule interface {
+	// Next return the next run time after t
+	Next(t time.Time) time.Time
+}
+
+// intervalSchedule run at fixed period from the previous run time, or at multiple of period if aligned
+// (so every instances have the same run times)
+type intervalSchedule struct {
+	period  time.Duration
+	aligned bool
+}
+
+func (s *intervalSchedule) Next(t time.Time) time.Time {
+	if s.aligned {
+		return t.Truncate(s.period).Add(s.period)
+	}
+	return t.Add(s.period)
+}
+
+// CronSchedule is the parsed cron expression that is evaluated in its location
+type CronSchedule struct {
+	spec     string
+	schedule cron.Schedule
+	location *time.Location
+}
+
+// ParseCron parse cron expression, with 5 fields (minute hour dom month dow), 6 fields (with seconds first)
+// or descriptor (@daily, @every 1h), location is the timezone of the expression (nil is UTC)
+func ParseCron(spec string, location *time.Location) (*CronSchedule, error) {
+	schedule, err := cronParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cron expression %q: %v", spec, err)
+	}
+	if location == nil {
+		location = time.UTC
+	}
+	return &CronSchedule{
+		spec:     spec,
+		schedule: schedule,
+		location: location,
+	}, nil
+}
+
+// Next return the next run time after t, in location of the schedule
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t.In(s.location))
+}
+
+// NextRuns return the next n run times after from, it is used to preview the schedule
+func (s *CronSchedule) NextRuns(from time.Time, n int) []time.Time {
+	return nextRuns(s, from, n)
+}
+
+// String return cron expression
+func (s *CronSchedule) String() string {
+	return s.spec
+}
+
+func nextRuns(schedule ISchedule, from time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+	next := from
+	for i := 0; i < n; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			// The schedule has no more runs (such as 30 Feb)
+			break
+		}
+		runs = append(runs, next)
+	}
+	return runs
+}
+
+// ScheduleOptions is the options of Schedule and ScheduleCron
+type ScheduleOptions struct {
+	// Name is the name of schedule in logs, metrics and NextScheduleRuns (default is the timer or cron expression)
+	Name string
+
+	// Timezone is the IANA timezone (such as Asia/Bangkok) of cron expression and ctx.Now() (default UTC)
+	Timezone string
+
+	// Jitter delay each runs randomly up to jitter, so many instances do not run at the same time
+	Jitter time.Duration
+
+	// MisfirePolicy is what to do with the runs that have missed their time
+	MisfirePolicy MisfirePolicy
+
+	// MisfireThreshold is how late the run can start before it is missed
+	MisfireThreshold time.Duration
+
+	// Middlewares are run after the global middlewares (Use)
+	Middlewares []MiddlewareFunc
+
+	// SingletonCacheServer is Redis server of the lock that make each run run on only one instance
+	SingletonCacheServer string
+
+	// SingletonLease is the lease of the lock, it is refreshed while the handler is running,
+	// and the lock is released by the lease if the instance has died
+	SingletonLease time.Duration
+}
+
+// ScheduleOption is the function to set ScheduleOptions
+type ScheduleOption func(opts *ScheduleOptions)
+
+// WithScheduleName set name of schedule
+func WithScheduleName(name string) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.Name = name
+	}
+}
+
+// WithTimezone evaluate cron expression in IANA timezone (such as Asia/Bangkok) instead of UTC
+func WithTimezone(timezone string) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.Timezone = timezone
+	}
+}
+
+// WithJitter delay each runs randomly up to jitter
+func WithJitter(jitter time.Duration) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.Jitter = jitter
+	}
+}
+
+// WithMisfirePolicy set what to do with the runs that are later than threshold (0 is the default 10s)
+func WithMisfirePolicy(policy MisfirePolicy, threshold time.Duration) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.MisfirePolicy = policy
+		if threshold > 0 {
+			opts.MisfireThreshold = threshold
+		}
+	}
+}
+
+// WithScheduleMiddlewares add middlewares to the handler of this schedule
+func WithScheduleMiddlewares(middlewares ...MiddlewareFunc) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.Middlewares = append(opts.Middlewares, middlewares...)
+	}
+}
+
+// WithSingleton run each run on only one instance, the instance that acquire the lock in Redis run it
+// and the others skip it, lease (0 is the default 30s) is how long the lock is held after the instance has died
+func WithSingleton(cacheServer string, lease time.Duration) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.SingletonCacheServer = cacheServer
+		opts.SingletonLease = lease
+		if lease <= 0 {
+			opts.SingletonLease = defaultSingletonLease
+		}
+	}
+}
+
+// newScheduleOptions return ScheduleOptions with default values applied by opts, and the location of timezone
+func newScheduleOptions(opts []ScheduleOption) (*ScheduleOptions, *time.Location, error) {
+	options := &ScheduleOptions{
+		MisfirePolicy:    MisfireSkip,
+		MisfireThreshold: defaultMisfireThreshold,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	location := time.UTC
+	if len(options.Timezone) > 0 {
+		loc, err := time.LoadLocation(options.Timezone)
+		if err != nil {
+			return options, location, fmt.Errorf("Invalid timezone %s: %v", options.Timezone, err)
+		}
+		location = loc
+	}
+	return options, location, nil
+}
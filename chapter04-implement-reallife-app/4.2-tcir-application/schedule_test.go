@@ -0,0 +1,314 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testTimes return times in RFC3339, so the results can be compared
+func testTimes(times []time.Time) string {
+	strs := []string{}
+	for _, t := range times {
+		strs = append(strs, t.Format(time.RFC3339))
+	}
+	return fmt.Sprint(strs)
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	tm, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestParseCron(t *testing.T) {
+	bangkok := time.FixedZone("ICT", 7*60*60)
+	tests := []struct {
+		name     string
+		spec     string
+		location *time.Location
+		from     string
+		n        int
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "5 fields",
+			spec: "0 0 * * *",
+			from: "2021-01-18T10:00:00Z",
+			n:    2,
+			want: []string{"2021-01-19T00:00:00Z", "2021-01-20T00:00:00Z"},
+		},
+		{
+			name: "6 fields with seconds",
+			spec: "*/30 * * * * *",
+			from: "2021-01-18T10:00:10Z",
+			n:    3,
+			want: []string{"2021-01-18T10:00:30Z", "2021-01-18T10:01:00Z", "2021-01-18T10:01:30Z"},
+		},
+		{
+			name: "descriptor",
+			spec: "@hourly",
+			from: "2021-01-18T10:20:00Z",
+			n:    1,
+			want: []string{"2021-01-18T11:00:00Z"},
+		},
+		{
+			name: "every",
+			spec: "@every 15m",
+			from: "2021-01-18T10:20:00Z",
+			n:    2,
+			want: []string{"2021-01-18T10:35:00Z", "2021-01-18T10:50:00Z"},
+		},
+		{
+			name:     "midnight in timezone",
+			spec:     "0 0 * * *",
+			location: bangkok,
+			from:     "2021-01-18T10:00:00Z",
+			n:        2,
+			want:     []string{"2021-01-19T00:00:00+07:00", "2021-01-20T00:00:00+07:00"},
+		},
+		{
+			name: "weekday",
+			spec: "0 9 * * MON-FRI",
+			from: "2021-01-22T10:00:00Z", // Friday
+			n:    2,
+			want: []string{"2021-01-25T09:00:00Z", "2021-01-26T09:00:00Z"},
+		},
+		{
+			name: "no more runs",
+			spec: "0 0 30 2 *",
+			from: "2021-01-18T10:00:00Z",
+			n:    3,
+			want: []string{},
+		},
+		{name: "invalid field", spec: "60 * * * *", wantErr: true},
+		{name: "too few fields", spec: "* * *", wantErr: true},
+		{name: "empty", spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.spec, tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := testTimes(schedule.NextRuns(mustParseTime(t, tt.from), tt.n))
+			if got != fmt.Sprint(tt.want) {
+				t.Errorf("NextRuns() = %s, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntervalSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *intervalSchedule
+		from     string
+		want     []string
+	}{
+		{
+			name:     "from the previous run",
+			schedule: &intervalSchedule{period: 10 * time.Minute},
+			from:     "2021-01-18T10:03:00Z",
+			want:     []string{"2021-01-18T10:13:00Z", "2021-01-18T10:23:00Z"},
+		},
+		{
+			name:     "aligned to multiple of period",
+			schedule: &intervalSchedule{period: 10 * time.Minute, aligned: true},
+			from:     "2021-01-18T10:03:00Z",
+			want:     []string{"2021-01-18T10:10:00Z", "2021-01-18T10:20:00Z"},
+		},
+		{
+			name:     "aligned on the run time",
+			schedule: &intervalSchedule{period: 10 * time.Minute, aligned: true},
+			from:     "2021-01-18T10:10:00Z",
+			want:     []string{"2021-01-18T10:20:00Z", "2021-01-18T10:30:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testTimes(nextRuns(tt.schedule, mustParseTime(t, tt.from), len(tt.want)))
+			if got != fmt.Sprint(tt.want) {
+				t.Errorf("nextRuns() = %s, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []ScheduleOption
+		wantPolicy    MisfirePolicy
+		wantThreshold time.Duration
+		wantLease     time.Duration
+		wantLocation  string
+		wantErr       bool
+	}{
+		{"default", nil, MisfireSkip, defaultMisfireThreshold, 0, "UTC", false},
+		{"misfire policy", []ScheduleOption{WithMisfirePolicy(MisfireCatchUp, time.Minute)}, MisfireCatchUp, time.Minute, 0, "UTC", false},
+		{"misfire policy with default threshold", []ScheduleOption{WithMisfirePolicy(MisfireFireOnce, 0)},
+			MisfireFireOnce, defaultMisfireThreshold, 0, "UTC", false},
+		{"singleton with default lease", []ScheduleOption{WithSingleton("redis:6379", 0)},
+			MisfireSkip, defaultMisfireThreshold, defaultSingletonLease, "UTC", false},
+		{"timezone", []ScheduleOption{WithTimezone("UTC")}, MisfireSkip, defaultMisfireThreshold, 0, "UTC", false},
+		{"invalid timezone", []ScheduleOption{WithTimezone("Asia/Nowhere")}, MisfireSkip, defaultMisfireThreshold, 0, "UTC", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, location, err := newScheduleOptions(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newScheduleOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if options.MisfirePolicy != tt.wantPolicy || options.MisfireThreshold != tt.wantThreshold {
+				t.Errorf("misfire = %s %s, want %s %s", options.MisfirePolicy, options.MisfireThreshold, tt.wantPolicy, tt.wantThreshold)
+			}
+			if options.SingletonLease != tt.wantLease {
+				t.Errorf("SingletonLease = %s, want %s", options.SingletonLease, tt.wantLease)
+			}
+			if location.String() != tt.wantLocation {
+				t.Errorf("location = %s, want %s", location, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestFireScheduleMisfire(t *testing.T) {
+	due := []string{"2021-01-18T10:00:00Z", "2021-01-18T10:01:00Z", "2021-01-18T10:02:00Z"}
+	tests := []struct {
+		name       string
+		policy     MisfirePolicy
+		due        []string
+		late       time.Duration
+		wantRuns   []string
+		wantMissed int
+	}{
+		{"skip run on time", MisfireSkip, due[:1], time.Second, due[:1], 0},
+		{"skip run the latest within threshold", MisfireSkip, due, 5 * time.Second, due[2:], 0},
+		{"skip the late runs", MisfireSkip, due, time.Minute, []string{}, 1},
+		{"fire once for the late runs", MisfireFireOnce, due, time.Minute, due[2:], 0},
+		{"fire once within threshold", MisfireFireOnce, due[:1], time.Second, due[:1], 0},
+		{"catch up every runs in order", MisfireCatchUp, due, time.Minute, due, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := NewMicroservice()
+			ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+			runs := []time.Time{}
+			job := &scheduleJob{
+				name:     "job",
+				schedule: &intervalSchedule{period: time.Minute},
+				location: time.UTC,
+				options:  &ScheduleOptions{MisfirePolicy: tt.policy, MisfireThreshold: defaultMisfireThreshold},
+			}
+			err := ms.registerSchedule(job, func(ctx IContext) error {
+				runs = append(runs, ctx.Now())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dueTimes := []time.Time{}
+			for _, d := range tt.due {
+				dueTimes = append(dueTimes, mustParseTime(t, d))
+			}
+			ms.fireSchedule(job, dueTimes, tt.late)
+
+			if got := testTimes(runs); got != fmt.Sprint(tt.wantRuns) {
+				t.Errorf("runs = %s, want %v", got, tt.wantRuns)
+			}
+			history, err := ms.jobStore.ListRuns("job", 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			missed := 0
+			for _, run := range history {
+				if run.Status == JobRunMissed {
+					missed++
+				}
+			}
+			if missed != tt.wantMissed {
+				t.Errorf("missed runs = %d, want %d", missed, tt.wantMissed)
+			}
+			if len(history) != len(tt.wantRuns)+tt.wantMissed {
+				t.Errorf("history = %d runs, want %d", len(history), len(tt.wantRuns)+tt.wantMissed)
+			}
+		})
+	}
+}
+
+func TestRunScheduleOfPausedJob(t *testing.T) {
+	ms := NewMicroservice()
+	ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+	count := 0
+	job := &scheduleJob{
+		name:     "job",
+		schedule: &intervalSchedule{period: time.Minute},
+		location: time.UTC,
+		options:  &ScheduleOptions{},
+	}
+	err := ms.registerSchedule(job, func(ctx IContext) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ms.jobStore.SetPaused("job", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The scheduled run is skipped, but the manual run is run
+	ms.runSchedule(job, time.Now(), JobTriggerSchedule)
+	if count != 0 {
+		t.Errorf("scheduled run of paused job has run")
+	}
+	ms.runSchedule(job, time.Now(), JobTriggerManual)
+	if count != 1 {
+		t.Errorf("manual run of paused job has not run")
+	}
+}
+
+func TestScheduleTimerNotPositive(t *testing.T) {
+	tests := []struct {
+		name  string
+		timer time.Duration
+	}{
+		{"zero", 0},
+		{"negative", -time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewCaptureLogSink()
+			ms := NewMicroservice()
+			ms.SetLogger(NewLogger(sink, LogLevelDebug))
+			exitChan := ms.Schedule(tt.timer, func(ctx IContext) error {
+				return nil
+			})
+
+			// The job is not registered, and exit does not block the caller
+			if len(ms.schedules) != 0 {
+				t.Errorf("schedules = %d, want 0", len(ms.schedules))
+			}
+			exitChan <- true
+			entries := sink.Entries()
+			if len(entries) != 1 || entries[0].Level != LogLevelError {
+				t.Errorf("entries = %s, want the error of timer", logMessages(entries))
+			}
+		})
+	}
+}
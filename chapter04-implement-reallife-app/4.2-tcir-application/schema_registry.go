@@ -0,0 +1,155 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ISchemaRegistry is interface to store schema versions of each subject
+type ISchemaRegistry interface {
+	// Register register schema as the new version of subject, it return the existing version if schema has not changed
+	// and return error if schema is not compatible with the latest version
+	Register(subject string, schema string, codec ISchemaCodec) (int, error)
+	// Latest return the latest version of subject (nil if subject has no schema)
+	Latest(subject string) (*SchemaVersion, error)
+	// Version return the specific version of subject (nil if not found)
+	Version(subject string, version int) (*SchemaVersion, error)
+}
+
+// SchemaVersion is the version of schema in subject
+type SchemaVersion struct {
+	Subject   string    `json:"subject"`
+	Version   int       `json:"version"`
+	Codec     string    `json:"codec"`
+	Schema    string    `json:"schema"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FileSchemaRegistry implement ISchemaRegistry, it store versions of each subject in JSON file
+type FileSchemaRegistry struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewFileSchemaRegistry return new FileSchemaRegistry that store schemas in dir
+func NewFileSchemaRegistry(dir string) *FileSchemaRegistry {
+	return &FileSchemaRegistry{
+		dir: dir,
+	}
+}
+
+// Register register schema as the new version of subject
+func (r *FileSchemaRegistry) Register(subject string, schema string, codec ISchemaCodec) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	versions, err := r.read(subject)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		if latest.Schema == schema {
+			return latest.Version, nil
+		}
+		if latest.Codec != codec.Name() {
+			return 0, fmt.Errorf("Schema of %s is %s, cannot register %s", subject, latest.Codec, codec.Name())
+		}
+		err = codec.CheckCompatibility(schema, latest.Schema)
+		if err != nil {
+			return 0, fmt.Errorf("Schema is not compatible with %s version %d: %s", subject, latest.Version, err.Error())
+		}
+	}
+
+	version := &SchemaVersion{
+		Subject:   subject,
+		Version:   len(versions) + 1,
+		Codec:     codec.Name(),
+		Schema:    schema,
+		CreatedAt: time.Now(),
+	}
+	versions = append(versions, version)
+
+	err = r.write(subject, versions)
+	if err != nil {
+		return 0, err
+	}
+	return version.Version, nil
+}
+
+// Latest return the latest version of subject
+func (r *FileSchemaRegistry) Latest(subject string) (*SchemaVersion, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	versions, err := r.read(subject)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Version return the specific version of subject
+func (r *FileSchemaRegistry) Version(subject string, version int) (*SchemaVersion, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	versions, err := r.read(subject)
+	if err != nil {
+		return nil, err
+	}
+	if version <= 0 || version > len(versions) {
+		return nil, nil
+	}
+	return versions[version-1], nil
+}
+
+func (r *FileSchemaRegistry) filename(subject string) string {
+	return filepath.Join(r.dir, escapeName(subject)+".json")
+}
+
+func (r *FileSchemaRegistry) read(subject string) ([]*SchemaVersion, error) {
+	data, err := ioutil.ReadFile(r.filename(subject))
+	if os.IsNotExist(err) {
+		return []*SchemaVersion{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	versions := []*SchemaVersion{}
+	err = json.Unmarshal(data, &versions)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (r *FileSchemaRegistry) write(subject string, versions []*SchemaVersion) error {
+	err := os.MkdirAll(r.dir, 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to temp file then rename, so the registry file is never half written
+	filename := r.filename(subject)
+	tmp := filename + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
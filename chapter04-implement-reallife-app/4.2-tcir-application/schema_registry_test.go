@@ -0,0 +1,88 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileSchemaRegistryRegister(t *testing.T) {
+	type citizenV2 struct {
+		CitizenID string `json:"citizen_id"`
+		Email     string `json:"email,omitempty"`
+	}
+	type citizenIntID struct {
+		CitizenID int `json:"citizen_id"`
+	}
+	codec := NewJSONSchemaCodec()
+	schemaOf := func(v interface{}) string {
+		schema, err := codec.Schema(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return schema
+	}
+	avroCodec, err := NewAvroCodec(testCitizenAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		codec       ISchemaCodec
+		schema      string
+		wantVersion int
+		wantErr     bool
+	}{
+		{"first version", codec, schemaOf(testCitizen{}), 1, false},
+		{"same schema return the existing version", codec, schemaOf(testCitizen{}), 1, false},
+		{"compatible schema is the new version", codec, schemaOf(citizenV2{}), 2, false},
+		{"incompatible schema is rejected", codec, schemaOf(citizenIntID{}), 0, true},
+		{"different codec is rejected", avroCodec, testCitizenAvroSchema, 0, true},
+		{"compatible with the latest version", codec, schemaOf(citizenV2{}), 2, false},
+	}
+
+	dir, err := ioutil.TempDir("", "schema-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	registry := NewFileSchemaRegistry(dir)
+
+	// Each case register into the same subject in order
+	for _, tt := range tests {
+		version, err := registry.Register("citizen-value", tt.schema, tt.codec)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: Register() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if version != tt.wantVersion {
+			t.Errorf("%s: Register() = %d, want %d", tt.name, version, tt.wantVersion)
+		}
+	}
+
+	// The versions are read from file by the new registry
+	registry = NewFileSchemaRegistry(dir)
+	latest, err := registry.Latest("citizen-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest == nil || latest.Version != 2 || latest.Schema != schemaOf(citizenV2{}) || latest.Codec != codec.Name() {
+		t.Errorf("Latest() = %+v, want version 2", latest)
+	}
+	first, err := registry.Version("citizen-value", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == nil || first.Schema != schemaOf(testCitizen{}) {
+		t.Errorf("Version(1) = %+v, want the first schema", first)
+	}
+	missing, err := registry.Version("citizen-value", 3)
+	if err != nil || missing != nil {
+		t.Errorf("Version(3) = %+v, %v, want nil", missing, err)
+	}
+	missing, err = registry.Latest("mail-value")
+	if err != nil || missing != nil {
+		t.Errorf("Latest() of unknown subject = %+v, %v, want nil", missing, err)
+	}
+}
@@ -0,0 +1,373 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// headerTraceParent is the W3C trace-context header, it is sent in HTTP and Kafka headers
+// Format: 00-{trace-id 32 hex}-{parent-id 16 hex}-{trace-flags 2 hex}
+const headerTraceParent = "traceparent"
+
+const (
+	// tracerBatchSize is the max number of spans in one export
+	tracerBatchSize = 512
+	// tracerExportInterval is the max time that ended spans wait before they are exported
+	tracerExportInterval = 5 * time.Second
+	// tracerQueueSize is the max number of spans that wait for export, the new spans are dropped when it is full
+	tracerQueueSize = 4096
+)
+
+// SpanKind is the kind of span (the same values as OpenTelemetry)
+type SpanKind int
+
+// Span kinds
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+// SpanContext is the identity of span that is propagated to the other services
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+	Sampled bool   `json:"-"`
+}
+
+// IsValid return true if trace id and span id are set
+func (sc SpanContext) IsValid() bool {
+	return len(sc.TraceID) == 32 && len(sc.SpanID) == 16
+}
+
+// TraceParent return the value of traceparent header
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-" + flags
+}
+
+// ParseTraceParent parse the value of traceparent header, it return false if the value is invalid
+func ParseTraceParent(traceParent string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly 4 parts, the future versions can add more parts
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) || len(flags) != 2 {
+		return SpanContext{}, false
+	}
+	flagBytes, err := hex.DecodeString(flags)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	return SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: flagBytes[0]&1 == 1,
+	}, true
+}
+
+// isHexID return true if id is lowercase hex of length n and it is not all zeros
+func isHexID(id string, n int) bool {
+	if len(id) != n || strings.ToLower(id) != id || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func newHexID(n int) string {
+	b := make([]byte, n/2)
+	_, err := rand.Read(b)
+	if err != nil {
+		// crypto/rand does not fail on supported platforms, use time as fallback
+		return fmt.Sprintf("%0*x", n, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Span is the unit of work in trace, every methods can be called on nil span (it do nothing)
+type Span struct {
+	tracer     *Tracer
+	name       string
+	kind       SpanKind
+	sc         SpanContext
+	parentID   string
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	links      []SpanContext
+	err        error
+	ended      bool
+	mutex      sync.Mutex
+}
+
+// SpanContext return identity of span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// TraceParent return the value of traceparent header that make this span the parent of remote span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return s.sc.TraceParent()
+}
+
+// SetAttribute set attribute of span, value should be string, bool, int, int64 or float64
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes[key] = value
+}
+
+// AddLink link span to the other span that is not its parent (such as every messages in batch)
+func (s *Span) AddLink(sc SpanContext) {
+	if s == nil || !sc.IsValid() {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.links = append(s.links, sc)
+}
+
+// End end the span and send it to exporter, err (if not nil) is recorded as the span status
+// Only the first End is recorded
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mutex.Unlock()
+
+	s.tracer.export(s)
+}
+
+// data return the copy of ended span for exporter
+func (s *Span) data() *SpanData {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	attributes := make(map[string]interface{}, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes[key] = value
+	}
+	errMsg := ""
+	if s.err != nil {
+		errMsg = s.err.Error()
+	}
+	return &SpanData{
+		ServiceName:  s.tracer.serviceName,
+		TraceID:      s.sc.TraceID,
+		SpanID:       s.sc.SpanID,
+		ParentSpanID: s.parentID,
+		Name:         s.name,
+		Kind:         s.kind,
+		Start:        s.start,
+		End:          s.end,
+		Attributes:   attributes,
+		Links:        append([]SpanContext{}, s.links...),
+		Error:        errMsg,
+	}
+}
+
+type spanContextKey struct{}
+
+// contextWithSpan return ctx that carry span, the dependencies that are bound to ctx create child spans of it
+func contextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext return span that ctx carry (nil if ctx is not in trace)
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// Tracer create spans and export the ended spans in batches, without exporter the spans are only propagated
+type Tracer struct {
+	ms          *Microservice
+	serviceName string
+	exporter    ISpanExporter
+	spans       chan *Span
+	done        chan bool
+	dropped     int32
+
+	// closeMutex is read locked while the span is queued, so Close wait for them before it close the queue
+	closeMutex sync.RWMutex
+	closed     bool
+}
+
+// NewTracer return new Tracer, exporter can be nil to propagate trace context without exporting spans
+func NewTracer(serviceName string, exporter ISpanExporter, ms *Microservice) *Tracer {
+	t := &Tracer{
+		ms:          ms,
+		serviceName: serviceName,
+		exporter:    exporter,
+		spans:       make(chan *Span, tracerQueueSize),
+		done:        make(chan bool),
+	}
+	if exporter != nil {
+		go t.run()
+	} else {
+		close(t.done)
+	}
+	return t
+}
+
+// startSpan start span that is the child of parent, or start new trace if parent is not valid
+func (t *Tracer) startSpan(parent SpanContext, name string, kind SpanKind) *Span {
+	sc := SpanContext{
+		TraceID: parent.TraceID,
+		SpanID:  newHexID(16),
+		Sampled: parent.Sampled,
+	}
+	parentID := parent.SpanID
+	if !parent.IsValid() {
+		sc.TraceID = newHexID(32)
+		sc.Sampled = true
+		parentID = ""
+	}
+	return &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		sc:         sc,
+		parentID:   parentID,
+		start:      time.Now(),
+		attributes: map[string]interface{}{},
+	}
+}
+
+// StartSpan start span that is the child of span in ctx (or new trace), and return ctx that carry the new span
+func (t *Tracer) StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := t.startSpan(SpanFromContext(ctx).SpanContext(), name, kind)
+	return contextWithSpan(ctx, span), span
+}
+
+// startRemoteSpan start span that is the child of remote span in traceparent header (or new trace)
+func (t *Tracer) startRemoteSpan(traceParent string, name string, kind SpanKind) *Span {
+	parent, _ := ParseTraceParent(traceParent)
+	return t.startSpan(parent, name, kind)
+}
+
+// startChildSpan start span only if ctx is in trace, the dependencies use it so the calls outside
+// of handlers do not create new traces
+func (t *Tracer) startChildSpan(ctx context.Context, name string, kind SpanKind) *Span {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	return t.startSpan(parent.SpanContext(), name, kind)
+}
+
+// export queue the ended span, it never block the handler, the span is dropped if the queue is full
+func (t *Tracer) export(span *Span) {
+	if t.exporter == nil || !span.sc.Sampled {
+		return
+	}
+	t.closeMutex.RLock()
+	defer t.closeMutex.RUnlock()
+	if t.closed {
+		// The tracer has closed, the span is dropped
+		return
+	}
+	select {
+	case t.spans <- span:
+	default:
+		atomic.AddInt32(&t.dropped, 1)
+	}
+}
+
+// run export the queued spans in batches until the tracer has closed
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(tracerExportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, tracerBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := t.exporter.Export(batch)
+		if err != nil {
+			t.ms.LogError("TRACER", err)
+		}
+		batch = make([]*SpanData, 0, tracerBatchSize)
+	}
+
+	for {
+		select {
+		case span, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span.data())
+			if len(batch) >= tracerBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close export the remaining spans and close the exporter, the spans that end after Close are dropped
+func (t *Tracer) Close() error {
+	// Wait for the spans that are being queued, the next spans will see that tracer has closed
+	t.closeMutex.Lock()
+	wasClosed := t.closed
+	t.closed = true
+	if t.exporter != nil && !wasClosed {
+		close(t.spans)
+	}
+	t.closeMutex.Unlock()
+
+	if t.exporter == nil || wasClosed {
+		return nil
+	}
+
+	<-t.done
+	dropped := atomic.LoadInt32(&t.dropped)
+	if dropped > 0 {
+		t.ms.Log("TRACER", fmt.Sprintf("%d spans have dropped because the export queue was full", dropped))
+	}
+	return t.exporter.Close()
+}
@@ -0,0 +1,216 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpanData is the ended span that is sent to exporter
+type SpanData struct {
+	ServiceName  string                 `json:"service_name"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Links        []SpanContext          `json:"links,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// ISpanExporter is interface to export ended spans, Export is called from one goroutine
+type ISpanExporter interface {
+	Export(spans []*SpanData) error
+	Close() error
+}
+
+// NewSpanExporter return exporter by kind, "otlp" export to OTLP/HTTP endpoint (such as http://otel-collector:4318/v1/traces),
+// "file" write JSON lines to file at endpoint, and empty kind return nil (spans are not exported)
+func NewSpanExporter(kind string, endpoint string) (ISpanExporter, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "otlp":
+		return NewOTLPSpanExporter(endpoint), nil
+	case "file":
+		return NewFileSpanExporter(endpoint)
+	}
+	return nil, fmt.Errorf("Unknown span exporter %s", kind)
+}
+
+// FileSpanExporter implement ISpanExporter, it write one span per line in JSON, it is used for local testing
+type FileSpanExporter struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewFileSpanExporter return exporter that append spans to file at path
+func NewFileSpanExporter(path string) (*FileSpanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSpanExporter{
+		file: file,
+	}, nil
+}
+
+// Export write spans to file
+func (exp *FileSpanExporter) Export(spans []*SpanData) error {
+	exp.mutex.Lock()
+	defer exp.mutex.Unlock()
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, span := range spans {
+		err := encoder.Encode(span)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := exp.file.Write(buf.Bytes())
+	return err
+}
+
+// Close close the file
+func (exp *FileSpanExporter) Close() error {
+	exp.mutex.Lock()
+	defer exp.mutex.Unlock()
+	return exp.file.Close()
+}
+
+// OTLPSpanExporter implement ISpanExporter, it send spans to OpenTelemetry collector with OTLP/HTTP in JSON encoding
+type OTLPSpanExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewOTLPSpanExporter return exporter that send spans to endpoint (the full URL of /v1/traces)
+func NewOTLPSpanExporter(endpoint string) *OTLPSpanExporter {
+	return &OTLPSpanExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export send spans in one request, the spans are grouped by service name (resource)
+func (exp *OTLPSpanExporter) Export(spans []*SpanData) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	// The exporter must not be traced, otherwise every exports create new spans
+	res, err := exp.client.Post(exp.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("Export %d spans failed with status %d: %s", len(spans), res.StatusCode, string(resBody))
+	}
+	return nil
+}
+
+// Close do nothing, the requests are not kept
+func (exp *OTLPSpanExporter) Close() error {
+	return nil
+}
+
+// otlpRequest return body of ExportTraceServiceRequest in OTLP JSON encoding
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#json-protobuf-encoding
+func otlpRequest(spans []*SpanData) map[string]interface{} {
+	services := []string{}
+	byService := map[string][]interface{}{}
+	for _, span := range spans {
+		_, ok := byService[span.ServiceName]
+		if !ok {
+			services = append(services, span.ServiceName)
+		}
+		byService[span.ServiceName] = append(byService[span.ServiceName], otlpSpan(span))
+	}
+
+	resourceSpans := make([]interface{}, 0, len(services))
+	for _, service := range services {
+		resourceSpans = append(resourceSpans, map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": service}),
+			},
+			"scopeSpans": []interface{}{
+				map[string]interface{}{
+					"scope": map[string]interface{}{"name": "microservice"},
+					"spans": byService[service],
+				},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"resourceSpans": resourceSpans,
+	}
+}
+
+func otlpSpan(span *SpanData) map[string]interface{} {
+	// Status code 1 = OK, 2 = ERROR
+	status := map[string]interface{}{"code": 1}
+	if len(span.Error) > 0 {
+		status = map[string]interface{}{"code": 2, "message": span.Error}
+	}
+	links := make([]interface{}, 0, len(span.Links))
+	for _, link := range span.Links {
+		links = append(links, map[string]interface{}{
+			"traceId": link.TraceID,
+			"spanId":  link.SpanID,
+		})
+	}
+	s := map[string]interface{}{
+		"traceId":           span.TraceID,
+		"spanId":            span.SpanID,
+		"name":              span.Name,
+		"kind":              int(span.Kind),
+		"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+		"attributes":        otlpAttributes(span.Attributes),
+		"links":             links,
+		"status":            status,
+	}
+	if len(span.ParentSpanID) > 0 {
+		s["parentSpanId"] = span.ParentSpanID
+	}
+	return s
+}
+
+// otlpAttributes convert attributes into OTLP KeyValue list, unknown types are sent as string
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	kvs := make([]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		var v map[string]interface{}
+		switch val := value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": val}
+		case bool:
+			v = map[string]interface{}{"boolValue": val}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(val)}
+		case int32:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(int64(val), 10)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(val, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": val}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(val)}
+		}
+		kvs = append(kvs, map[string]interface{}{"key": key, "value": v})
+	}
+	return kvs
+}
@@ -0,0 +1,111 @@
+// Create and maintain by Chaiyapong Lapliengtrakul (chaiyapong@3dsinteractive.com), All right reserved (2021 - Present)
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID := "00f067aa0ba902b7"
+	tests := []struct {
+		name        string
+		traceParent string
+		want        SpanContext
+		wantOK      bool
+	}{
+		{"sampled", "00-" + traceID + "-" + spanID + "-01", SpanContext{traceID, spanID, true}, true},
+		{"not sampled", "00-" + traceID + "-" + spanID + "-00", SpanContext{traceID, spanID, false}, true},
+		{"sampled with the other flags", "00-" + traceID + "-" + spanID + "-03", SpanContext{traceID, spanID, true}, true},
+		{"surrounding spaces", " 00-" + traceID + "-" + spanID + "-01 ", SpanContext{traceID, spanID, true}, true},
+		{"future version with extra parts", "01-" + traceID + "-" + spanID + "-01-what-ever", SpanContext{traceID, spanID, true}, true},
+		{"version ff", "ff-" + traceID + "-" + spanID + "-01", SpanContext{}, false},
+		{"extra parts on version 00", "00-" + traceID + "-" + spanID + "-01-extra", SpanContext{}, false},
+		{"uppercase trace id", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01", SpanContext{}, false},
+		{"uppercase span id", "00-" + traceID + "-00F067AA0BA902B7-01", SpanContext{}, false},
+		{"all zero trace id", "00-00000000000000000000000000000000-" + spanID + "-01", SpanContext{}, false},
+		{"all zero span id", "00-" + traceID + "-0000000000000000-01", SpanContext{}, false},
+		{"short trace id", "00-4bf92f3577b34da6a3ce929d0e0e47-" + spanID + "-01", SpanContext{}, false},
+		{"not hex span id", "00-" + traceID + "-00f067aa0ba902bz-01", SpanContext{}, false},
+		{"not hex flags", "00-" + traceID + "-" + spanID + "-0x", SpanContext{}, false},
+		{"too few parts", "00-" + traceID + "-" + spanID, SpanContext{}, false},
+		{"one char version", "0-" + traceID + "-" + spanID + "-01", SpanContext{}, false},
+		{"empty", "", SpanContext{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTraceParent(tt.traceParent)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseTraceParent() = %+v %v, want %+v %v", got, ok, tt.want, tt.wantOK)
+			}
+			// The span context that is parsed is sent to the next service in version 00
+			if again, _ := ParseTraceParent(got.TraceParent()); ok && again != got {
+				t.Errorf("TraceParent() = %s, want the same span context", got.TraceParent())
+			}
+		})
+	}
+}
+
+func TestStartRemoteSpan(t *testing.T) {
+	tracer := NewTracer("test", nil, NewMicroservice())
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+
+	span := tracer.startRemoteSpan(parent, "consume", SpanKindConsumer)
+	if span.SpanContext().TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.parentID != "00f067aa0ba902b7" {
+		t.Errorf("span = %+v parent %s, want the child of remote span", span.SpanContext(), span.parentID)
+	}
+	if span.SpanContext().Sampled {
+		t.Errorf("Sampled = true, want the sampled flag of remote span")
+	}
+
+	// Invalid traceparent start new trace
+	span = tracer.startRemoteSpan("invalid", "consume", SpanKindConsumer)
+	if !span.SpanContext().IsValid() || span.parentID != "" || !span.SpanContext().Sampled {
+		t.Errorf("span = %+v parent %s, want new sampled trace", span.SpanContext(), span.parentID)
+	}
+}
+
+// testSpanExporter keep the exported spans in memory
+type testSpanExporter struct {
+	mutex sync.Mutex
+	spans []*SpanData
+}
+
+func (e *testSpanExporter) Export(spans []*SpanData) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *testSpanExporter) Close() error {
+	return nil
+}
+
+func TestTracerEndSpanAfterClose(t *testing.T) {
+	ms := NewMicroservice()
+	ms.SetLogger(NewLogger(NewCaptureLogSink(), LogLevelDebug))
+	exporter := &testSpanExporter{}
+	tracer := NewTracer("test", exporter, ms)
+
+	_, before := tracer.StartSpan(context.Background(), "before", SpanKindInternal)
+	_, after := tracer.StartSpan(context.Background(), "after", SpanKindInternal)
+	before.End(nil)
+	err := tracer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close can be called again, and the span that end after Close is dropped
+	err = tracer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after.End(nil)
+
+	if len(exporter.spans) != 1 || exporter.spans[0].Name != "before" {
+		t.Errorf("exported spans = %d, want the span that has ended before Close", len(exporter.spans))
+	}
+}
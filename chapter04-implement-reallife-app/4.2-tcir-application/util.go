@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"math/rand"
+	"os"
 	"regexp"
 	"strings"
 )
@@ -16,6 +17,12 @@ func randString() string {
 	return fmt.Sprintf("%d", i)
 }
 
+// hostname return hostname of the instance (pod name in k8s), or empty string if it cannot be read
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
 func escapeName(tokens ...string) string {
 	// Any name rules
 	// - Lowercase only (for consistency)